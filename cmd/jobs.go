@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"task-manager/config"
+	"task-manager/scheduler"
+	"task-manager/services"
+	"time"
+)
+
+const (
+	reminderInterval  = time.Minute
+	reminderWindow    = 24 * time.Hour
+	overdueInterval   = time.Minute
+	emailInterval     = 5 * time.Minute  // task update emails are batched over this window
+	digestInterval    = 15 * time.Minute // how often users whose digest hour has come are looked for
+	webhookInterval   = 5 * time.Second
+	tokenInterval     = time.Hour
+	tombstoneInterval = time.Hour
+)
+
+// newScheduler creates the background job scheduler. Job state is kept in the
+// configured state file when set, and in memory otherwise.
+func newScheduler(cfg config.SchedulerConfig, taskService *services.TaskService, emailService *services.EmailService, webhookService *services.WebhookService, tokenService *services.TokenService, accountService *services.AccountService, loginAttemptService *services.LoginAttemptService, exportService *services.ExportService) (*scheduler.Scheduler, error) {
+	var store scheduler.Store = scheduler.NewMemoryStore()
+	if cfg.StateFile != "" {
+		fileStore, err := scheduler.NewFileStore(cfg.StateFile)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	}
+
+	jobs := scheduler.New(store, scheduler.Options{})
+	if err := jobs.Register("due-date-reminders", reminderInterval, func(ctx context.Context) error {
+		_, err := taskService.SendDueReminders(ctx, time.Now(), reminderWindow)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := jobs.Register("overdue-tasks", overdueInterval, func(ctx context.Context) error {
+		_, err := taskService.MarkOverdueTasks(ctx, time.Now())
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := jobs.Register("task-update-emails", emailInterval, emailService.FlushPending); err != nil {
+		return nil, err
+	}
+	if err := jobs.Register("email-digests", digestInterval, func(ctx context.Context) error {
+		return emailService.SendDigests(ctx, time.Now())
+	}); err != nil {
+		return nil, err
+	}
+	if err := jobs.Register("webhook-deliveries", webhookInterval, func(ctx context.Context) error {
+		return webhookService.DeliverDue(ctx, time.Now())
+	}); err != nil {
+		return nil, err
+	}
+	if err := jobs.Register("expired-tokens", tokenInterval, func(ctx context.Context) error {
+		purges := []func(time.Time){
+			tokenService.PurgeExpired,
+			accountService.PurgeExpired,
+			loginAttemptService.PurgeExpired,
+			exportService.PurgeExpired,
+		}
+		for _, purge := range purges {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			purge(time.Now())
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := jobs.Register("tombstone-purge", tombstoneInterval, func(ctx context.Context) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		taskService.PurgeDeleted(time.Now().Add(-time.Duration(cfg.TombstoneRetention)))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
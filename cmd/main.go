@@ -1,28 +1,454 @@
 package main
 
 import (
-	"net/http"
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/netip"
+	"os"
+	"os/signal"
+	"syscall"
+	"task-manager/config"
 	"task-manager/controllers"
+	"task-manager/logging"
+	"task-manager/mailer"
+	"task-manager/middleware"
+	"task-manager/oidc"
+	"task-manager/realtime"
 	"task-manager/routes"
+	"task-manager/scheduler"
+	"task-manager/server"
 	"task-manager/services"
+	"task-manager/utils"
+	"time"
+	_ "time/tzdata" // recurrence time zones must resolve in minimal containers
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+var logger = logging.For("main")
+
+const usage = `Usage:
+  task-manager [flags]               run the server
+  task-manager config print [flags]  print the effective configuration, secrets redacted
+
+Settings come from the defaults, the -config file, environment variables and
+flags, each overriding the ones before.
+
+Flags:
+`
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if len(os.Args) < 3 || os.Args[2] != "print" {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		if err := loadConfig(os.Args[3:]).Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	args := os.Args[1:]
+	cfg := loadConfig(args)
+
+	// Catch SIGHUP before anything starts, so that a reload requested while
+	// starting up does not terminate the process; it is handled once serving.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	taskService := services.NewTaskService()
 	userService := services.NewUserService()
+	taskService.SetUsers(userService)
+	if err := applyReloadable(nil, cfg, userService); err != nil {
+		log.Fatal(err)
+	}
+	// Send the standard log package, used by libraries, through slog as well
+	slog.SetDefault(logger)
+
+	if err := configureJWT(cfg.JWT); err != nil {
+		fatal("could not configure JWT signing", err)
+	}
+	middleware.SetAdminCheck(userService.IsAdmin)
+	auditService := services.NewAuditService()
+	notificationService := services.NewNotificationService(userService)
+	taskService.Subscribe(notificationService.HandleTaskEvent)
+	emailService := services.NewEmailService(newMailer(cfg.SMTP), userService, taskService, cfg.PublicURL, signingKey("email", cfg.EmailSigningKey))
+	taskService.Subscribe(emailService.HandleTaskEvent)
+	webhookService := services.NewWebhookService(nil)
+	webhookService.AllowNetworks(webhookNetworks(cfg.WebhookAllowedNetworks)...)
+	taskService.Subscribe(webhookService.HandleTaskEvent)
 	taskController := &controllers.TaskController{TaskService: taskService}
-	userController := &controllers.UserController{UserService: userService}
+	tokenService := services.NewTokenService(userService)
+	middleware.SetRevocationCheck(tokenService.IsRevoked)
+	middleware.SetSessionTracker(tokenService.Touch)
+	sessionController := &controllers.SessionController{TokenService: tokenService}
+	userService.SetSuccessorCheck(taskService.SharesWork)
+	userService.OnDelete(taskService.HandleUserDeleted)
+	userService.OnDelete(notificationService.HandleUserDeleted)
+	userService.OnDelete(emailService.HandleUserDeleted)
+	userService.OnDelete(func(userID, _ int) {
+		tokenService.LogoutAll(userID)
+		for _, webhook := range webhookService.GetWebhooks(userID) {
+			webhookService.DeleteWebhook(userID, webhook.ID)
+		}
+	})
+	mfaService := services.NewMFAService(userService)
+	accountService := services.NewAccountService(userService, tokenService, newMailer(cfg.SMTP), cfg.PublicURL, cfg.AppURL)
+	loginAttemptService := services.NewLoginAttemptService()
+	userService.OnDelete(mfaService.HandleUserDeleted)
+	userService.OnDelete(accountService.HandleUserDeleted)
+	userService.OnDelete(loginAttemptService.HandleUserDeleted)
+	accessTokenService := services.NewAccessTokenService(userService)
+	middleware.SetAccessTokenAuthenticator(accessTokenService.Authenticate)
+	userService.OnDelete(accessTokenService.HandleUserDeleted)
+	accountService.SetAccessTokenService(accessTokenService)
+	userController := &controllers.UserController{UserService: userService, TokenService: tokenService, MFAService: mfaService, AccountService: accountService, LoginAttempts: loginAttemptService}
+	accountController := &controllers.AccountController{AccountService: accountService, UserService: userService}
+	profileController := &controllers.ProfileController{UserService: userService, AccountService: accountService, TokenService: tokenService}
+	adminController := &controllers.AdminController{UserService: userService, TokenService: tokenService, AccountService: accountService, AccessTokenService: accessTokenService, AuditService: auditService}
+	middleware.SetImpersonationAudit(adminController.AuditImpersonatedRequest)
+	mfaController := &controllers.MFAController{MFAService: mfaService}
+	accessTokenController := &controllers.AccessTokenController{AccessTokenService: accessTokenService}
+	exportService := services.NewExportService(userService, taskService, cfg.PublicURL, signingKey("export", cfg.ExportSigningKey))
+	exportService.AddSection("sessions.json", func(userID int) (interface{}, error) {
+		return tokenService.GetSessions(userID), nil
+	})
+	exportService.AddSection("login_attempts.json", func(userID int) (interface{}, error) {
+		return loginAttemptService.GetAttempts(userID), nil
+	})
+	exportService.AddSection("access_tokens.json", func(userID int) (interface{}, error) {
+		return accessTokenService.GetTokens(userID), nil
+	})
+	exportService.AddSection("notifications.json", func(userID int) (interface{}, error) {
+		return notificationService.GetNotifications(userID, false), nil
+	})
+	exportService.AddSection("preferences.json", func(userID int) (interface{}, error) {
+		return map[string]interface{}{
+			"notifications": notificationService.GetPreferences(userID),
+			"email":         emailService.GetPreferences(userID),
+			"two_factor":    map[string]bool{"enabled": mfaService.Enabled(userID)},
+		}, nil
+	})
+	exportService.AddSection("audit_log.json", func(userID int) (interface{}, error) {
+		return auditService.GetEntries(userID), nil
+	})
+	exportService.AddSection("webhooks.json", func(userID int) (interface{}, error) {
+		return webhookService.GetWebhooks(userID), nil
+	})
+	userService.OnDelete(func(userID, _ int) { exportService.DeleteExports(userID) })
+	exportController := &controllers.ExportController{ExportService: exportService}
+	ssoService := services.NewSSOService(userService, ssoProviders(cfg)...)
+	userService.OnDelete(ssoService.HandleUserDeleted)
+	ssoController := &controllers.SSOController{SSOService: ssoService, TokenService: tokenService, MFAService: mfaService}
+	notificationController := &controllers.NotificationController{NotificationService: notificationService}
+	emailController := &controllers.EmailController{EmailService: emailService}
+	webhookController := &controllers.WebhookController{WebhookService: webhookService}
+	eventController := &controllers.EventController{TaskService: taskService, Done: ctx.Done()}
+	hub := realtime.NewHub(taskService)
+	webSocketController := &controllers.WebSocketController{Hub: hub}
+	syncController := &controllers.SyncController{TaskService: taskService}
+
+	jobs, err := newScheduler(cfg.Scheduler, taskService, emailService, webhookService, tokenService, accountService, loginAttemptService, exportService)
+	if err != nil {
+		fatal("could not set up scheduler", err)
+	}
+	jobController := &controllers.JobController{Scheduler: jobs}
+
+	healthService := services.NewHealthService()
+	healthService.AddCheck("shutdown", func(context.Context) error {
+		if ctx.Err() != nil {
+			return errors.New("server is shutting down")
+		}
+		return nil
+	})
+	healthService.AddCheck("scheduler", func(context.Context) error {
+		if !jobs.Running() {
+			return errors.New("background jobs are not running")
+		}
+		return nil
+	})
+	healthService.AddCheck("scheduler_store", func(context.Context) error {
+		_, err := jobs.Jobs()
+		return err
+	})
+	healthController := &controllers.HealthController{HealthService: healthService, BuildInfo: buildInfo()}
 
 	router := mux.NewRouter()
 
+	// Probes, without authentication
+	routes.RegisterHealthRoutes(router, healthController)
+
 	// User authentication routes
-	router.HandleFunc("/api/register", userController.Register).Methods(http.MethodPost)
-	router.HandleFunc("/api/login", userController.Login).Methods(http.MethodPost)
+	routes.RegisterAuthRoutes(router, userController)
+	routes.RegisterAccountRoutes(router, accountController)
+	routes.RegisterProfileRoutes(router, profileController)
+	routes.RegisterSessionRoutes(router, sessionController)
+	routes.RegisterExportRoutes(router, exportController)
+	routes.RegisterAccessTokenRoutes(router, accessTokenController)
+	routes.RegisterSSORoutes(router, ssoController)
+	routes.RegisterMFARoutes(router, mfaController)
 
 	// Task management routes
 	routes.RegisterTaskRoutes(router, taskController)
 
-	http.ListenAndServe(":8080", router)
+	// Notification routes
+	routes.RegisterNotificationRoutes(router, notificationController)
+
+	// Email routes
+	routes.RegisterEmailRoutes(router, emailController)
+
+	// Webhook routes
+	routes.RegisterWebhookRoutes(router, webhookController)
+
+	// Real-time event stream
+	routes.RegisterEventRoutes(router, eventController)
+	routes.RegisterWebSocketRoutes(router, webSocketController)
+
+	// Offline sync
+	routes.RegisterSyncRoutes(router, syncController)
+
+	// Admin routes
+	routes.RegisterAdminRoutes(router, jobController)
+	routes.RegisterUserAdminRoutes(router, adminController)
+
+	registry := newMetricsRegistry(taskService, loginAttemptService, webhookService)
+	routes.RegisterMetricsRoutes(router, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	middleware.InstrumentRouter(router, registry)
+
+	handler := middleware.RequestIDMiddleware(middleware.AccessLogMiddleware(router))
+	srv, err := server.New(cfg.Server, handler)
+	if err != nil {
+		fatal("could not listen on "+cfg.Server.Addr, err)
+	}
+	srv.RegisterOnShutdown(hub.Close)
+
+	go reloadOnSIGHUP(hup, args, cfg, userService)
+
+	// Jobs are not tied to ctx, so that a signal lets running jobs finish;
+	// drain stops them, cancelling only those still running at the deadline.
+	jobs.Start(context.Background())
+	go func() {
+		if err := srv.Serve(); err != nil {
+			fatal("server failed", err)
+		}
+	}()
+	logger.Info("listening", "addr", srv.Addr().String(), "tls", cfg.Server.TLSCertFile != "", "version", version)
+
+	<-ctx.Done()
+	stop() // a second signal exits immediately
+	logger.Info("shutting down", "timeout", time.Duration(cfg.Server.ShutdownTimeout).String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("requests still running at the shutdown deadline were aborted", "error", err)
+	}
+	drain(shutdownCtx, jobs, emailService, webhookService, accountService, exportService)
+	logger.Info("stopped")
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// drain lets background work finish once no more requests are served:
+// running jobs, queued task update emails, due webhook deliveries, password
+// reset emails being sent and exports being built. Work left when ctx expires
+// is lost.
+func drain(ctx context.Context, jobs *scheduler.Scheduler, emailService *services.EmailService, webhookService *services.WebhookService, accountService *services.AccountService, exportService *services.ExportService) {
+	if err := jobs.Stop(ctx); err != nil {
+		logger.Warn("jobs still running at the shutdown deadline were cancelled", "error", err)
+	}
+	if err := emailService.FlushPending(ctx); err != nil {
+		logger.Error("could not send queued emails", "error", err)
+	}
+	if err := webhookService.DeliverDue(ctx, time.Now()); err != nil {
+		logger.Error("could not deliver webhooks", "error", err)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		accountService.Wait()
+		exportService.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		logger.Warn("emails and exports still in progress at the shutdown deadline were abandoned")
+	}
+}
+
+// loadConfig loads the configuration from args and the environment, or exits
+// with the problems found.
+func loadConfig(args []string) *config.Config {
+	cfg, err := config.Load(args, os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(os.Stderr, usage)
+		config.Usage(os.Stderr)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cfg
+}
+
+// applyReloadable applies the settings that can change while the server runs.
+func applyReloadable(previous, cfg *config.Config, userService *services.UserService) error {
+	level, packages, err := cfg.Log.Levels()
+	if err != nil {
+		return fmt.Errorf("could not configure logging: %w", err)
+	}
+	logging.SetLevels(level, packages)
+
+	policy, err := passwordPolicy(cfg.Password)
+	if err != nil {
+		return fmt.Errorf("could not configure password policy: %w", err)
+	}
+	userService.SetPasswordPolicy(policy)
+	userService.SetAdminEmails(cfg.AdminEmails)
+	networks, unix, err := cfg.Server.Proxies()
+	if err != nil {
+		return fmt.Errorf("could not configure trusted proxies: %w", err)
+	}
+	middleware.SetTrustedProxies(middleware.TrustedProxies{Networks: networks, Unix: unix})
+	// A new limiter forgets who has used up their attempts, so it is only
+	// replaced when its settings change.
+	if previous == nil || previous.RateLimit != cfg.RateLimit {
+		middleware.SetAuthRateLimit(utils.NewRateLimiter(time.Duration(cfg.RateLimit.AuthInterval), cfg.RateLimit.AuthBurst))
+	}
+	return nil
+}
+
+// reloadOnSIGHUP reloads the configuration whenever a SIGHUP arrives on hup.
+// Invalid configurations are rejected as a whole; of valid ones, only the
+// reloadable settings are applied and changes to the others are logged.
+func reloadOnSIGHUP(hup <-chan os.Signal, args []string, running *config.Config, userService *services.UserService) {
+	applied := running
+	for range hup {
+		cfg, err := config.Load(args, os.Getenv)
+		if err != nil {
+			logger.Error("config reload failed, keeping the current configuration", "error", err)
+			continue
+		}
+		if err := applyReloadable(applied, cfg, userService); err != nil {
+			logger.Error("config reload failed", "error", err)
+			continue
+		}
+		applied = cfg
+		if keys := config.RestartRequired(running, cfg); len(keys) > 0 {
+			logger.Warn("config reloaded; some changes take effect after a restart", "restart_required", keys)
+		} else {
+			logger.Info("config reloaded")
+		}
+	}
+}
+
+// newMailer returns an SMTP mailer, or a mailer that discards email when no
+// SMTP server is configured.
+func newMailer(cfg config.SMTPConfig) mailer.Mailer {
+	if cfg.Addr == "" {
+		return mailer.Discard{}
+	}
+	return &mailer.SMTPMailer{
+		Addr:     cfg.Addr,
+		From:     cfg.From,
+		Username: cfg.Username,
+		Password: string(cfg.Password),
+	}
+}
+
+// signingKey returns the configured key, or a random key when unset, in
+// which case the links it signs stop working after a restart.
+func signingKey(name string, configured config.Secret) []byte {
+	if configured != "" {
+		return []byte(configured)
+	}
+	logger.Warn("no " + name + " signing key configured, links will stop working after a restart")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		fatal("could not generate "+name+" signing key", err)
+	}
+	return key
+}
+
+// webhookNetworks parses the private networks webhooks may be delivered to,
+// which config validation has already checked.
+func webhookNetworks(configured []string) []netip.Prefix {
+	var networks []netip.Prefix
+	for _, network := range configured {
+		networks = append(networks, netip.MustParsePrefix(network))
+	}
+	return networks
+}
+
+// ssoProviders returns the configured OpenID Connect providers.
+func ssoProviders(cfg *config.Config) []*oidc.Provider {
+	var providers []*oidc.Provider
+	for _, provider := range cfg.OIDCProviders {
+		providers = append(providers, oidc.NewProvider(oidc.Config{
+			Name:         provider.Name,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: string(provider.ClientSecret),
+			RedirectURL:  cfg.PublicURL + "/api/sso/" + provider.Name + "/callback",
+		}, nil))
+	}
+	return providers
+}
+
+// passwordPolicy returns the configured password policy, loading the breached
+// password list if there is one.
+func passwordPolicy(cfg config.PasswordConfig) (services.PasswordPolicy, error) {
+	policy := services.DefaultPasswordPolicy()
+	policy.MinLength = cfg.MinLength
+	policy.MinEntropyBits = cfg.MinEntropy
+	policy.BcryptCost = cfg.BcryptCost
+	if cfg.BreachedPasswordsPath != "" {
+		breached, err := services.LoadBreachedPasswords(cfg.BreachedPasswordsPath)
+		if err != nil {
+			return policy, err
+		}
+		policy.Breached = breached
+	}
+	return policy, nil
+}
+
+// configureJWT loads the token signing keys, or uses the HS256 secret. Without
+// either, tokens are signed with a random key and do not survive a restart.
+func configureJWT(cfg config.JWTConfig) error {
+	var keys []*utils.SigningKey
+	for _, entry := range cfg.Keys {
+		key, err := utils.LoadSigningKey(entry.ID, entry.Algorithm, entry.Path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 && cfg.Secret != "" {
+		key, err := utils.NewSigningKey("default", utils.HS256, []byte(cfg.Secret))
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		logger.Warn("no JWT keys or secret configured; tokens are signed with a random key")
+		return nil
+	}
+	return utils.ConfigureJWT(utils.JWTConfig{
+		Keys:     keys,
+		Issuer:   cfg.Issuer,
+		Audience: cfg.Audience,
+	})
 }
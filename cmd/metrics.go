@@ -0,0 +1,79 @@
+package main
+
+import (
+	"task-manager/models"
+	"task-manager/services"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// newMetricsRegistry returns a registry with the Go runtime and process
+// metrics, such as go_goroutines, and the domain metrics: tasks by status,
+// tasks created and completed, password logins and webhook delivery attempts.
+func newMetricsRegistry(taskService *services.TaskService, loginAttemptService *services.LoginAttemptService, webhookService *services.WebhookService) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		&taskCollector{tasks: taskService, desc: prometheus.NewDesc("tasks", "Tasks by status.", []string{"status"}, nil)},
+	)
+
+	created := prometheus.NewCounter(prometheus.CounterOpts{Name: "tasks_created_total", Help: "Tasks created."})
+	completed := prometheus.NewCounter(prometheus.CounterOpts{Name: "tasks_completed_total", Help: "Tasks marked as complete."})
+	registry.MustRegister(created, completed)
+	taskService.Subscribe(func(event models.TaskEvent) {
+		switch event.Type {
+		case models.TaskCreated:
+			created.Inc()
+		case models.TaskCompleted:
+			completed.Inc()
+		case models.TaskStatusChanged:
+			if event.Task.Status == models.Completed {
+				completed.Inc()
+			}
+		}
+	})
+
+	logins := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "logins_total",
+		Help: "Password logins by outcome: succeeded, failed, or refused for a right password (disabled account or reset required).",
+	}, []string{"outcome"})
+	registry.MustRegister(logins)
+	loginAttemptService.OnRecord(func(outcome services.LoginOutcome) {
+		logins.WithLabelValues(string(outcome)).Inc()
+	})
+
+	deliveries := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_deliveries_total",
+		Help: "Webhook delivery attempts by outcome: delivered, retrying, or failed after the last attempt.",
+	}, []string{"outcome"})
+	registry.MustRegister(deliveries)
+	webhookService.OnAttempt(func(delivery models.WebhookDelivery) {
+		switch {
+		case delivery.Delivered:
+			deliveries.WithLabelValues("delivered").Inc()
+		case delivery.NextAttemptAt != nil:
+			deliveries.WithLabelValues("retrying").Inc()
+		default:
+			deliveries.WithLabelValues("failed").Inc()
+		}
+	})
+	return registry
+}
+
+// taskCollector counts the tasks by status when metrics are scraped.
+type taskCollector struct {
+	tasks *services.TaskService
+	desc  *prometheus.Desc
+}
+
+func (c *taskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *taskCollector) Collect(ch chan<- prometheus.Metric) {
+	for status, count := range c.tasks.CountByStatus() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), string(status))
+	}
+}
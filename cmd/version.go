@@ -0,0 +1,30 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"task-manager/models"
+)
+
+// Set at link time, e.g.
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)" ./cmd
+var (
+	version   = "dev"
+	commit    string
+	buildTime string
+)
+
+// buildInfo returns the build metadata of the binary. Without a link-time
+// commit, the revision recorded by the go command is used.
+func buildInfo() models.BuildInfo {
+	info := models.BuildInfo{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok && info.Commit == "" {
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+	return info
+}
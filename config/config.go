@@ -0,0 +1,399 @@
+// Package config loads the server configuration from a YAML or TOML file,
+// environment variables and command-line flags, in increasing order of
+// precedence.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the effective configuration of the server.
+type Config struct {
+	Server ServerConfig `yaml:"server"`
+	// PublicURL is the externally reachable address of the API, used in email links.
+	PublicURL string `yaml:"public_url"`
+	// AppURL is the address of the web app, where password reset links lead.
+	// It defaults to PublicURL.
+	AppURL string `yaml:"app_url"`
+	// AdminEmails are given the admin role, now or when they sign up.
+	AdminEmails []string   `yaml:"admin_emails"`
+	SMTP        SMTPConfig `yaml:"smtp"`
+	// EmailSigningKey signs unsubscribe links. A random key is used when it
+	// is empty, in which case links stop working after a restart.
+	EmailSigningKey Secret `yaml:"email_signing_key"`
+	// ExportSigningKey signs data export download links. A random key is
+	// used when it is empty, in which case links stop working after a restart
+	// and differ between instances.
+	ExportSigningKey Secret `yaml:"export_signing_key"`
+	// WebhookAllowedNetworks are private networks (CIDR) webhooks may be
+	// delivered to; loopback, private and link-local addresses are refused otherwise.
+	WebhookAllowedNetworks []string        `yaml:"webhook_allowed_networks"`
+	JWT                    JWTConfig       `yaml:"jwt"`
+	OIDCProviders          []OIDCProvider  `yaml:"oidc_providers"`
+	Password               PasswordConfig  `yaml:"password"`
+	RateLimit              RateLimitConfig `yaml:"rate_limit"`
+	Scheduler              SchedulerConfig `yaml:"scheduler"`
+	Log                    LogConfig       `yaml:"log"`
+}
+
+// ServerConfig configures the HTTP server. Timeouts of zero mean none.
+type ServerConfig struct {
+	// Addr is a TCP address, or "unix:" followed by the path of a Unix socket.
+	Addr              string   `yaml:"addr"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout"`
+	ReadTimeout       Duration `yaml:"read_timeout"`
+	WriteTimeout      Duration `yaml:"write_timeout"`
+	IdleTimeout       Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout bounds how long requests in flight and background work
+	// are given to finish on SIGINT or SIGTERM.
+	ShutdownTimeout Duration `yaml:"shutdown_timeout"`
+	// TLSCertFile and TLSKeyFile enable HTTPS. The files are read again
+	// when they change, so renewed certificates need no restart.
+	TLSCertFile string `yaml:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file"`
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header
+	// gives the client address: IP addresses, networks such as 10.0.0.0/8,
+	// or "unix" for proxies connecting over the Unix socket.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// Proxies parses TrustedProxies into networks, and whether proxies on the
+// Unix socket are trusted.
+func (c ServerConfig) Proxies() ([]netip.Prefix, bool, error) {
+	var networks []netip.Prefix
+	unix := false
+	for _, proxy := range c.TrustedProxies {
+		if proxy == "unix" {
+			unix = true
+			continue
+		}
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		network, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, false, fmt.Errorf("expected an IP address, a network or unix, got %q", proxy)
+		}
+		networks = append(networks, network.Masked())
+	}
+	return networks, unix, nil
+}
+
+// SMTPConfig configures outgoing email. Email is discarded when Addr is empty.
+type SMTPConfig struct {
+	Addr     string `yaml:"addr"` // host:port
+	From     string `yaml:"from"`
+	Username string `yaml:"username"`
+	Password Secret `yaml:"password"`
+}
+
+// JWTConfig configures how tokens are signed. Keys take precedence over
+// Secret; without either, tokens are signed with a random key and do not
+// survive a restart.
+type JWTConfig struct {
+	// Keys are read from files; the first one signs new tokens and the others
+	// are only accepted, for rotation.
+	Keys     []JWTKey `yaml:"keys"`
+	Secret   Secret   `yaml:"secret"` // HS256 secret of at least 32 bytes
+	Issuer   string   `yaml:"issuer"`
+	Audience string   `yaml:"audience"`
+}
+
+type JWTKey struct {
+	ID        string `yaml:"id"`
+	Algorithm string `yaml:"algorithm"` // HS256, RS256 or EdDSA
+	Path      string `yaml:"path"`
+}
+
+// OIDCProvider is an OpenID Connect provider users can log in with.
+type OIDCProvider struct {
+	Name         string `yaml:"name"`
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret Secret `yaml:"client_secret"`
+}
+
+type PasswordConfig struct {
+	MinLength  int     `yaml:"min_length"`
+	MinEntropy float64 `yaml:"min_entropy"` // in bits
+	BcryptCost int     `yaml:"bcrypt_cost"`
+	// BreachedPasswordsPath is a file of SHA-1 hashes or a directory of
+	// range files to check new passwords against.
+	BreachedPasswordsPath string `yaml:"breached_passwords_path"`
+}
+
+// RateLimitConfig limits requests per client IP to the unauthenticated
+// authentication endpoints: bursts of AuthBurst, then one every AuthInterval.
+type RateLimitConfig struct {
+	AuthInterval Duration `yaml:"auth_interval"`
+	AuthBurst    int      `yaml:"auth_burst"`
+}
+
+type SchedulerConfig struct {
+	// StateFile keeps job state across restarts; it is kept in memory when empty.
+	StateFile string `yaml:"state_file"`
+	// TombstoneRetention is how long the deletion of a task is remembered for
+	// syncing clients before it is purged.
+	TombstoneRetention Duration `yaml:"tombstone_retention"`
+}
+
+// LogConfig sets the minimum level of log lines: debug, info, warn or error.
+type LogConfig struct {
+	Level string `yaml:"level"`
+	// Packages overrides Level for some packages, such as "services" or
+	// "access" for the access log.
+	Packages map[string]string `yaml:"packages"`
+}
+
+// Levels parses the configured levels.
+func (c LogConfig) Levels() (slog.Level, map[string]slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return 0, nil, fmt.Errorf("invalid level %q", c.Level)
+	}
+	packages := map[string]slog.Level{}
+	for pkg, value := range c.Packages {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(value)); err != nil {
+			return 0, nil, fmt.Errorf("invalid level %q for %s", value, pkg)
+		}
+		packages[pkg] = l
+	}
+	return level, packages, nil
+}
+
+// Default returns the configuration used for settings that are not set anywhere.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			ReadTimeout:       Duration(30 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(2 * time.Minute),
+			ShutdownTimeout:   Duration(30 * time.Second),
+		},
+		PublicURL: "http://localhost:8080",
+		Password: PasswordConfig{
+			MinLength:  8,
+			MinEntropy: 35,
+			BcryptCost: bcrypt.DefaultCost,
+		},
+		RateLimit: RateLimitConfig{
+			AuthInterval: Duration(6 * time.Second),
+			AuthBurst:    10,
+		},
+		Scheduler: SchedulerConfig{TombstoneRetention: Duration(30 * 24 * time.Hour)},
+		Log:       LogConfig{Level: "info"},
+	}
+}
+
+// Secret is a setting that must not be shown. It prints as "[redacted]".
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// Duration is a time.Duration written like "6s" or "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", value.Line, value.Value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Load builds the configuration from the defaults, the file named by the
+// -config flag or the CONFIG_FILE environment variable, the environment and
+// the remaining command-line flags, each overriding the ones before. The
+// result is validated; every problem found is reported at once.
+// getenv is usually os.Getenv; empty variables count as unset.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	overrides := map[string]string{}
+	flags, path := newFlagSet(getenv, overrides)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []string
+	for _, s := range settings {
+		if value := getenv(s.env); value != "" {
+			if err := s.set(cfg, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", s.env, err))
+			}
+		}
+	}
+	cfg.loadOIDCEnv(getenv)
+	for _, s := range settings {
+		if value, ok := overrides[s.key]; ok {
+			if err := s.set(cfg, value); err != nil {
+				problems = append(problems, fmt.Sprintf("-%s: %v", s.key, err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	cfg.PublicURL = strings.TrimRight(cfg.PublicURL, "/")
+	cfg.AppURL = strings.TrimRight(cfg.AppURL, "/")
+	if cfg.AppURL == "" {
+		cfg.AppURL = cfg.PublicURL
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Usage writes the command-line flags Load accepts.
+func Usage(w io.Writer) {
+	flags, _ := newFlagSet(func(string) string { return "" }, map[string]string{})
+	flags.SetOutput(w)
+	flags.PrintDefaults()
+}
+
+// newFlagSet returns the flags Load accepts: -config and one flag per
+// setting that is not secret, which records its value in overrides.
+func newFlagSet(getenv func(string) string, overrides map[string]string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet("task-manager", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	path := flags.String("config", getenv("CONFIG_FILE"), "configuration file (.yaml, .yml or .toml)")
+	for _, s := range settings {
+		if s.secret {
+			continue // secrets would show in the process list
+		}
+		key := s.key
+		flags.Func(key, s.usage+" (env "+s.env+")", func(value string) error {
+			overrides[key] = value
+			return nil
+		})
+	}
+	return flags, path
+}
+
+// loadFile reads settings from a YAML or TOML file. Unknown keys are errors,
+// so that typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		var table map[string]interface{}
+		if _, err := toml.Decode(string(data), &table); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		// Decode through YAML, which checks keys and types the same way for both formats.
+		if data, err = yaml.Marshal(table); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config file type, expected .yaml, .yml or .toml", path)
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// loadOIDCEnv replaces the OpenID Connect providers with those named in
+// OIDC_PROVIDERS, each configured with OIDC_<NAME>_ISSUER,
+// OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET.
+func (c *Config) loadOIDCEnv(getenv func(string) string) {
+	names := getenv("OIDC_PROVIDERS")
+	if names == "" {
+		return
+	}
+	c.OIDCProviders = nil
+	for _, name := range splitList(names) {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		c.OIDCProviders = append(c.OIDCProviders, OIDCProvider{
+			Name:         name,
+			Issuer:       getenv(prefix + "ISSUER"),
+			ClientID:     getenv(prefix + "CLIENT_ID"),
+			ClientSecret: Secret(getenv(prefix + "CLIENT_SECRET")),
+		})
+	}
+}
+
+// Print writes the configuration as YAML, with secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// RestartRequired returns the keys of the settings that differ between old
+// and new but only take effect after a restart.
+func RestartRequired(old, new *Config) []string {
+	var keys []string
+	for _, s := range settings {
+		if !s.reloadable && !s.equal(old, new) {
+			keys = append(keys, s.key)
+		}
+	}
+	if !equalProviders(old.OIDCProviders, new.OIDCProviders) {
+		keys = append(keys, "oidc_providers")
+	}
+	return keys
+}
+
+func equalProviders(a, b []OIDCProvider) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  addr: ":9000"
+public_url: https://tasks.example.com/
+password:
+  min_length: 10
+  min_entropy: 40
+rate_limit:
+  auth_interval: 2s
+`)
+
+	cfg, err := Load([]string{"-config", path}, env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ":9000", cfg.Server.Addr)
+	assert.Equal(t, "https://tasks.example.com", cfg.PublicURL)
+	assert.Equal(t, "https://tasks.example.com", cfg.AppURL)
+	assert.Equal(t, 10, cfg.Password.MinLength)
+	assert.Equal(t, Duration(2*time.Second), cfg.RateLimit.AuthInterval)
+	assert.Equal(t, 10, cfg.RateLimit.AuthBurst) // default
+
+	// The environment overrides the file, and flags override both
+	cfg, err = Load([]string{"-password.min_length", "12"}, env(map[string]string{
+		"CONFIG_FILE":         path,
+		"HTTP_ADDR":           ":9100",
+		"PASSWORD_MIN_LENGTH": "11",
+		"ADMIN_EMAILS":        "root@example.com, ops@example.com",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, ":9100", cfg.Server.Addr)
+	assert.Equal(t, 12, cfg.Password.MinLength)
+	assert.Equal(t, 40.0, cfg.Password.MinEntropy)
+	assert.Equal(t, []string{"root@example.com", "ops@example.com"}, cfg.AdminEmails)
+
+	// Secrets cannot be passed as flags
+	_, err = Load([]string{"-jwt.secret", "x"}, env(nil))
+	assert.Error(t, err)
+}
+
+func TestLoad_TOML(t *testing.T) {
+	yamlPath := writeFile(t, "config.yaml", `
+admin_emails: [root@example.com]
+smtp:
+  addr: smtp.example.com:587
+  from: "Tasks <tasks@example.com>"
+  password: hunter2
+jwt:
+  keys:
+    - {id: "2024", algorithm: EdDSA, path: /etc/keys/2024.pem}
+oidc_providers:
+  - name: google
+    issuer: https://accounts.google.com
+    client_id: abc
+`)
+	tomlPath := writeFile(t, "config.toml", `
+admin_emails = [
+  "root@example.com", # the first administrator
+]
+oidc_providers = [{name = "google", issuer = "https://accounts.google.com", client_id = "abc"}]
+
+[smtp]
+addr = "smtp.example.com:587"
+from = "Tasks <tasks@example.com>"
+password = 'hunter2'
+
+[[jwt.keys]]
+id = "2024"
+algorithm = "EdDSA"
+path = "/etc/keys/2024.pem"
+`)
+
+	fromYAML, err := Load([]string{"-config", yamlPath}, env(nil))
+	assert.NoError(t, err)
+	fromTOML, err := Load([]string{"-config", tomlPath}, env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fromYAML, fromTOML)
+	assert.Equal(t, Secret("hunter2"), fromTOML.SMTP.Password)
+	assert.Equal(t, "Tasks <tasks@example.com>", fromTOML.SMTP.From)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	// Unknown keys are reported with their line
+	_, err := Load([]string{"-config", writeFile(t, "config.yaml", "server:\n  adr: \":9000\"\n")}, env(nil))
+	assert.ErrorContains(t, err, "line 2: field adr not found")
+	_, err = Load([]string{"-config", writeFile(t, "config.toml", "[server]\naddr = 9000 9000\n")}, env(nil))
+	assert.ErrorContains(t, err, "line 2")
+
+	// All problems are reported at once
+	_, err = Load(nil, env(map[string]string{
+		"PUBLIC_URL":          "tasks.example.com",
+		"PASSWORD_MIN_LENGTH": "0",
+		"BCRYPT_COST":         "40",
+		"JWT_SECRET":          "too short",
+		"JWT_KEYS":            "old:ES256:/etc/keys/old.pem",
+	}))
+	var validationErr *ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Len(t, validationErr.Problems, 6) // public_url, app_url, jwt.keys[0], jwt.secret, min_length, bcrypt_cost
+
+	_, err = Load(nil, env(map[string]string{
+		"HTTP_ADDR":             "unix:",
+		"HTTP_WRITE_TIMEOUT":    "-1s",
+		"HTTP_SHUTDOWN_TIMEOUT": "0s",
+		"TLS_CERT_FILE":         "/etc/tls/cert.pem",
+	}))
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Len(t, validationErr.Problems, 4)
+
+	cfg, err := Load(nil, env(map[string]string{"HTTP_ADDR": "unix:/run/task-manager.sock"}))
+	assert.NoError(t, err)
+	assert.Equal(t, Duration(30*time.Second), cfg.Server.ShutdownTimeout)
+
+	cfg, err = Load(nil, env(map[string]string{"LOG_PACKAGE_LEVELS": "services=debug, access=WARN"}))
+	assert.NoError(t, err)
+	level, packages, _ := cfg.Log.Levels()
+	assert.Equal(t, slog.LevelInfo, level)
+	assert.Equal(t, map[string]slog.Level{"services": slog.LevelDebug, "access": slog.LevelWarn}, packages)
+	_, err = Load(nil, env(map[string]string{"LOG_LEVEL": "verbose"}))
+	assert.ErrorContains(t, err, `log: invalid level "verbose"`)
+
+	_, err = Load(nil, env(map[string]string{"AUTH_RATE_LIMIT_INTERVAL": "often"}))
+	assert.ErrorContains(t, err, `AUTH_RATE_LIMIT_INTERVAL: invalid duration "often"`)
+}
+
+func TestConfig_Print(t *testing.T) {
+	cfg, err := Load(nil, env(map[string]string{
+		"SMTP_ADDR":                 "smtp.example.com:587",
+		"SMTP_FROM":                 "tasks@example.com",
+		"SMTP_PASSWORD":             "hunter2",
+		"JWT_SECRET":                "0123456789abcdef0123456789abcdef",
+		"OIDC_PROVIDERS":            "google",
+		"OIDC_GOOGLE_ISSUER":        "https://accounts.google.com",
+		"OIDC_GOOGLE_CLIENT_ID":     "abc",
+		"OIDC_GOOGLE_CLIENT_SECRET": "def",
+	}))
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, cfg.Print(&out))
+	assert.Contains(t, out.String(), "addr: smtp.example.com:587")
+	assert.Contains(t, out.String(), "auth_interval: 6s")
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.NotContains(t, out.String(), "0123456789abcdef")
+	assert.NotContains(t, out.String(), "def\n")
+	assert.Contains(t, out.String(), "password: '[redacted]'")
+	assert.Contains(t, out.String(), "email_signing_key: \"\"")
+}
+
+func TestRestartRequired(t *testing.T) {
+	old, _ := Load(nil, env(nil))
+	new, _ := Load(nil, env(map[string]string{
+		"HTTP_ADDR":             ":9000",
+		"PASSWORD_MIN_LENGTH":   "12",
+		"ADMIN_EMAILS":          "root@example.com",
+		"OIDC_PROVIDERS":        "google",
+		"OIDC_GOOGLE_ISSUER":    "https://accounts.google.com",
+		"OIDC_GOOGLE_CLIENT_ID": "abc",
+	}))
+	assert.Equal(t, []string{"server.addr", "oidc_providers"}, RestartRequired(old, new))
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is a configuration value that can be set from the environment and,
+// unless it is secret, from a command-line flag named after its key.
+type setting struct {
+	key   string // as in the config file, e.g. "password.min_length"
+	env   string
+	usage string
+	// secret settings cannot be set with flags, which show in the process list.
+	secret bool
+	// reloadable settings take effect on SIGHUP; the others need a restart.
+	reloadable bool
+	field      func(c *Config) interface{} // a pointer to the value
+}
+
+var settings = []setting{
+	{key: "server.addr", env: "HTTP_ADDR", usage: "address to listen on, host:port or unix:/path", field: func(c *Config) interface{} { return &c.Server.Addr }},
+	{key: "server.read_header_timeout", env: "HTTP_READ_HEADER_TIMEOUT", usage: "time allowed to read request headers", field: func(c *Config) interface{} { return &c.Server.ReadHeaderTimeout }},
+	{key: "server.read_timeout", env: "HTTP_READ_TIMEOUT", usage: "time allowed to read a whole request", field: func(c *Config) interface{} { return &c.Server.ReadTimeout }},
+	{key: "server.write_timeout", env: "HTTP_WRITE_TIMEOUT", usage: "time allowed to write a response", field: func(c *Config) interface{} { return &c.Server.WriteTimeout }},
+	{key: "server.idle_timeout", env: "HTTP_IDLE_TIMEOUT", usage: "time an idle keep-alive connection is kept open", field: func(c *Config) interface{} { return &c.Server.IdleTimeout }},
+	{key: "server.shutdown_timeout", env: "HTTP_SHUTDOWN_TIMEOUT", usage: "time given to requests and background work to finish on shutdown", field: func(c *Config) interface{} { return &c.Server.ShutdownTimeout }},
+	{key: "server.tls_cert_file", env: "TLS_CERT_FILE", usage: "PEM certificate chain; enables HTTPS with server.tls_key_file", field: func(c *Config) interface{} { return &c.Server.TLSCertFile }},
+	{key: "server.tls_key_file", env: "TLS_KEY_FILE", usage: "PEM private key of the certificate", field: func(c *Config) interface{} { return &c.Server.TLSKeyFile }},
+	{key: "server.trusted_proxies", env: "TRUSTED_PROXIES", usage: "comma-separated reverse proxies (IP, CIDR or unix) whose X-Forwarded-For is believed", reloadable: true, field: func(c *Config) interface{} { return &c.Server.TrustedProxies }},
+	{key: "public_url", env: "PUBLIC_URL", usage: "public address of the API, used in email links", field: func(c *Config) interface{} { return &c.PublicURL }},
+	{key: "app_url", env: "APP_URL", usage: "address of the web app, used in password reset links", field: func(c *Config) interface{} { return &c.AppURL }},
+	{key: "admin_emails", env: "ADMIN_EMAILS", usage: "comma-separated emails of users given the admin role", reloadable: true, field: func(c *Config) interface{} { return &c.AdminEmails }},
+	{key: "smtp.addr", env: "SMTP_ADDR", usage: "SMTP server (host:port); email is discarded when unset", field: func(c *Config) interface{} { return &c.SMTP.Addr }},
+	{key: "smtp.from", env: "SMTP_FROM", usage: "sender address of outgoing email", field: func(c *Config) interface{} { return &c.SMTP.From }},
+	{key: "smtp.username", env: "SMTP_USERNAME", usage: "SMTP user name", field: func(c *Config) interface{} { return &c.SMTP.Username }},
+	{key: "smtp.password", env: "SMTP_PASSWORD", secret: true, field: func(c *Config) interface{} { return &c.SMTP.Password }},
+	{key: "email_signing_key", env: "EMAIL_SIGNING_KEY", secret: true, field: func(c *Config) interface{} { return &c.EmailSigningKey }},
+	{key: "export_signing_key", env: "EXPORT_SIGNING_KEY", secret: true, field: func(c *Config) interface{} { return &c.ExportSigningKey }},
+	{key: "webhook_allowed_networks", env: "WEBHOOK_ALLOWED_NETWORKS", usage: "comma-separated private networks (CIDR) webhooks may be delivered to", field: func(c *Config) interface{} { return &c.WebhookAllowedNetworks }},
+	{key: "jwt.keys", env: "JWT_KEYS", usage: "comma-separated kid:algorithm:path token signing keys", field: func(c *Config) interface{} { return &c.JWT.Keys }},
+	{key: "jwt.secret", env: "JWT_SECRET", secret: true, field: func(c *Config) interface{} { return &c.JWT.Secret }},
+	{key: "jwt.issuer", env: "JWT_ISSUER", usage: "iss claim set on and required of tokens", field: func(c *Config) interface{} { return &c.JWT.Issuer }},
+	{key: "jwt.audience", env: "JWT_AUDIENCE", usage: "aud claim set on and required of tokens", field: func(c *Config) interface{} { return &c.JWT.Audience }},
+	{key: "password.min_length", env: "PASSWORD_MIN_LENGTH", usage: "minimum password length", reloadable: true, field: func(c *Config) interface{} { return &c.Password.MinLength }},
+	{key: "password.min_entropy", env: "PASSWORD_MIN_ENTROPY", usage: "minimum estimated password entropy in bits", reloadable: true, field: func(c *Config) interface{} { return &c.Password.MinEntropy }},
+	{key: "password.bcrypt_cost", env: "BCRYPT_COST", usage: "bcrypt cost of new password hashes", reloadable: true, field: func(c *Config) interface{} { return &c.Password.BcryptCost }},
+	{key: "password.breached_passwords_path", env: "BREACHED_PASSWORDS_PATH", usage: "breached password hashes to reject", reloadable: true, field: func(c *Config) interface{} { return &c.Password.BreachedPasswordsPath }},
+	{key: "rate_limit.auth_interval", env: "AUTH_RATE_LIMIT_INTERVAL", usage: "time between authentication requests per client IP once the burst is used", reloadable: true, field: func(c *Config) interface{} { return &c.RateLimit.AuthInterval }},
+	{key: "rate_limit.auth_burst", env: "AUTH_RATE_LIMIT_BURST", usage: "authentication requests a client IP can make at once", reloadable: true, field: func(c *Config) interface{} { return &c.RateLimit.AuthBurst }},
+	{key: "log.level", env: "LOG_LEVEL", usage: "minimum level of log lines: debug, info, warn or error", reloadable: true, field: func(c *Config) interface{} { return &c.Log.Level }},
+	{key: "log.packages", env: "LOG_PACKAGE_LEVELS", usage: "comma-separated package=level overrides of log.level, e.g. services=debug,access=warn", reloadable: true, field: func(c *Config) interface{} { return &c.Log.Packages }},
+	{key: "scheduler.state_file", env: "SCHEDULER_STATE_FILE", usage: "file to keep background job state in", field: func(c *Config) interface{} { return &c.Scheduler.StateFile }},
+	{key: "scheduler.tombstone_retention", env: "TOMBSTONE_RETENTION", usage: "how long deleted tasks are kept for syncing clients", field: func(c *Config) interface{} { return &c.Scheduler.TombstoneRetention }},
+}
+
+// set parses value into the setting's field.
+func (s setting) set(c *Config, value string) error {
+	switch field := s.field(c).(type) {
+	case *string:
+		*field = value
+	case *Secret:
+		*field = Secret(value)
+	case *int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*field = n
+	case *float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*field = f
+	case *Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*field = Duration(d)
+	case *[]string:
+		*field = splitList(value)
+	case *map[string]string:
+		pairs := map[string]string{}
+		for _, entry := range splitList(value) {
+			key, val, ok := strings.Cut(entry, "=")
+			if !ok {
+				return fmt.Errorf("invalid entry %q, expected name=value", entry)
+			}
+			pairs[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+		*field = pairs
+	case *[]JWTKey:
+		keys, err := parseJWTKeys(value)
+		if err != nil {
+			return err
+		}
+		*field = keys
+	default:
+		panic("config: unsupported type for " + s.key)
+	}
+	return nil
+}
+
+func (s setting) equal(a, b *Config) bool {
+	return reflect.DeepEqual(reflect.ValueOf(s.field(a)).Elem().Interface(), reflect.ValueOf(s.field(b)).Elem().Interface())
+}
+
+// parseJWTKeys parses a comma-separated list of "kid:algorithm:path" entries.
+func parseJWTKeys(spec string) ([]JWTKey, error) {
+	var keys []JWTKey
+	for _, entry := range splitList(spec) {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid entry %q, expected kid:algorithm:path", entry)
+		}
+		keys = append(keys, JWTKey{ID: parts[0], Algorithm: parts[1], Path: parts[2]})
+	}
+	return keys, nil
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
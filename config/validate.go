@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"task-manager/utils"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ValidationError lists everything wrong with a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// Validate checks the configuration and returns a *ValidationError listing
+// every problem found.
+func (c *Config) Validate() error {
+	var problems []string
+	problem := func(key, format string, args ...interface{}) {
+		problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+	}
+
+	if path, ok := strings.CutPrefix(c.Server.Addr, "unix:"); ok {
+		if path == "" {
+			problem("server.addr", "expected a socket path after unix:")
+		}
+	} else if c.Server.Addr == "" {
+		problem("server.addr", "is required")
+	} else if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		problem("server.addr", "expected host:port, :port or unix:/path, got %q", c.Server.Addr)
+	}
+	for _, timeout := range []struct {
+		key   string
+		value Duration
+	}{
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+	} {
+		if timeout.value < 0 {
+			problem(timeout.key, "must not be negative")
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problem("server.shutdown_timeout", "must be positive")
+	}
+	if _, _, err := c.Server.Proxies(); err != nil {
+		problem("server.trusted_proxies", "%v", err)
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		problem("server.tls_cert_file", "server.tls_cert_file and server.tls_key_file must be set together")
+	}
+	if !isHTTPURL(c.PublicURL) {
+		problem("public_url", "expected an http or https URL, got %q", c.PublicURL)
+	}
+	if !isHTTPURL(c.AppURL) {
+		problem("app_url", "expected an http or https URL, got %q", c.AppURL)
+	}
+	for _, email := range c.AdminEmails {
+		if !strings.Contains(email, "@") {
+			problem("admin_emails", "%q is not an email address", email)
+		}
+	}
+
+	if c.SMTP.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.SMTP.Addr); err != nil {
+			problem("smtp.addr", "expected host:port, got %q", c.SMTP.Addr)
+		}
+		if c.SMTP.From == "" {
+			problem("smtp.from", "is required when smtp.addr is set")
+		}
+	}
+
+	ids := map[string]bool{}
+	for i, key := range c.JWT.Keys {
+		name := fmt.Sprintf("jwt.keys[%d]", i)
+		if key.ID == "" || key.Path == "" {
+			problem(name, "id and path are required")
+		}
+		if ids[key.ID] {
+			problem(name, "duplicate key ID %q", key.ID)
+		}
+		ids[key.ID] = true
+		switch key.Algorithm {
+		case utils.HS256, utils.RS256, utils.EdDSA:
+		default:
+			problem(name, "unsupported algorithm %q, expected %s, %s or %s", key.Algorithm, utils.HS256, utils.RS256, utils.EdDSA)
+		}
+	}
+	if c.JWT.Secret != "" && len(c.JWT.Secret) < 32 {
+		problem("jwt.secret", "must be at least 32 bytes")
+	}
+
+	names := map[string]bool{}
+	for i, provider := range c.OIDCProviders {
+		name := fmt.Sprintf("oidc_providers[%d]", i)
+		if provider.Name == "" {
+			problem(name, "name is required")
+		} else if names[strings.ToLower(provider.Name)] {
+			problem(name, "duplicate provider %q", provider.Name)
+		}
+		names[strings.ToLower(provider.Name)] = true
+		if !isHTTPURL(provider.Issuer) {
+			problem(name, "issuer must be an http or https URL")
+		}
+		if provider.ClientID == "" {
+			problem(name, "client_id is required")
+		}
+	}
+
+	if c.Password.MinLength < 1 {
+		problem("password.min_length", "must be at least 1")
+	}
+	if c.Password.MinEntropy < 0 {
+		problem("password.min_entropy", "must not be negative")
+	}
+	if c.Password.BcryptCost < bcrypt.MinCost || c.Password.BcryptCost > bcrypt.MaxCost {
+		problem("password.bcrypt_cost", "must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if time.Duration(c.RateLimit.AuthInterval) <= 0 {
+		problem("rate_limit.auth_interval", "must be positive")
+	}
+	if c.RateLimit.AuthBurst < 1 {
+		problem("rate_limit.auth_burst", "must be at least 1")
+	}
+	for _, network := range c.WebhookAllowedNetworks {
+		if _, err := netip.ParsePrefix(network); err != nil {
+			problem("webhook_allowed_networks", "expected a network such as 10.0.0.0/8, got %q", network)
+		}
+	}
+	if time.Duration(c.Scheduler.TombstoneRetention) <= 0 {
+		problem("scheduler.tombstone_retention", "must be positive")
+	}
+
+	if _, _, err := c.Log.Levels(); err != nil {
+		problem("log", "%v, expected debug, info, warn or error", err)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
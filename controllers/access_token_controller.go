@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"task-manager/models"
+	"task-manager/services"
+	"task-manager/utils"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// AccessTokenController handles the authenticated user's personal access tokens.
+type AccessTokenController struct {
+	AccessTokenService *services.AccessTokenService
+}
+
+// CreateToken creates a personal access token.
+// It expects a JSON payload with a "name", a list of "scopes" and an optional
+// "expires_at" (RFC 3339). The token is only included in this response.
+func (ac *AccessTokenController) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	var input struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
+		return
+	}
+	token, secret, err := ac.AccessTokenService.CreateToken(userID, input.Name, input.Scopes, input.ExpiresAt)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusCreated, "success", "Access token created successfully", struct {
+		*models.PersonalAccessToken
+		Token string `json:"token"`
+	}{token, secret})
+}
+
+// GetTokens lists the user's personal access tokens without their secret values.
+func (ac *AccessTokenController) GetTokens(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Access tokens retrieved successfully", ac.AccessTokenService.GetTokens(userID))
+}
+
+// RevokeToken deletes a personal access token.
+func (ac *AccessTokenController) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid token ID", nil)
+		return
+	}
+	if err := ac.AccessTokenService.RevokeToken(userID, id); err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Access token not found", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Access token revoked successfully", nil)
+}
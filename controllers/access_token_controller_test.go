@@ -0,0 +1,97 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/middleware"
+	"task-manager/models"
+	"task-manager/routes"
+	"task-manager/services"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessTokenController(t *testing.T) {
+	userService := services.NewUserService()
+	ada, _ := userService.Register("ada@example.com", "plum orchard velvet")
+	accessTokenService := services.NewAccessTokenService(userService)
+	middleware.SetAccessTokenAuthenticator(accessTokenService.Authenticate)
+	t.Cleanup(func() { middleware.SetAccessTokenAuthenticator(nil) })
+	accessTokenController := &controllers.AccessTokenController{AccessTokenService: accessTokenService}
+
+	router := mux.NewRouter()
+	routes.RegisterTaskRoutes(router, &controllers.TaskController{TaskService: services.NewTaskService()})
+	routes.RegisterAccessTokenRoutes(router, accessTokenController)
+
+	create := func(body string) (int, string) {
+		req, _ := http.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		accessTokenController.CreateToken(rr, asUser(req, ada))
+		var response struct {
+			Data struct {
+				Token string `json:"token"`
+			} `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response.Data.Token
+	}
+	request := func(method, path, token, body string) int {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	code, readOnly := create(`{"name": "dashboard", "scopes": ["tasks:read"]}`)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.True(t, strings.HasPrefix(readOnly, models.PersonalAccessTokenPrefix))
+	_, readWrite := create(`{"name": "ci", "scopes": ["tasks:read", "tasks:write"]}`)
+
+	t.Run("ScopeEnforcement", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/tasks", readOnly, ""))
+		assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "/api/tasks", readOnly, `{"title": "Deploy", "description": "from CI"}`))
+		assert.Equal(t, http.StatusCreated, request(http.MethodPost, "/api/tasks", readWrite, `{"title": "Deploy", "description": "from CI"}`))
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/api/tasks", models.PersonalAccessTokenPrefix+"unknown", ""))
+	})
+
+	t.Run("NotAcceptedForTokenManagement", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "/api/tokens", readWrite, `{"name": "escalate", "scopes": ["tasks:write"]}`))
+	})
+
+	t.Run("ListShowsUsageButNotSecrets", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/tokens", nil)
+		rr := httptest.NewRecorder()
+		accessTokenController.GetTokens(rr, asUser(req, ada))
+
+		assert.NotContains(t, rr.Body.String(), readOnly)
+		var response struct {
+			Data []models.PersonalAccessToken `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		assert.Len(t, response.Data, 2)
+		assert.NotNil(t, response.Data[0].LastUsedAt)
+		assert.Equal(t, readOnly[len(readOnly)-4:], response.Data[0].Hint)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodDelete, "/api/tokens/1", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		rr := httptest.NewRecorder()
+		accessTokenController.RevokeToken(rr, asUser(req, ada))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/api/tasks", readOnly, ""))
+	})
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		code, _ := create(`{"name": "bad", "scopes": ["admin"]}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = create(`{"name": "expired", "scopes": ["tasks:read"], "expires_at": "2000-01-01T00:00:00Z"}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
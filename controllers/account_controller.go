@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"task-manager/services"
+	"task-manager/utils"
+)
+
+// AccountController handles email verification and password resets.
+type AccountController struct {
+	AccountService *services.AccountService
+	UserService    *services.UserService
+}
+
+// VerifyEmail verifies the email address a link was sent to. The token is
+// read from the "token" query parameter, so that the emailed link works as is,
+// or from a JSON payload.
+func (ac *AccountController) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" && r.Method == http.MethodPost {
+		var input struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		token = input.Token
+	}
+	if token == "" {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "token is required", nil)
+		return
+	}
+
+	user, err := ac.AccountService.VerifyEmail(token)
+	if errors.Is(err, services.ErrInvalidAccountToken) {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		return
+	}
+	if errors.Is(err, services.ErrEmailTaken) {
+		utils.SendJSONResponse(w, http.StatusConflict, "error", err.Error(), nil)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "could not verify email", "error", err)
+		utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not verify email", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Email verified successfully", user)
+}
+
+// ResendVerification sends the authenticated user a new verification link.
+func (ac *AccountController) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	user, err := ac.UserService.GetUserByID(userID)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", err.Error(), nil)
+		return
+	}
+	if user.EmailVerified {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Email is already verified", nil)
+		return
+	}
+	if err := ac.AccountService.SendVerification(r.Context(), user); err != nil {
+		logger.ErrorContext(r.Context(), "could not send verification email", "error", err)
+		utils.SendJSONResponse(w, http.StatusBadGateway, "error", "Could not send verification email", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Verification email sent", nil)
+}
+
+// ForgotPassword emails a password reset link. It expects a JSON payload with
+// an "email" field and responds the same way whether or not the account exists.
+func (ac *AccountController) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "email is required", nil)
+		return
+	}
+
+	ac.AccountService.ForgotPassword(r.Context(), input.Email)
+	utils.SendJSONResponse(w, http.StatusOK, "success", "If an account exists for this email, a password reset link has been sent", nil)
+}
+
+// ResetPassword sets a new password. It expects a JSON payload with the
+// "token" from the reset link and the new "password". All of the user's
+// sessions are ended.
+func (ac *AccountController) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" || input.Password == "" {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "token and password are required", nil)
+		return
+	}
+
+	if err := ac.AccountService.ResetPassword(input.Token, input.Password); err != nil {
+		sendBadRequest(w, err)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Password reset successfully", nil)
+}
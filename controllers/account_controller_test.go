@@ -0,0 +1,117 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/models"
+	"task-manager/services"
+	"task-manager/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var emailedToken = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+func TestAccountController(t *testing.T) {
+	userService := services.NewUserService()
+	tokenService := services.NewTokenService(userService)
+	sent := &recordingMailer{}
+	accountService := services.NewAccountService(userService, tokenService, sent, "http://api.example.com", "http://app.example.com")
+	accessTokenService := services.NewAccessTokenService(userService)
+	accountService.SetAccessTokenService(accessTokenService)
+	userController := &controllers.UserController{UserService: userService, TokenService: tokenService, AccountService: accountService}
+	accountController := &controllers.AccountController{AccountService: accountService, UserService: userService}
+
+	post := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/api", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	lastToken := func() string {
+		match := emailedToken.FindStringSubmatch(sent.sent[len(sent.sent)-1].Text)
+		if assert.Len(t, match, 2) {
+			return match[1]
+		}
+		return ""
+	}
+
+	rr := post(userController.Register, `{"email": "ada@example.com", "password": "plum orchard velvet"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var registered struct {
+		Data models.TokenPair `json:"data"`
+	}
+	json.NewDecoder(rr.Body).Decode(&registered)
+
+	t.Run("VerifyEmail", func(t *testing.T) {
+		assert.Len(t, sent.sent, 1)
+		assert.Equal(t, []string{"ada@example.com"}, sent.sent[0].To)
+		assert.Contains(t, sent.sent[0].Text, "http://api.example.com/api/email/verify?token=")
+		token := lastToken()
+
+		verify := func(token string) int {
+			req, _ := http.NewRequest(http.MethodGet, "/api/email/verify?token="+token, nil)
+			rr := httptest.NewRecorder()
+			accountController.VerifyEmail(rr, req)
+			return rr.Code
+		}
+		assert.Equal(t, http.StatusBadRequest, verify("nope"))
+		assert.Equal(t, http.StatusOK, verify(token))
+		// Tokens are single-use
+		assert.Equal(t, http.StatusBadRequest, verify(token))
+
+		user, _ := userService.GetUserByEmail("ada@example.com")
+		assert.True(t, user.EmailVerified)
+	})
+
+	t.Run("ResetPassword", func(t *testing.T) {
+		ada, _ := userService.GetUserByEmail("ada@example.com")
+		_, secret, err := accessTokenService.CreateToken(ada.ID, "cli", []string{models.ScopeTasksRead}, nil)
+		assert.NoError(t, err)
+
+		// Unknown addresses get the same response and no email
+		before := len(sent.sent)
+		rr := post(accountController.ForgotPassword, `{"email": "nobody@example.com"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		accountService.Wait()
+		assert.Len(t, sent.sent, before)
+
+		// Reset emails are sent in the background
+		post(accountController.ForgotPassword, `{"email": "ada@example.com"}`)
+		accountService.Wait()
+		stale := lastToken()
+		post(accountController.ForgotPassword, `{"email": "ada@example.com"}`)
+		accountService.Wait()
+		assert.Len(t, sent.sent, before+2)
+		assert.Contains(t, sent.sent[len(sent.sent)-1].Text, "http://app.example.com/reset-password?token=")
+		token := lastToken()
+
+		// Only the latest link works
+		rr = post(accountController.ResetPassword, `{"token": "`+stale+`", "password": "amber kettle horizon"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr = post(accountController.ResetPassword, `{"token": "`+token+`", "password": "amber kettle horizon"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = post(accountController.ResetPassword, `{"token": "`+token+`", "password": "quiet lantern meadow"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		_, err = userService.Authenticate("ada@example.com", "plum orchard velvet")
+		assert.Error(t, err)
+		_, err = userService.Authenticate("ada@example.com", "amber kettle horizon")
+		assert.NoError(t, err)
+
+		// Existing sessions are ended
+		_, err = tokenService.Refresh(registered.Data.RefreshToken)
+		assert.Error(t, err)
+		claims, err := utils.ValidateJWT(registered.Data.AccessToken)
+		assert.NoError(t, err)
+		assert.True(t, tokenService.IsRevoked(claims))
+		// and personal access tokens revoked
+		_, err = accessTokenService.Authenticate(secret)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"task-manager/middleware"
+	"task-manager/models"
+	"task-manager/services"
+	"task-manager/utils"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// AdminController lets administrators manage users. Every change is recorded
+// in the audit log.
+type AdminController struct {
+	UserService *services.UserService
+	// TokenService ends the sessions of disabled users and issues impersonation tokens.
+	TokenService *services.TokenService
+	// AccountService emails the reset link when a password reset is forced.
+	AccountService *services.AccountService
+	// AccessTokenService revokes the access tokens of users who must reset their password.
+	AccessTokenService *services.AccessTokenService
+	AuditService       *services.AuditService
+}
+
+// GetUsers lists users. The optional "q" query parameter searches email
+// addresses and display names; "role" and "disabled" filter the results.
+func (ac *AdminController) GetUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.UserFilter{Query: query.Get("q"), Role: query.Get("role")}
+	if value := query.Get("disabled"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			utils.SendJSONResponse(w, http.StatusBadRequest, "error", "disabled must be true or false", nil)
+			return
+		}
+		filter.Disabled = &disabled
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Users retrieved successfully", ac.UserService.SearchUsers(filter))
+}
+
+// GetUser retrieves a single user by ID.
+func (ac *AdminController) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := ac.targetUser(w, r)
+	if !ok {
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "User retrieved successfully", user)
+}
+
+// DisableUser stops the user from logging in and ends all of their sessions.
+func (ac *AdminController) DisableUser(w http.ResponseWriter, r *http.Request) {
+	ac.setDisabled(w, r, true)
+}
+
+// EnableUser lets a disabled user log in again.
+func (ac *AdminController) EnableUser(w http.ResponseWriter, r *http.Request) {
+	ac.setDisabled(w, r, false)
+}
+
+func (ac *AdminController) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	target, ok := ac.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if disabled && target.ID == currentUserID(r) {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Administrators cannot disable themselves", nil)
+		return
+	}
+
+	user, err := ac.UserService.SetDisabled(target.ID, disabled)
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+	action, message := models.AuditUserEnabled, "User enabled successfully"
+	if disabled {
+		action, message = models.AuditUserDisabled, "User disabled successfully"
+		if ac.TokenService != nil {
+			ac.TokenService.LogoutAll(user.ID)
+		}
+	}
+	ac.audit(r, action, user.ID, "")
+	utils.SendJSONResponse(w, http.StatusOK, "success", message, user)
+}
+
+// ForcePasswordReset stops the user from logging in with their current
+// password, ends all of their sessions, revokes their access tokens and
+// emails them a reset link. Calling
+// it again sends a new link.
+func (ac *AdminController) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	target, ok := ac.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := ac.UserService.RequirePasswordReset(target.ID)
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+	if ac.TokenService != nil {
+		ac.TokenService.LogoutAll(user.ID)
+	}
+	if ac.AccessTokenService != nil {
+		ac.AccessTokenService.RevokeAll(user.ID)
+	}
+	ac.audit(r, models.AuditPasswordResetForced, user.ID, "")
+	if ac.AccountService != nil {
+		if err := ac.AccountService.SendPasswordReset(r.Context(), user); err != nil {
+			logger.ErrorContext(r.Context(), "could not send password reset email", "target_user_id", user.ID, "error", err)
+			utils.SendJSONResponse(w, http.StatusBadGateway, "error", "Password reset required, but the reset email could not be sent", user)
+			return
+		}
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Password reset required", user)
+}
+
+// SetRole changes the user's role. It expects a JSON payload with a "role"
+// of "user" or "admin". The last administrator cannot be demoted.
+func (ac *AdminController) SetRole(w http.ResponseWriter, r *http.Request) {
+	target, ok := ac.targetUser(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Role == "" {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "role is required", nil)
+		return
+	}
+
+	user, err := ac.UserService.SetRole(target.ID, input.Role)
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+	if input.Role != target.Role {
+		ac.audit(r, models.AuditRoleChanged, user.ID, fmt.Sprintf("%s -> %s", target.Role, user.Role))
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Role changed successfully", user)
+}
+
+// Impersonate issues a token to act as the user, to see what they see. It
+// accepts an optional JSON payload with the token lifetime in "minutes",
+// 15 at most. The token cannot be used for admin endpoints or to change the
+// user's credentials, and every request made with it is audited.
+func (ac *AdminController) Impersonate(w http.ResponseWriter, r *http.Request) {
+	target, ok := ac.targetUser(w, r)
+	if !ok {
+		return
+	}
+	admin, err := ac.UserService.GetUserByID(currentUserID(r))
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	if target.ID == admin.ID {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Administrators cannot impersonate themselves", nil)
+		return
+	}
+	var input struct {
+		Minutes int `json:"minutes"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
+			return
+		}
+	}
+	maxMinutes := int(utils.AccessTokenTTL / time.Minute)
+	if input.Minutes == 0 {
+		input.Minutes = maxMinutes
+	}
+	if input.Minutes < 1 || input.Minutes > maxMinutes {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", fmt.Sprintf("minutes must be between 1 and %d", maxMinutes), nil)
+		return
+	}
+
+	token, err := ac.TokenService.Impersonate(admin, target, time.Duration(input.Minutes)*time.Minute, r.UserAgent(), middleware.ClientIP(r))
+	if errors.Is(err, services.ErrAccountDisabled) {
+		utils.SendJSONResponse(w, http.StatusConflict, "error", "Disabled users cannot be impersonated", nil)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "could not issue impersonation token", "target_user_id", target.ID, "error", err)
+		utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not generate token", nil)
+		return
+	}
+	logger.WarnContext(r.Context(), "impersonation started", "target_user_id", target.ID, "session_id", token.SessionID)
+	ac.audit(r, models.AuditImpersonationStarted, target.ID, fmt.Sprintf("session %s until %s", token.SessionID, token.ExpiresAt.Format(time.RFC3339)))
+	utils.SendJSONResponse(w, http.StatusCreated, "success", "Impersonation token issued", token)
+}
+
+// GetAuditLog lists audit entries, newest first. The optional "user_id" query
+// parameter limits them to entries involving that user.
+func (ac *AdminController) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	userID := 0
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid user ID", nil)
+			return
+		}
+		userID = id
+	}
+	entries := []models.AuditEntry{}
+	if ac.AuditService != nil {
+		entries = ac.AuditService.GetEntries(userID)
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Audit log retrieved successfully", entries)
+}
+
+// AuditImpersonatedRequest records a request made with an impersonation
+// token. It is used by middleware.JWTAuthMiddleware.
+func (ac *AdminController) AuditImpersonatedRequest(claims *utils.Claims, r *http.Request) {
+	if ac.AuditService == nil {
+		return
+	}
+	ac.AuditService.Record(models.AuditEntry{
+		Action:         models.AuditImpersonatedRequest,
+		ActorID:        claims.UserID,
+		ImpersonatorID: claims.ImpersonatorID,
+		Details:        r.Method + " " + r.URL.Path,
+		IP:             middleware.ClientIP(r),
+	})
+}
+
+// targetUser returns the user named by the "id" URL parameter, or responds
+// with an error and returns false.
+func (ac *AdminController) targetUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid user ID", nil)
+		return nil, false
+	}
+	user, err := ac.UserService.GetUserByID(id)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", err.Error(), nil)
+		return nil, false
+	}
+	return user, true
+}
+
+func (ac *AdminController) audit(r *http.Request, action string, targetID int, details string) {
+	if ac.AuditService == nil {
+		return
+	}
+	ac.AuditService.Record(models.AuditEntry{
+		Action:       action,
+		ActorID:      currentUserID(r),
+		TargetUserID: targetID,
+		Details:      details,
+		IP:           middleware.ClientIP(r),
+	})
+}
+
+// sendAdminError responds to a failed user change: 404 for a missing user,
+// 409 when it would leave no administrator and 400 otherwise.
+func sendAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", err.Error(), nil)
+	case errors.Is(err, services.ErrLastAdmin):
+		utils.SendJSONResponse(w, http.StatusConflict, "error", err.Error(), nil)
+	default:
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+	}
+}
@@ -0,0 +1,199 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/middleware"
+	"task-manager/models"
+	"task-manager/routes"
+	"task-manager/services"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminController(t *testing.T) {
+	userService := services.NewUserService()
+	userService.SetAdminEmails([]string{"Root@example.com"})
+	root, _ := userService.Register("root@example.com", "plum orchard velvet")
+	ada, _ := userService.Register("ada@example.com", "plum orchard velvet")
+	bob, _ := userService.Register("bob@example.com", "plum orchard velvet")
+	// Admin emails only count once verified, since anyone can sign up with them
+	assert.Equal(t, models.RoleUser, root.Role)
+	assert.NoError(t, userService.MarkEmailVerified(root.ID))
+	root, _ = userService.GetUserByID(root.ID)
+	assert.Equal(t, models.RoleAdmin, root.Role)
+	assert.Equal(t, models.RoleUser, ada.Role)
+
+	tokenService := services.NewTokenService(userService)
+	auditService := services.NewAuditService()
+	accessTokenService := services.NewAccessTokenService(userService)
+	sent := &recordingMailer{}
+	adminController := &controllers.AdminController{
+		UserService:        userService,
+		TokenService:       tokenService,
+		AccountService:     services.NewAccountService(userService, tokenService, sent, "http://localhost:8080", "http://localhost:8080"),
+		AccessTokenService: accessTokenService,
+		AuditService:       auditService,
+	}
+	middleware.SetRevocationCheck(tokenService.IsRevoked)
+	middleware.SetAdminCheck(userService.IsAdmin)
+	middleware.SetImpersonationAudit(adminController.AuditImpersonatedRequest)
+	t.Cleanup(func() {
+		middleware.SetRevocationCheck(nil)
+		middleware.SetAdminCheck(nil)
+		middleware.SetImpersonationAudit(nil)
+	})
+	userController := &controllers.UserController{UserService: userService, TokenService: tokenService}
+	profileController := &controllers.ProfileController{UserService: userService, TokenService: tokenService}
+
+	router := mux.NewRouter()
+	routes.RegisterAuthRoutes(router, userController)
+	routes.RegisterProfileRoutes(router, profileController)
+	routes.RegisterUserAdminRoutes(router, adminController)
+	routes.RegisterWebhookRoutes(router, &controllers.WebhookController{WebhookService: services.NewWebhookService(nil)})
+	routes.RegisterAccessTokenRoutes(router, &controllers.AccessTokenController{AccessTokenService: accessTokenService})
+	routes.RegisterSessionRoutes(router, &controllers.SessionController{TokenService: tokenService})
+
+	call := func(method, path, token, body string, data interface{}) int {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if data != nil {
+			json.NewDecoder(rr.Body).Decode(&struct {
+				Data interface{} `json:"data"`
+			}{data})
+		}
+		return rr.Code
+	}
+	login := func(email string) (int, string) {
+		var tokens models.TokenPair
+		code := call(http.MethodPost, "/api/login", "", `{"email": "`+email+`", "password": "plum orchard velvet"}`, &tokens)
+		return code, tokens.AccessToken
+	}
+	userPath := func(user *models.User, action string) string {
+		return "/api/admin/users/" + strconv.Itoa(user.ID) + action
+	}
+	_, rootToken := login("root@example.com")
+	_, adaToken := login("ada@example.com")
+
+	t.Run("AdminsOnly", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, call(http.MethodGet, "/api/admin/users", adaToken, "", nil))
+		var users []models.User
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/admin/users?q=ADA", rootToken, "", &users))
+		assert.Len(t, users, 1)
+		assert.Equal(t, ada.ID, users[0].ID)
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/admin/users?role=admin", rootToken, "", &users))
+		assert.Len(t, users, 1)
+		assert.Equal(t, root.ID, users[0].ID)
+	})
+
+	t.Run("DisableAndEnable", func(t *testing.T) {
+		_, bobToken := login("bob@example.com")
+		assert.Equal(t, http.StatusOK, call(http.MethodPost, userPath(bob, "/disable"), rootToken, "", nil))
+		assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/api/me", bobToken, "", nil))
+		code, _ := login("bob@example.com")
+		assert.Equal(t, http.StatusForbidden, code)
+
+		var users []models.User
+		call(http.MethodGet, "/api/admin/users?disabled=true", rootToken, "", &users)
+		assert.Len(t, users, 1)
+
+		assert.Equal(t, http.StatusOK, call(http.MethodPost, userPath(bob, "/enable"), rootToken, "", nil))
+		code, _ = login("bob@example.com")
+		assert.Equal(t, http.StatusOK, code)
+
+		// Administrators cannot lock themselves out
+		assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, userPath(root, "/disable"), rootToken, "", nil))
+	})
+
+	t.Run("ForcePasswordReset", func(t *testing.T) {
+		_, _, err := accessTokenService.CreateToken(bob.ID, "ci", []string{models.ScopeTasksRead}, nil)
+		assert.NoError(t, err)
+		assert.Len(t, accessTokenService.GetTokens(bob.ID), 1)
+		assert.Equal(t, http.StatusOK, call(http.MethodPost, userPath(bob, "/password-reset"), rootToken, "", nil))
+		assert.Empty(t, accessTokenService.GetTokens(bob.ID))
+		code, _ := login("bob@example.com")
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Len(t, sent.sent, 1)
+		assert.Equal(t, []string{"bob@example.com"}, sent.sent[0].To)
+
+		assert.NoError(t, userService.SetPassword(bob.ID, "correct horse battery"))
+		code = call(http.MethodPost, "/api/login", "", `{"email": "bob@example.com", "password": "correct horse battery"}`, nil)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("Roles", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, call(http.MethodPut, userPath(root, "/role"), rootToken, `{"role": "user"}`, nil))
+		assert.Equal(t, http.StatusBadRequest, call(http.MethodPut, userPath(ada, "/role"), rootToken, `{"role": "owner"}`, nil))
+		assert.Equal(t, http.StatusOK, call(http.MethodPut, userPath(ada, "/role"), rootToken, `{"role": "admin"}`, nil))
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/admin/users", adaToken, "", nil))
+		assert.Equal(t, http.StatusOK, call(http.MethodPut, userPath(ada, "/role"), rootToken, `{"role": "user"}`, nil))
+		assert.Equal(t, http.StatusForbidden, call(http.MethodGet, "/api/admin/users", adaToken, "", nil))
+	})
+
+	t.Run("Impersonation", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, userPath(ada, "/impersonate"), rootToken, `{"minutes": 60}`, nil))
+		var token models.ImpersonationToken
+		assert.Equal(t, http.StatusCreated, call(http.MethodPost, userPath(ada, "/impersonate"), rootToken, `{"minutes": 5}`, &token))
+		assert.Equal(t, root.ID, token.ImpersonatorID)
+
+		var profile models.User
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/me", token.AccessToken, "", &profile))
+		assert.Equal(t, ada.ID, profile.ID)
+		// Impersonators can neither change credentials nor see or touch webhooks
+		refused := []struct{ method, path, body string }{
+			{http.MethodPatch, "/api/me", `{"display_name": "Mallory"}`},
+			{http.MethodDelete, "/api/me", `{"password": "plum orchard velvet"}`},
+			{http.MethodPost, "/api/me/password", `{"new_password": "correct horse battery"}`},
+			{http.MethodPost, "/api/me/email", `{"email": "mallory@example.com"}`},
+			{http.MethodDelete, "/api/me/sessions/0123abcd", ""},
+			{http.MethodPost, "/api/tokens", `{"name": "backdoor", "scopes": ["tasks:read"]}`},
+			{http.MethodDelete, "/api/tokens/1", ""},
+			{http.MethodPost, "/api/webhooks", `{"url": "https://example.com/hook", "events": ["task.created"]}`},
+			{http.MethodGet, "/api/webhooks", ""},
+			{http.MethodGet, "/api/webhooks/1", ""},
+			{http.MethodPut, "/api/webhooks/1", `{"url": "https://example.com/hook"}`},
+			{http.MethodDelete, "/api/webhooks/1", ""},
+			{http.MethodGet, "/api/webhooks/1/deliveries", ""},
+			{http.MethodPost, "/api/webhooks/1/deliveries/1/redeliver", ""},
+			{http.MethodGet, "/api/admin/users", ""},
+		}
+		for _, request := range refused {
+			assert.Equal(t, http.StatusForbidden, call(request.method, request.path, token.AccessToken, request.body, nil), request.method+" "+request.path)
+		}
+
+		// Ada sees the session, and ending her sessions ends it too
+		sessions := tokenService.GetSessions(ada.ID)
+		assert.Len(t, sessions, 2)
+		tokenService.LogoutAll(ada.ID)
+		assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/api/me", token.AccessToken, "", nil))
+
+		var entries []models.AuditEntry
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/admin/audit?user_id="+strconv.Itoa(ada.ID), rootToken, "", &entries))
+		actions := []string{}
+		for _, entry := range entries {
+			actions = append(actions, entry.Action)
+		}
+		expected := []string{}
+		for range refused {
+			expected = append(expected, models.AuditImpersonatedRequest)
+		}
+		expected = append(expected,
+			models.AuditImpersonatedRequest, // GET /api/me
+			models.AuditImpersonationStarted,
+			models.AuditRoleChanged,
+			models.AuditRoleChanged,
+		)
+		assert.Equal(t, expected, actions)
+		assert.Equal(t, root.ID, entries[len(refused)].ImpersonatorID)
+		assert.Equal(t, ada.ID, entries[len(refused)].ActorID)
+		assert.Equal(t, "GET /api/me", entries[len(refused)].Details)
+	})
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"task-manager/models"
+	"task-manager/services"
+	"task-manager/utils"
+)
+
+// EmailController handles email preferences and unsubscribe links.
+type EmailController struct {
+	EmailService *services.EmailService
+}
+
+// GetPreferences returns the authenticated user's email preferences.
+func (ec *EmailController) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Preferences retrieved successfully", ec.EmailService.GetPreferences(userID))
+}
+
+// UpdatePreferences replaces the authenticated user's email preferences.
+// It expects a JSON payload with "task_updates", "digest", "digest_hour" and "timezone" fields.
+func (ec *EmailController) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	var input models.EmailPreferences
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
+		return
+	}
+	if err := ec.EmailService.UpdatePreferences(userID, input); err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Preferences updated successfully", ec.EmailService.GetPreferences(userID))
+}
+
+// unsubscribePage is shown when an unsubscribe link is opened in a browser.
+// Opening the link only asks for confirmation, so that link scanners and
+// prefetching cannot unsubscribe anyone; the form posts back to the same URL.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+{{if .Done}}<p>{{.Message}}</p>{{else}}<form method="post">
+<p>Stop receiving task update emails and digests?</p>
+<button type="submit">Unsubscribe</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+// ConfirmUnsubscribe shows a page asking to confirm the unsubscription
+// requested by an unsubscribe link.
+func (ec *EmailController) ConfirmUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	renderUnsubscribePage(w, http.StatusOK, false, "")
+}
+
+// Unsubscribe turns off all emails for the user identified by the signed "token" query parameter.
+// It answers POST only, as RFC 8058 one-click unsubscription does, and does not
+// require authentication so that it works straight from an email client.
+// Browsers submitting the confirmation page get a page back instead of JSON.
+func (ec *EmailController) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	html := strings.Contains(r.Header.Get("Accept"), "text/html")
+	if err := ec.EmailService.Unsubscribe(r.URL.Query().Get("token")); err != nil {
+		if html {
+			renderUnsubscribePage(w, http.StatusBadRequest, true, "This unsubscribe link is invalid.")
+			return
+		}
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid unsubscribe link", nil)
+		return
+	}
+	if html {
+		renderUnsubscribePage(w, http.StatusOK, true, "You have been unsubscribed from all emails.")
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "You have been unsubscribed from all emails", nil)
+}
+
+func renderUnsubscribePage(w http.ResponseWriter, code int, done bool, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	unsubscribePage.Execute(w, struct {
+		Done    bool
+		Message string
+	}{done, message})
+}
@@ -0,0 +1,82 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/mailer"
+	"task-manager/models"
+	"task-manager/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingMailer keeps every message instead of sending it.
+type recordingMailer struct {
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestEmailController_Unsubscribe(t *testing.T) {
+	userService := services.NewUserService()
+	ada, _ := userService.Register("ada@example.com", "plum orchard velvet")
+	bob, _ := userService.Register("bob@example.com", "plum orchard velvet")
+
+	taskService := services.NewTaskService()
+	sent := &recordingMailer{}
+	emailService := services.NewEmailService(sent, userService, taskService, "http://localhost:8080", []byte("secret"))
+	taskService.Subscribe(emailService.HandleTaskEvent)
+	emailController := &controllers.EmailController{EmailService: emailService}
+
+	// Several changes by Ada to Bob's task are batched into a single email
+	taskService.CreateTask(models.Task{Title: "Ship it", Description: "soon", CreatorID: ada.ID, AssigneeID: bob.ID})
+	taskService.UpdateTask(ada.ID, 1, "Ship it", "now", "IN_PROGRESS")
+	taskService.MarkTaskAsComplete(ada.ID, 1)
+	assert.NoError(t, emailService.FlushPending(context.Background()))
+	assert.Len(t, sent.sent, 1)
+	assert.Equal(t, []string{"bob@example.com"}, sent.sent[0].To)
+	assert.Equal(t, "4 updates to your tasks", sent.sent[0].Subject)
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/api/email/unsubscribe?token=forged", nil)
+		rr := httptest.NewRecorder()
+		emailController.Unsubscribe(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("OpeningLinkOnlyAsksForConfirmation", func(t *testing.T) {
+		link, _ := url.Parse(emailService.UnsubscribeURL(bob.ID))
+		req, _ := http.NewRequest(http.MethodGet, link.RequestURI(), nil)
+		rr := httptest.NewRecorder()
+		emailController.ConfirmUnsubscribe(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `<form method="post">`)
+		assert.True(t, emailService.GetPreferences(bob.ID).TaskUpdates)
+	})
+
+	t.Run("ValidToken", func(t *testing.T) {
+		link, _ := url.Parse(emailService.UnsubscribeURL(bob.ID))
+		req, _ := http.NewRequest(http.MethodPost, link.RequestURI(), strings.NewReader("List-Unsubscribe=One-Click"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		emailController.Unsubscribe(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		prefs := emailService.GetPreferences(bob.ID)
+		assert.False(t, prefs.TaskUpdates)
+		assert.False(t, prefs.Digest)
+
+		taskService.AssignTask(ada.ID, 1, 0)
+		taskService.AssignTask(ada.ID, 1, bob.ID)
+		assert.NoError(t, emailService.FlushPending(context.Background()))
+		assert.Len(t, sent.sent, 1)
+	})
+}
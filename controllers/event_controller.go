@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"task-manager/models"
+	"task-manager/services"
+	"task-manager/utils"
+	"time"
+)
+
+// heartbeatInterval is how often a comment is sent on idle event streams so
+// that proxies and clients do not time out the connection.
+const heartbeatInterval = 15 * time.Second
+
+// streamedEvents are the task events pushed to event stream clients.
+var streamedEvents = map[models.TaskEventType]bool{
+	models.TaskCreated:   true,
+	models.TaskUpdated:   true,
+	models.TaskCompleted: true,
+	models.TaskDeleted:   true,
+}
+
+// EventController streams task events to clients using Server-Sent Events.
+type EventController struct {
+	TaskService *services.TaskService
+	// Heartbeat overrides heartbeatInterval when set.
+	Heartbeat time.Duration
+	// Done ends every stream when closed, so that the server can shut down
+	// without waiting for clients to disconnect. Clients then reconnect to
+	// another instance with Last-Event-ID.
+	Done <-chan struct{}
+}
+
+// StreamEvents pushes task created/updated/completed/deleted events as they happen.
+// Clients resume after a reconnect by sending the Last-Event-ID header (or the
+// "last_event_id" query parameter); if the missed events are no longer buffered,
+// a "reset" event tells the client to reload its tasks.
+// Every authenticated user can see every task (see GetTasks), so events are not filtered per user.
+func (ec *EventController) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Streaming not supported", nil)
+		return
+	}
+
+	lastEventIDStr := r.Header.Get("Last-Event-ID")
+	if lastEventIDStr == "" {
+		lastEventIDStr = r.URL.Query().Get("last_event_id")
+	}
+	var lastEventID int64
+	if lastEventIDStr != "" {
+		id, err := strconv.ParseInt(lastEventIDStr, 10, 64)
+		if err != nil || id < 0 {
+			utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid Last-Event-ID", nil)
+			return
+		}
+		lastEventID = id
+	}
+
+	replay, events, cancel, err := ec.TaskService.Events().Stream(lastEventID)
+	reset := err != nil
+	if reset {
+		replay, events, cancel, _ = ec.TaskService.Events().Stream(0)
+	}
+	defer cancel()
+
+	// Streams outlive the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if reset {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range replay {
+		writeEvent(w, event)
+	}
+	flusher.Flush()
+
+	interval := ec.Heartbeat
+	if interval <= 0 {
+		interval = heartbeatInterval
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ec.Done:
+			return
+		case event, ok := <-events:
+			if !ok {
+				// The client fell too far behind; it will reconnect with Last-Event-ID.
+				return
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event models.TaskEvent) {
+	if !streamedEvents[event.Type] {
+		return
+	}
+	data, err := json.Marshal(map[string]interface{}{"task": event.Task, "actor_id": event.ActorID, "time": event.Time})
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
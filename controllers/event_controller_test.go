@@ -0,0 +1,111 @@
+package controllers_test
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/models"
+	"task-manager/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readSSE reads lines from an event stream until n events have been received.
+func readSSE(t *testing.T, reader *bufio.Reader, n int) []string {
+	var lines []string
+	for events := 0; events < n; {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			events++
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestEventController_StreamEvents(t *testing.T) {
+	taskService := services.NewTaskService()
+	eventController := &controllers.EventController{TaskService: taskService, Heartbeat: 50 * time.Millisecond}
+	server := httptest.NewServer(http.HandlerFunc(eventController.StreamEvents))
+	defer server.Close()
+
+	t.Run("LiveEvents", func(t *testing.T) {
+		resp, err := http.Get(server.URL)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		taskService.CreateTask(models.Task{Title: "Ship it", Description: "soon"})
+		lines := readSSE(t, bufio.NewReader(resp.Body), 1)
+		assert.Equal(t, "id: 1", lines[0])
+		assert.Equal(t, "event: task.created", lines[1])
+		assert.Contains(t, lines[2], `"title":"Ship it"`)
+	})
+
+	t.Run("Heartbeat", func(t *testing.T) {
+		resp, err := http.Get(server.URL)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, []string{": keepalive"}, readSSE(t, bufio.NewReader(resp.Body), 1))
+	})
+
+	t.Run("ResumeWithLastEventID", func(t *testing.T) {
+		taskService.MarkTaskAsComplete(0, 1)
+		taskService.DeleteTask(0, 1)
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Last-Event-ID", "1")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		lines := readSSE(t, bufio.NewReader(resp.Body), 2)
+		assert.Equal(t, "event: task.completed", lines[1])
+		assert.Equal(t, "event: task.deleted", lines[4])
+	})
+
+	t.Run("ResetWhenEventsAreGone", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Last-Event-ID", "999")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		lines := readSSE(t, bufio.NewReader(resp.Body), 1)
+		assert.Equal(t, "event: reset", lines[0])
+	})
+}
+
+func TestEventController_StreamEndsOnShutdown(t *testing.T) {
+	done := make(chan struct{})
+	eventController := &controllers.EventController{TaskService: services.NewTaskService(), Done: done}
+	server := httptest.NewServer(http.HandlerFunc(eventController.StreamEvents))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	close(done)
+	ended := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(resp.Body)
+		ended <- err
+	}()
+	select {
+	case err := <-ended:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream still open after shutdown")
+	}
+}
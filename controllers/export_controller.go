@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"task-manager/middleware"
+	"task-manager/services"
+	"task-manager/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// ExportController handles personal data exports.
+type ExportController struct {
+	ExportService *services.ExportService
+}
+
+// RequestExport starts building an archive of the user's data. It responds
+// with 202 Accepted; the export gets a download link once it is ready.
+func (ec *ExportController) RequestExport(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	if wait, err := ec.ExportService.CheckRate(userID); err != nil {
+		middleware.TooManyRequests(w, wait)
+		return
+	}
+	export, err := ec.ExportService.RequestExport(userID)
+	if errors.Is(err, services.ErrExportInProgress) {
+		utils.SendJSONResponse(w, http.StatusConflict, "error", err.Error(), nil)
+		return
+	}
+	if errors.Is(err, services.ErrTooManyExports) {
+		utils.SendJSONResponse(w, http.StatusServiceUnavailable, "error", err.Error(), nil)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "could not start export", "error", err)
+		utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not start export", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusAccepted, "success", "Export started", export)
+}
+
+// GetExports lists the user's exports.
+func (ec *ExportController) GetExports(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Exports retrieved successfully", ec.ExportService.GetExports(userID))
+}
+
+// GetExport returns the status of one of the user's exports.
+func (ec *ExportController) GetExport(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid export ID", nil)
+		return
+	}
+	export, err := ec.ExportService.GetExport(userID, id)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Export retrieved successfully", export)
+}
+
+// Download serves an export archive. The signed "token" query parameter of
+// the download link authorizes the request, so the link works without logging in.
+func (ec *ExportController) Download(w http.ResponseWriter, r *http.Request) {
+	archive, name, err := ec.ExportService.Download(r.URL.Query().Get("token"))
+	switch {
+	case errors.Is(err, services.ErrExportLinkExpired):
+		utils.SendJSONResponse(w, http.StatusGone, "error", err.Error(), nil)
+		return
+	case errors.Is(err, services.ErrExportNotReady):
+		utils.SendJSONResponse(w, http.StatusConflict, "error", err.Error(), nil)
+		return
+	case err != nil:
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", err.Error(), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(archive)
+}
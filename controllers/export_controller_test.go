@@ -0,0 +1,118 @@
+package controllers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/models"
+	"task-manager/services"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportController(t *testing.T) {
+	userService := services.NewUserService()
+	ada, _ := userService.Register("ada@example.com", "plum orchard velvet")
+	bob, _ := userService.Register("bob@example.com", "plum orchard velvet")
+	taskService := services.NewTaskService()
+	taskService.CreateTask(models.Task{Title: "Write notes", CreatorID: ada.ID})
+	taskService.CreateTask(models.Task{Title: "Review notes", CreatorID: bob.ID, AssigneeID: ada.ID})
+	taskService.CreateTask(models.Task{Title: "Bob's own", CreatorID: bob.ID})
+	tokenService := services.NewTokenService(userService)
+	tokenService.IssueTokens(ada, "test", "192.0.2.1")
+	exportService := services.NewExportService(userService, taskService, "http://localhost:8080", []byte("export signing key"))
+	exportService.AddSection("sessions.json", func(userID int) (interface{}, error) {
+		return tokenService.GetSessions(userID), nil
+	})
+	exportController := &controllers.ExportController{ExportService: exportService}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/me/exports/{id:[0-9]+}", exportController.GetExport)
+	router.HandleFunc("/api/exports/download", exportController.Download)
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/me/export", nil)
+	rr := httptest.NewRecorder()
+	exportController.RequestExport(rr, asUser(req, ada))
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	var started struct {
+		Data models.DataExport `json:"data"`
+	}
+	json.NewDecoder(rr.Body).Decode(&started)
+	exportService.Wait()
+
+	getExport := func(user *models.User) (int, models.DataExport) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/me/exports/"+strconv.Itoa(started.Data.ID), nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, asUser(req, user))
+		var response struct {
+			Data models.DataExport `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response.Data
+	}
+	code, _ := getExport(bob)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, export := getExport(ada)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, models.ExportReady, export.Status)
+	assert.NotNil(t, export.ExpiresAt)
+	assert.True(t, strings.HasPrefix(export.DownloadURL, "http://localhost:8080/api/exports/download?token="))
+
+	// The link works without logging in
+	req, _ = http.NewRequest(http.MethodGet, strings.TrimPrefix(export.DownloadURL, "http://localhost:8080"), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+
+	archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	assert.NoError(t, err)
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		f, _ := file.Open()
+		files[file.Name], _ = io.ReadAll(f)
+		f.Close()
+	}
+	assert.Len(t, files, 3)
+	var profile models.User
+	assert.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+	assert.Equal(t, "ada@example.com", profile.Email)
+	assert.NotContains(t, string(files["profile.json"]), "password")
+	var tasks []models.Task
+	assert.NoError(t, json.Unmarshal(files["tasks.json"], &tasks))
+	assert.Len(t, tasks, 2)
+	var sessions []models.Session
+	assert.NoError(t, json.Unmarshal(files["sessions.json"], &sessions))
+	assert.Len(t, sessions, 1)
+
+	// Tampered links are rejected
+	req, _ = http.NewRequest(http.MethodGet, "/api/exports/download?token=x"+strings.SplitN(export.DownloadURL, "token=", 2)[1], nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Links are signed with the configured key, so they verify after a restart
+	restarted := services.NewExportService(userService, taskService, "http://localhost:8080", []byte("export signing key"))
+	_, _, err = restarted.Download(strings.SplitN(export.DownloadURL, "token=", 2)[1])
+	assert.ErrorIs(t, err, services.ErrExportLinkExpired)
+
+	// Requests are rate limited
+	req, _ = http.NewRequest(http.MethodPost, "/api/me/export", nil)
+	rr = httptest.NewRecorder()
+	exportController.RequestExport(rr, asUser(req, ada))
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	exportService.Wait()
+	req, _ = http.NewRequest(http.MethodPost, "/api/me/export", nil)
+	rr = httptest.NewRecorder()
+	exportController.RequestExport(rr, asUser(req, ada))
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+	"task-manager/models"
+	"task-manager/services"
+	"task-manager/utils"
+)
+
+// HealthController answers the probes of orchestrators and load balancers.
+// Its routes need no authentication.
+type HealthController struct {
+	HealthService *services.HealthService
+	BuildInfo     models.BuildInfo
+}
+
+// Live reports that the process is up and serving requests.
+func (hc *HealthController) Live(w http.ResponseWriter, r *http.Request) {
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Alive", nil)
+}
+
+// Ready runs the readiness checks. It responds 503 Service Unavailable, with
+// whether every check passed, when any of them fails. Since the route is
+// public, why a check failed is only logged.
+func (hc *HealthController) Ready(w http.ResponseWriter, r *http.Request) {
+	report := hc.HealthService.Check(r.Context())
+	for i, check := range report.Checks {
+		if check.Status != models.HealthOK {
+			logger.WarnContext(r.Context(), "readiness check failed", "check", check.Name, "error", check.Error, "duration", check.Duration)
+		}
+		report.Checks[i] = models.HealthCheckResult{Name: check.Name, Status: check.Status}
+	}
+	if report.Status != models.HealthOK {
+		utils.SendJSONResponse(w, http.StatusServiceUnavailable, "error", "Not ready", report)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Ready", report)
+}
+
+// Version returns the build metadata of the running binary.
+func (hc *HealthController) Version(w http.ResponseWriter, r *http.Request) {
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Version retrieved successfully", hc.BuildInfo)
+}
@@ -0,0 +1,65 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"task-manager/controllers"
+	"task-manager/models"
+	"task-manager/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthController_Ready(t *testing.T) {
+	healthService := services.NewHealthService()
+	storeErr := error(nil)
+	healthService.AddCheck("scheduler", func(context.Context) error { return nil })
+	healthService.AddCheck("scheduler_store", func(context.Context) error { return storeErr })
+	healthController := &controllers.HealthController{HealthService: healthService, BuildInfo: models.BuildInfo{Version: "1.4.0", Commit: "abc123"}}
+
+	ready := func() (int, models.HealthReport) {
+		req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+		rr := httptest.NewRecorder()
+		healthController.Ready(rr, req)
+		var response struct {
+			Data models.HealthReport `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response.Data
+	}
+
+	t.Run("Ready", func(t *testing.T) {
+		code, report := ready()
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, models.HealthOK, report.Status)
+		assert.Len(t, report.Checks, 2)
+	})
+
+	t.Run("FailingCheck", func(t *testing.T) {
+		storeErr = errors.New("state file unreadable")
+		defer func() { storeErr = nil }()
+
+		code, report := ready()
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, models.HealthFailing, report.Status)
+		assert.Equal(t, "scheduler", report.Checks[0].Name)
+		assert.Equal(t, models.HealthOK, report.Checks[0].Status)
+		assert.Equal(t, models.HealthFailing, report.Checks[1].Status)
+		// The reason is logged, not served to anyone who asks
+		assert.Empty(t, report.Checks[1].Error)
+		assert.Empty(t, report.Checks[1].Duration)
+	})
+
+	t.Run("Version", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/version", nil)
+		rr := httptest.NewRecorder()
+		healthController.Version(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"version":"1.4.0"`)
+		assert.Contains(t, rr.Body.String(), `"commit":"abc123"`)
+	})
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"task-manager/logging"
+	"task-manager/middleware"
+	"task-manager/services"
+	"task-manager/utils"
+)
+
+var logger = logging.For("controllers")
+
+// currentUserID returns the ID of the authenticated user, or 0 if the request
+// did not pass through JWTAuthMiddleware.
+func currentUserID(r *http.Request) int {
+	if claims, ok := middleware.GetClaims(r); ok {
+		return claims.UserID
+	}
+	return 0
+}
+
+// sendBadRequest responds with 400 and the error message. Password policy
+// violations also list each problem under "problems".
+func sendBadRequest(w http.ResponseWriter, err error) {
+	var policyErr *services.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), map[string][]string{"problems": policyErr.Problems})
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+}
+
+// sendTokenError responds to a failure to issue tokens: 403 for disabled
+// accounts and 500 otherwise.
+func sendTokenError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, services.ErrAccountDisabled) {
+		utils.SendJSONResponse(w, http.StatusForbidden, "error", err.Error(), nil)
+		return
+	}
+	logger.ErrorContext(r.Context(), "could not issue tokens", "error", err)
+	utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not generate token", nil)
+}
+
+// sendTaskError responds to a failure to change a task: 404 for unknown
+// tasks and 500 otherwise, such as when its recurrence rule cannot be evaluated.
+func sendTaskError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, services.ErrTaskNotFound) {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Task not found", nil)
+		return
+	}
+	logger.ErrorContext(r.Context(), "could not update task", "error", err)
+	utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not update task", nil)
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"task-manager/scheduler"
+	"task-manager/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// JobController exposes the state of background jobs to administrators.
+type JobController struct {
+	Scheduler *scheduler.Scheduler
+}
+
+// GetJobs lists all scheduled jobs with their last run, next run and failure state.
+func (jc *JobController) GetJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := jc.Scheduler.Jobs()
+	if err != nil {
+		logger.ErrorContext(r.Context(), "could not load jobs", "error", err)
+		utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not load jobs", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Jobs retrieved successfully", jobs)
+}
+
+// GetJob retrieves a single job by name.
+// It expects the job name as a URL parameter.
+func (jc *JobController) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := jc.Scheduler.Job(mux.Vars(r)["name"])
+	if errors.Is(err, scheduler.ErrJobNotFound) {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Job not found", nil)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "could not load job", "job", mux.Vars(r)["name"], "error", err)
+		utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not load job", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Job retrieved successfully", job)
+}
@@ -0,0 +1,73 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"task-manager/controllers"
+	"task-manager/scheduler"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobController_GetJob(t *testing.T) {
+	// The clock only moves when the test moves it, so the failed job is not
+	// retried before the scheduler is stopped.
+	var clockMutex sync.Mutex
+	now := time.Now()
+	clock := func() time.Time {
+		clockMutex.Lock()
+		defer clockMutex.Unlock()
+		return now
+	}
+	jobs := scheduler.New(scheduler.NewMemoryStore(), scheduler.Options{TickInterval: time.Millisecond, Now: clock})
+	ran := make(chan struct{}, 1)
+	jobs.Register("always-fails", time.Hour, func(ctx context.Context) error {
+		ran <- struct{}{}
+		return errors.New("boom")
+	})
+	jobController := &controllers.JobController{Scheduler: jobs}
+
+	// Let the job run and fail once; Stop waits for the run to be recorded
+	clockMutex.Lock()
+	now = now.Add(time.Hour)
+	clockMutex.Unlock()
+	jobs.Start(context.Background())
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not run")
+	}
+	jobs.Stop(context.Background())
+
+	t.Run("ValidRequest", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/admin/jobs/always-fails", nil)
+		req = mux.SetURLVars(req, map[string]string{"name": "always-fails"})
+		rr := httptest.NewRecorder()
+		jobController.GetJob(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response struct {
+			Data scheduler.Job `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		assert.Equal(t, "boom", response.Data.LastError)
+		assert.Equal(t, 1, response.Data.Failures)
+		assert.Empty(t, response.Data.LockedBy)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/admin/jobs/missing", nil)
+		req = mux.SetURLVars(req, map[string]string{"name": "missing"})
+		rr := httptest.NewRecorder()
+		jobController.GetJob(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
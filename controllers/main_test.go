@@ -0,0 +1,14 @@
+package controllers_test
+
+import (
+	"io"
+	"os"
+	"task-manager/logging"
+	"testing"
+)
+
+// TestMain keeps the log lines written while serving requests out of the test output.
+func TestMain(m *testing.M) {
+	logging.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
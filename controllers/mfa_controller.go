@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"task-manager/services"
+	"task-manager/utils"
+)
+
+// MFAController handles two-factor authentication settings.
+type MFAController struct {
+	MFAService *services.MFAService
+}
+
+type mfaCodeInput struct {
+	Code string `json:"code"`
+}
+
+// GetStatus reports whether the user has two-factor authentication enabled and whether it is required.
+func (mc *MFAController) GetStatus(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Two-factor status retrieved successfully", map[string]bool{
+		"enabled":  mc.MFAService.Enabled(userID),
+		"required": mc.MFAService.Required(),
+	})
+}
+
+// Enroll starts enrollment and returns the secret to add to an authenticator app.
+func (mc *MFAController) Enroll(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	enrollment, err := mc.MFAService.StartEnrollment(userID)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Enrollment started", enrollment)
+}
+
+// ConfirmEnrollment enables two-factor authentication.
+// It expects a JSON payload with a "code" from the authenticator app and
+// returns the recovery codes, which are not shown again.
+func (mc *MFAController) ConfirmEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID, input, ok := mfaRequest(w, r)
+	if !ok {
+		return
+	}
+	codes, err := mc.MFAService.ConfirmEnrollment(userID, input.Code)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Two-factor authentication enabled", map[string][]string{"recovery_codes": codes})
+}
+
+// Disable turns off two-factor authentication. It expects a JSON payload with a current "code".
+func (mc *MFAController) Disable(w http.ResponseWriter, r *http.Request) {
+	userID, input, ok := mfaRequest(w, r)
+	if !ok {
+		return
+	}
+	err := mc.MFAService.Disable(userID, input.Code)
+	if errors.Is(err, services.ErrMFARequiredByAdmin) {
+		utils.SendJSONResponse(w, http.StatusForbidden, "error", err.Error(), nil)
+		return
+	}
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Two-factor authentication disabled", nil)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes. It expects a JSON payload with a current "code".
+func (mc *MFAController) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, input, ok := mfaRequest(w, r)
+	if !ok {
+		return
+	}
+	codes, err := mc.MFAService.RegenerateRecoveryCodes(userID, input.Code)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Recovery codes regenerated", map[string][]string{"recovery_codes": codes})
+}
+
+// SetRequirement makes two-factor authentication mandatory for every user, or optional again.
+// It expects a JSON payload with a boolean "required" field.
+func (mc *MFAController) SetRequirement(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Required *bool `json:"required"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Required == nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "required must be true or false", nil)
+		return
+	}
+	mc.MFAService.SetRequired(*input.Required)
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Two-factor requirement updated", map[string]bool{"required": *input.Required})
+}
+
+// mfaRequest extracts the authenticated user and the code of a request.
+// It writes an error response and returns false if either is missing.
+func mfaRequest(w http.ResponseWriter, r *http.Request) (int, mfaCodeInput, bool) {
+	var input mfaCodeInput
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return 0, input, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "code is required", nil)
+		return 0, input, false
+	}
+	return userID, input, true
+}
@@ -0,0 +1,130 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/services"
+	"task-manager/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMFAController(t *testing.T) {
+	userService := services.NewUserService()
+	ada, _ := userService.Register("ada@example.com", "plum orchard velvet")
+	userService.Register("bob@example.com", "plum orchard velvet")
+	mfaService := services.NewMFAService(userService)
+	userController := &controllers.UserController{UserService: userService, TokenService: services.NewTokenService(userService), MFAService: mfaService}
+	mfaController := &controllers.MFAController{MFAService: mfaService}
+
+	type loginResponse struct {
+		Token         string                  `json:"token"`
+		MFARequired   bool                    `json:"mfa_required"`
+		MFAToken      string                  `json:"mfa_token"`
+		Enrollment    *services.MFAEnrollment `json:"enrollment"`
+		RecoveryCodes []string                `json:"recovery_codes"`
+	}
+	post := func(handler http.HandlerFunc, body string, asUserID int) (int, loginResponse) {
+		req, _ := http.NewRequest(http.MethodPost, "/api", strings.NewReader(body))
+		if user, err := userService.GetUserByID(asUserID); err == nil {
+			req = asUser(req, user)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		var response struct {
+			Data loginResponse `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response.Data
+	}
+	login := func(email string) loginResponse {
+		code, response := post(userController.Login, `{"email": "`+email+`", "password": "plum orchard velvet"}`, 0)
+		assert.Equal(t, http.StatusOK, code)
+		return response
+	}
+
+	// Ada enrolls
+	req, _ := http.NewRequest(http.MethodPost, "/api/me/2fa/enroll", nil)
+	rr := httptest.NewRecorder()
+	mfaController.Enroll(rr, asUser(req, ada))
+	var enrollment struct {
+		Data services.MFAEnrollment `json:"data"`
+	}
+	json.NewDecoder(rr.Body).Decode(&enrollment)
+	assert.True(t, strings.HasPrefix(enrollment.Data.URI, "otpauth://totp/"))
+	code, _ := post(mfaController.ConfirmEnrollment, `{"code": "000000"}`, ada.ID)
+	assert.Equal(t, http.StatusBadRequest, code)
+	totp, _ := utils.TOTPCode(enrollment.Data.Secret, time.Now())
+	code, confirmed := post(mfaController.ConfirmEnrollment, `{"code": "`+totp+`"}`, ada.ID)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, confirmed.RecoveryCodes, 10)
+
+	t.Run("TwoStepLogin", func(t *testing.T) {
+		challenge := login("ada@example.com")
+		assert.True(t, challenge.MFARequired)
+		assert.Empty(t, challenge.Token)
+
+		code, _ := post(userController.LoginMFA, `{"mfa_token": "`+challenge.MFAToken+`", "code": "123456"}`, 0)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		// The code used to confirm enrollment cannot be replayed
+		code, _ = post(userController.LoginMFA, `{"mfa_token": "`+challenge.MFAToken+`", "code": "`+totp+`"}`, 0)
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		code, tokens := post(userController.LoginMFA, `{"mfa_token": "`+challenge.MFAToken+`", "code": "`+confirmed.RecoveryCodes[0]+`"}`, 0)
+		assert.Equal(t, http.StatusOK, code)
+		assert.NotEmpty(t, tokens.Token)
+
+		// Challenges and recovery codes are single-use
+		code, _ = post(userController.LoginMFA, `{"mfa_token": "`+challenge.MFAToken+`", "code": "`+confirmed.RecoveryCodes[1]+`"}`, 0)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		challenge = login("ada@example.com")
+		code, _ = post(userController.LoginMFA, `{"mfa_token": "`+challenge.MFAToken+`", "code": "`+confirmed.RecoveryCodes[0]+`"}`, 0)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("AttemptLimit", func(t *testing.T) {
+		challenge := login("ada@example.com")
+		for i := 0; i < 5; i++ {
+			post(userController.LoginMFA, `{"mfa_token": "`+challenge.MFAToken+`", "code": "000000"}`, 0)
+		}
+		code, _ := post(userController.LoginMFA, `{"mfa_token": "`+challenge.MFAToken+`", "code": "`+confirmed.RecoveryCodes[2]+`"}`, 0)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("DisabledBetweenSteps", func(t *testing.T) {
+		challenge := login("ada@example.com")
+		userService.SetDisabled(ada.ID, true)
+		defer userService.SetDisabled(ada.ID, false)
+
+		code, tokens := post(userController.LoginMFA, `{"mfa_token": "`+challenge.MFAToken+`", "code": "`+confirmed.RecoveryCodes[3]+`"}`, 0)
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Empty(t, tokens.Token)
+	})
+
+	t.Run("RequiredByAdmin", func(t *testing.T) {
+		assert.NotEmpty(t, login("bob@example.com").Token)
+
+		code, _ := post(mfaController.SetRequirement, `{"required": true}`, ada.ID)
+		assert.Equal(t, http.StatusOK, code)
+		defer mfaService.SetRequired(false)
+
+		// Bob has to enroll while logging in
+		challenge := login("bob@example.com")
+		assert.True(t, challenge.MFARequired)
+		assert.NotNil(t, challenge.Enrollment)
+		totp, _ := utils.TOTPCode(challenge.Enrollment.Secret, time.Now())
+		code, tokens := post(userController.LoginMFA, `{"mfa_token": "`+challenge.MFAToken+`", "code": "`+totp+`"}`, 0)
+		assert.Equal(t, http.StatusOK, code)
+		assert.NotEmpty(t, tokens.Token)
+		assert.Len(t, tokens.RecoveryCodes, 10)
+
+		// and cannot opt out while it is required
+		code, _ = post(mfaController.Disable, `{"code": "`+totp+`"}`, ada.ID)
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+}
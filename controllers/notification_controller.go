@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"task-manager/models"
+	"task-manager/services"
+	"task-manager/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// NotificationController handles the authenticated user's notification inbox.
+type NotificationController struct {
+	NotificationService *services.NotificationService
+}
+
+// GetNotifications lists the user's notifications, newest first.
+// It supports an "unread" query parameter to only return unread notifications.
+func (nc *NotificationController) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	unreadOnly, _ := strconv.ParseBool(r.URL.Query().Get("unread"))
+	notifications := nc.NotificationService.GetNotifications(userID, unreadOnly)
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Notifications retrieved successfully", notifications)
+}
+
+// MarkAsRead marks a notification as read.
+// It expects the notification ID as a URL parameter.
+func (nc *NotificationController) MarkAsRead(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid notification ID", nil)
+		return
+	}
+	if err := nc.NotificationService.MarkAsRead(userID, id); err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Notification not found", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Notification marked as read", nil)
+}
+
+// MarkAllAsRead marks all of the user's notifications as read.
+// On success, it returns the number of notifications updated.
+func (nc *NotificationController) MarkAllAsRead(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	count := nc.NotificationService.MarkAllAsRead(userID)
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Notifications marked as read", map[string]int{"updated": count})
+}
+
+// GetPreferences returns whether each notification type is enabled for the user.
+func (nc *NotificationController) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	prefs := nc.NotificationService.GetPreferences(userID)
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Preferences retrieved successfully", prefs)
+}
+
+// UpdatePreferences enables or disables notification types for the user.
+// It expects a JSON object mapping notification types to booleans, e.g. {"DUE_SOON": false}.
+func (nc *NotificationController) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	var input models.NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
+		return
+	}
+	if err := nc.NotificationService.UpdatePreferences(userID, input); err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Preferences updated successfully", nc.NotificationService.GetPreferences(userID))
+}
@@ -0,0 +1,91 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/middleware"
+	"task-manager/models"
+	"task-manager/services"
+	"task-manager/utils"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// asUser attaches the claims JWTAuthMiddleware would set for the given user.
+func asUser(req *http.Request, user *models.User) *http.Request {
+	return req.WithContext(middleware.WithClaims(req.Context(), &utils.Claims{UserID: user.ID, Email: user.Email}))
+}
+
+func TestNotificationController_GetNotifications(t *testing.T) {
+	userService := services.NewUserService()
+	ada, _ := userService.Register("ada@example.com", "plum orchard velvet")
+	bob, _ := userService.Register("bob@example.com", "plum orchard velvet")
+
+	taskService := services.NewTaskService()
+	notificationService := services.NewNotificationService(userService)
+	taskService.Subscribe(notificationService.HandleTaskEvent)
+	taskController := &controllers.TaskController{TaskService: taskService}
+	notificationController := &controllers.NotificationController{NotificationService: notificationService}
+
+	// Ada creates a task assigned to Bob that mentions Bob
+	requestBody := `{"title": "Review", "description": "@bob@example.com please review", "assignee_id": 2}`
+	req, _ := http.NewRequest(http.MethodPost, "/api/tasks", strings.NewReader(requestBody))
+	taskController.CreateTask(httptest.NewRecorder(), asUser(req, ada))
+
+	t.Run("ValidRequest", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/notifications?unread=true", nil)
+		rr := httptest.NewRecorder()
+		notificationController.GetNotifications(rr, asUser(req, bob))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response struct {
+			Data []models.Notification `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		assert.Len(t, response.Data, 2)
+		assert.Equal(t, models.NotificationAssigned, response.Data[0].Type)
+		assert.Equal(t, models.NotificationMentioned, response.Data[1].Type)
+	})
+
+	t.Run("ActorIsNotNotified", func(t *testing.T) {
+		assert.Empty(t, notificationService.GetNotifications(ada.ID, false))
+	})
+
+	t.Run("MarkAsRead", func(t *testing.T) {
+		id := notificationService.GetNotifications(bob.ID, false)[0].ID
+		req, _ := http.NewRequest(http.MethodPatch, "/api/notifications/1/read", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		rr := httptest.NewRecorder()
+		notificationController.MarkAsRead(rr, asUser(req, ada))
+		assert.Equal(t, http.StatusNotFound, rr.Code, "users cannot read each other's notifications")
+
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(id)})
+		rr = httptest.NewRecorder()
+		notificationController.MarkAsRead(rr, asUser(req, bob))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Len(t, notificationService.GetNotifications(bob.ID, true), 1)
+	})
+
+	t.Run("Preferences", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPut, "/api/notifications/preferences", strings.NewReader(`{"STATUS_CHANGED": false}`))
+		rr := httptest.NewRecorder()
+		notificationController.UpdatePreferences(rr, asUser(req, bob))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		taskService.MarkTaskAsComplete(ada.ID, 1)
+		for _, n := range notificationService.GetNotifications(bob.ID, false) {
+			assert.NotEqual(t, models.NotificationStatusChanged, n.Type)
+		}
+
+		req, _ = http.NewRequest(http.MethodPut, "/api/notifications/preferences", strings.NewReader(`{"NOPE": false}`))
+		rr = httptest.NewRecorder()
+		notificationController.UpdatePreferences(rr, asUser(req, bob))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"task-manager/middleware"
+	"task-manager/models"
+	"task-manager/services"
+	"task-manager/utils"
+)
+
+// ProfileController lets users manage their own account.
+type ProfileController struct {
+	UserService *services.UserService
+	// AccountService sends a verification link when the email address changes.
+	AccountService *services.AccountService
+	// TokenService ends the user's other sessions when the password changes.
+	TokenService *services.TokenService
+}
+
+// GetProfile returns the authenticated user.
+func (pc *ProfileController) GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	user, err := pc.UserService.GetUserByID(userID)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Profile retrieved successfully", user)
+}
+
+// UpdateProfile changes the fields of the JSON payload among "display_name",
+// "avatar_url", "timezone" and "locale".
+func (pc *ProfileController) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	var update models.ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
+		return
+	}
+
+	user, err := pc.UserService.UpdateProfile(userID, update)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", err.Error(), nil)
+		return
+	}
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Profile updated successfully", user)
+}
+
+// ChangePassword expects a JSON payload with "current_password" and
+// "new_password". All of the user's sessions are ended and new tokens are
+// returned for the current client.
+func (pc *ProfileController) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.NewPassword == "" {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "new_password is required", nil)
+		return
+	}
+
+	if err := pc.UserService.ChangePassword(userID, input.CurrentPassword, input.NewPassword); err != nil {
+		sendCredentialError(w, err)
+		return
+	}
+	if pc.TokenService == nil {
+		utils.SendJSONResponse(w, http.StatusOK, "success", "Password changed successfully", nil)
+		return
+	}
+	pc.TokenService.LogoutAll(userID)
+	user, err := pc.UserService.GetUserByID(userID)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", err.Error(), nil)
+		return
+	}
+	tokens, err := pc.TokenService.IssueTokens(user, r.UserAgent(), middleware.ClientIP(r))
+	if err != nil {
+		sendTokenError(w, r, err)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Password changed successfully", tokens)
+}
+
+// ChangeEmail expects a JSON payload with the new "email" and the user's
+// "password". A confirmation link is sent to the new address; the current
+// address stays in use until it is opened.
+func (pc *ProfileController) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "email is required", nil)
+		return
+	}
+
+	if err := pc.AccountService.RequestEmailChange(r.Context(), userID, input.Email, input.Password); err != nil {
+		sendCredentialError(w, err)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusAccepted, "success", "Check your new email address to confirm the change", nil)
+}
+
+// DeleteAccount deletes the authenticated user. It expects a JSON payload
+// with the user's "password" and an optional "transfer_to" user ID, of
+// someone they share tasks with, to hand their tasks over to; without it,
+// the tasks are anonymized and unassigned.
+func (pc *ProfileController) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	var input struct {
+		Password   string `json:"password"`
+		TransferTo int    `json:"transfer_to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
+		return
+	}
+
+	if err := pc.UserService.DeleteUser(userID, input.Password, input.TransferTo); err != nil {
+		sendCredentialError(w, err)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Account deleted successfully", nil)
+}
+
+// sendCredentialError responds to a failed account change: 403 for a wrong
+// password or a stale single sign-on login, 404 for a missing user and 400
+// otherwise.
+func sendCredentialError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials):
+		utils.SendJSONResponse(w, http.StatusForbidden, "error", "Incorrect password", nil)
+	case errors.Is(err, services.ErrReauthenticationRequired):
+		utils.SendJSONResponse(w, http.StatusForbidden, "error", err.Error(), nil)
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", err.Error(), nil)
+	default:
+		sendBadRequest(w, err)
+	}
+}
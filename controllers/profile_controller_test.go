@@ -0,0 +1,147 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/models"
+	"task-manager/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileController(t *testing.T) {
+	userService := services.NewUserService()
+	ada, _ := userService.Register("ada@example.com", "plum orchard velvet")
+	bob, _ := userService.Register("bob@example.com", "plum orchard velvet")
+	carol, _ := userService.Register("carol@example.com", "plum orchard velvet")
+	taskService := services.NewTaskService()
+	userService.SetSuccessorCheck(taskService.SharesWork)
+	userService.OnDelete(taskService.HandleUserDeleted)
+	accessTokenService := services.NewAccessTokenService(userService)
+	userService.OnDelete(accessTokenService.HandleUserDeleted)
+	sent := &recordingMailer{}
+	tokenService := services.NewTokenService(userService)
+	accountService := services.NewAccountService(userService, tokenService, sent, "http://localhost:8080", "http://localhost:8080")
+	profileController := &controllers.ProfileController{
+		UserService:    userService,
+		AccountService: accountService,
+		TokenService:   tokenService,
+	}
+
+	call := func(handler http.HandlerFunc, method, body string, user *models.User) (int, models.User) {
+		req, _ := http.NewRequest(method, "/api/me", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler(rr, asUser(req, user))
+		var response struct {
+			Data models.User `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response.Data
+	}
+
+	t.Run("UpdateProfile", func(t *testing.T) {
+		code, _ := call(profileController.UpdateProfile, http.MethodPatch, `{"timezone": "Mars/Olympus"}`, ada)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = call(profileController.UpdateProfile, http.MethodPatch, `{"avatar_url": "javascript:alert(1)"}`, ada)
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, user := call(profileController.UpdateProfile, http.MethodPatch, `{"display_name": " Ada ", "timezone": "Europe/London", "locale": "en-GB"}`, ada)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "Ada", user.DisplayName)
+
+		// Fields missing from the payload are kept
+		call(profileController.UpdateProfile, http.MethodPatch, `{"avatar_url": "https://example.com/ada.png"}`, ada)
+		code, user = call(profileController.GetProfile, http.MethodGet, "", ada)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "Ada", user.DisplayName)
+		assert.Equal(t, "Europe/London", user.Timezone)
+		assert.Equal(t, "en-GB", user.Locale)
+		assert.Equal(t, "https://example.com/ada.png", user.AvatarURL)
+	})
+
+	t.Run("ChangePassword", func(t *testing.T) {
+		code, _ := call(profileController.ChangePassword, http.MethodPost, `{"current_password": "wrong", "new_password": "amber kettle horizon"}`, ada)
+		assert.Equal(t, http.StatusForbidden, code)
+		code, _ = call(profileController.ChangePassword, http.MethodPost, `{"current_password": "plum orchard velvet", "new_password": "amber kettle horizon"}`, ada)
+		assert.Equal(t, http.StatusOK, code)
+		_, err := userService.Authenticate("ada@example.com", "amber kettle horizon")
+		assert.NoError(t, err)
+	})
+
+	t.Run("ChangeEmail", func(t *testing.T) {
+		userService.MarkEmailVerified(ada.ID)
+		code, _ := call(profileController.ChangeEmail, http.MethodPost, `{"email": "bob@example.com", "password": "amber kettle horizon"}`, ada)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = call(profileController.ChangeEmail, http.MethodPost, `{"email": "ada@lovelace.dev", "password": "amber kettle horizon"}`, ada)
+		assert.Equal(t, http.StatusAccepted, code)
+		assert.Len(t, sent.sent, 1)
+		assert.Equal(t, []string{"ada@lovelace.dev"}, sent.sent[0].To)
+
+		// The old address is kept until the new one is confirmed
+		user, _ := userService.GetUserByID(ada.ID)
+		assert.Equal(t, "ada@example.com", user.Email)
+		assert.True(t, user.EmailVerified)
+
+		user, err := accountService.VerifyEmail(emailedToken.FindStringSubmatch(sent.sent[0].Text)[1])
+		assert.NoError(t, err)
+		assert.Equal(t, "ada@lovelace.dev", user.Email)
+		assert.True(t, user.EmailVerified)
+	})
+
+	t.Run("SingleSignOnUser", func(t *testing.T) {
+		dana, _ := userService.FindOrCreateUser("dana@example.com")
+
+		// Any password used to be accepted for users without one
+		code, _ := call(profileController.ChangePassword, http.MethodPost, `{"current_password": "anything", "new_password": "correct horse battery"}`, dana)
+		assert.Equal(t, http.StatusForbidden, code)
+		code, _ = call(profileController.DeleteAccount, http.MethodDelete, `{"password": "anything"}`, dana)
+		assert.Equal(t, http.StatusForbidden, code)
+
+		userService.MarkSSOLogin(dana.ID, time.Now().Add(-time.Hour))
+		code, _ = call(profileController.ChangePassword, http.MethodPost, `{"new_password": "correct horse battery"}`, dana)
+		assert.Equal(t, http.StatusForbidden, code)
+
+		userService.MarkSSOLogin(dana.ID, time.Now())
+		code, _ = call(profileController.ChangePassword, http.MethodPost, `{"new_password": "correct horse battery"}`, dana)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("DeleteAccount", func(t *testing.T) {
+		created := taskService.CreateTask(models.Task{Title: "Write notes", CreatorID: ada.ID, AssigneeID: ada.ID})
+		assigned := taskService.CreateTask(models.Task{Title: "Review notes", CreatorID: bob.ID, AssigneeID: ada.ID})
+
+		code, _ := call(profileController.DeleteAccount, http.MethodDelete, `{"password": "plum orchard velvet"}`, ada)
+		assert.Equal(t, http.StatusForbidden, code)
+		code, _ = call(profileController.DeleteAccount, http.MethodDelete, `{"password": "amber kettle horizon", "transfer_to": 42}`, ada)
+		assert.Equal(t, http.StatusBadRequest, code)
+		// Tasks only go to users who already work with the deleted user
+		code, _ = call(profileController.DeleteAccount, http.MethodDelete, `{"password": "amber kettle horizon", "transfer_to": `+strconv.Itoa(carol.ID)+`}`, ada)
+		assert.Equal(t, http.StatusBadRequest, code)
+		accessTokenService.CreateToken(ada.ID, "ci", nil, nil)
+
+		code, _ = call(profileController.DeleteAccount, http.MethodDelete, `{"password": "amber kettle horizon", "transfer_to": 2}`, ada)
+		assert.Equal(t, http.StatusOK, code)
+		_, err := userService.GetUserByID(ada.ID)
+		assert.ErrorIs(t, err, services.ErrUserNotFound)
+		assert.Empty(t, accessTokenService.GetTokens(ada.ID))
+
+		task, _ := taskService.GetTaskByID(created.ID)
+		assert.Equal(t, bob.ID, task.CreatorID)
+		assert.Equal(t, bob.ID, task.AssigneeID)
+		task, _ = taskService.GetTaskByID(assigned.ID)
+		assert.Equal(t, bob.ID, task.AssigneeID)
+
+		// Without a successor, tasks are anonymized
+		code, _ = call(profileController.DeleteAccount, http.MethodDelete, `{"password": "plum orchard velvet"}`, bob)
+		assert.Equal(t, http.StatusOK, code)
+		task, _ = taskService.GetTaskByID(created.ID)
+		assert.Equal(t, 0, task.CreatorID)
+		assert.Equal(t, 0, task.AssigneeID)
+	})
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"net/http"
+	"task-manager/middleware"
+	"task-manager/services"
+	"task-manager/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// SessionController lets users see the devices they are logged in on and log them out.
+type SessionController struct {
+	TokenService *services.TokenService
+}
+
+// GetSessions lists the user's active sessions, marking the one the request was made with.
+func (sc *SessionController) GetSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	sessions := sc.TokenService.GetSessions(claims.UserID)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Sessions retrieved successfully", sessions)
+}
+
+// RevokeSession logs one of the user's sessions out. Its access tokens stop
+// working immediately and its refresh token can no longer be used.
+func (sc *SessionController) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	if err := sc.TokenService.RevokeSession(userID, mux.Vars(r)["id"]); err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Session revoked successfully", nil)
+}
@@ -0,0 +1,77 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"task-manager/controllers"
+	"task-manager/middleware"
+	"task-manager/models"
+	"task-manager/services"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionController(t *testing.T) {
+	userService := services.NewUserService()
+	ada, _ := userService.Register("ada@example.com", "plum orchard velvet")
+	bob, _ := userService.Register("bob@example.com", "plum orchard velvet")
+	tokenService := services.NewTokenService(userService)
+	middleware.SetRevocationCheck(tokenService.IsRevoked)
+	middleware.SetSessionTracker(tokenService.Touch)
+	t.Cleanup(func() {
+		middleware.SetRevocationCheck(nil)
+		middleware.SetSessionTracker(nil)
+	})
+	sessionController := &controllers.SessionController{TokenService: tokenService}
+
+	router := mux.NewRouter()
+	router.Handle("/api/me/sessions", middleware.JWTAuthMiddleware(http.HandlerFunc(sessionController.GetSessions))).Methods(http.MethodGet)
+	router.Handle("/api/me/sessions/{id}", middleware.JWTAuthMiddleware(http.HandlerFunc(sessionController.RevokeSession))).Methods(http.MethodDelete)
+
+	laptop, _ := tokenService.IssueTokens(ada, "Firefox", "192.0.2.1")
+	phone, _ := tokenService.IssueTokens(ada, "Safari", "192.0.2.2")
+	bobs, _ := tokenService.IssueTokens(bob, "Chrome", "192.0.2.3")
+
+	call := func(method, path, accessToken string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.RemoteAddr = "198.51.100.7:4242"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	getSessions := func(accessToken string) []models.Session {
+		rr := call(http.MethodGet, "/api/me/sessions", accessToken)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response struct {
+			Data []models.Session `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return response.Data
+	}
+
+	sessions := getSessions(laptop.AccessToken)
+	assert.Len(t, sessions, 2)
+	// The session just used comes first, with the address it was used from
+	assert.True(t, sessions[0].Current)
+	assert.Equal(t, "Firefox", sessions[0].UserAgent)
+	assert.Equal(t, "198.51.100.7", sessions[0].IP)
+	assert.False(t, sessions[1].Current)
+	assert.Equal(t, "Safari", sessions[1].UserAgent)
+	phoneID := sessions[1].ID
+
+	// Other users' sessions cannot be revoked
+	rr := call(http.MethodDelete, "/api/me/sessions/"+phoneID, bobs.AccessToken)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = call(http.MethodDelete, "/api/me/sessions/"+phoneID, laptop.AccessToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = call(http.MethodGet, "/api/me/sessions", phone.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	_, err := tokenService.Refresh(phone.RefreshToken)
+	assert.Error(t, err)
+	assert.Len(t, getSessions(laptop.AccessToken), 1)
+}
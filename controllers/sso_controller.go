@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"task-manager/services"
+	"task-manager/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// ssoStateCookie binds a login to the browser that started it, so that a
+// callback URL from someone else's login cannot log the user into their account.
+const ssoStateCookie = "sso_state"
+
+// SSOController handles single sign-on through OpenID Connect providers.
+type SSOController struct {
+	SSOService   *services.SSOService
+	TokenService *services.TokenService
+	MFAService   *services.MFAService
+}
+
+// GetProviders lists the names of the configured providers.
+func (sc *SSOController) GetProviders(w http.ResponseWriter, r *http.Request) {
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Providers retrieved successfully", sc.SSOService.Providers())
+}
+
+// Login redirects the user to the provider to log in.
+func (sc *SSOController) Login(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := sc.SSOService.StartLogin(r.Context(), mux.Vars(r)["provider"])
+	if errors.Is(err, services.ErrUnknownProvider) {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Unknown provider", nil)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "could not start single sign-on", "provider", mux.Vars(r)["provider"], "error", err)
+		utils.SendJSONResponse(w, http.StatusBadGateway, "error", "Provider unavailable", nil)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoStateCookie,
+		Value:    state,
+		Path:     "/api/sso",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback completes a login when the provider redirects back with an
+// authorization code. On success, it responds like Login: with tokens, or with
+// a two-factor challenge to complete through LoginMFA.
+func (sc *SSOController) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Login failed: "+query.Get("error"), nil)
+		return
+	}
+	state := query.Get("state")
+	cookie, err := r.Cookie(ssoStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid login state", nil)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: ssoStateCookie, Path: "/api/sso", MaxAge: -1})
+
+	user, err := sc.SSOService.FinishLogin(r.Context(), mux.Vars(r)["provider"], state, query.Get("code"))
+	switch {
+	case errors.Is(err, services.ErrInvalidSSOState):
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid login state", nil)
+		return
+	case errors.Is(err, services.ErrEmailNotVerified):
+		utils.SendJSONResponse(w, http.StatusForbidden, "error", err.Error(), nil)
+		return
+	case errors.Is(err, services.ErrUnverifiedAccount):
+		utils.SendJSONResponse(w, http.StatusConflict, "error", err.Error(), nil)
+		return
+	case err != nil:
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Login failed", nil)
+		return
+	}
+
+	if err := services.CheckLoginAllowed(user); err != nil {
+		utils.SendJSONResponse(w, http.StatusForbidden, "error", err.Error(), nil)
+		return
+	}
+	completeLogin(w, r, sc.TokenService, sc.MFAService, user, "Login successful")
+}
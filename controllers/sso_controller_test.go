@@ -0,0 +1,233 @@
+package controllers_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"task-manager/controllers"
+	"task-manager/models"
+	"task-manager/oidc"
+	"task-manager/routes"
+	"task-manager/services"
+	"task-manager/utils"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockOIDCProvider is a minimal OpenID provider that logs in whichever user is
+// set as its current user.
+type mockOIDCProvider struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	mutex sync.Mutex
+	user  jwt.MapClaims
+	codes map[string]url.Values // code -> authorization request
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p := &mockOIDCProvider{key: key, codes: map[string]url.Values{}}
+	handler := http.NewServeMux()
+	handler.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	handler.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "mock", "alg": "RS256", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	handler.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		code := "code-" + query.Get("state")
+		p.mutex.Lock()
+		p.codes[code] = query
+		p.mutex.Unlock()
+		http.Redirect(w, r, query.Get("redirect_uri")+"?code="+code+"&state="+query.Get("state"), http.StatusFound)
+	})
+	handler.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID, secret, _ := r.BasicAuth()
+		p.mutex.Lock()
+		auth, ok := p.codes[r.Form.Get("code")]
+		delete(p.codes, r.Form.Get("code"))
+		claims := jwt.MapClaims{}
+		for k, v := range p.user {
+			claims[k] = v
+		}
+		p.mutex.Unlock()
+		if !ok || clientID != "task-manager" || secret != "s3cret" ||
+			oidc.PKCEChallenge(r.Form.Get("code_verifier")) != auth.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims["iss"] = p.URL
+		claims["aud"] = clientID
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		if _, ok := claims["nonce"]; !ok {
+			claims["nonce"] = auth.Get("nonce")
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "mock"
+		idToken, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": idToken})
+	})
+	p.Server = httptest.NewServer(handler)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *mockOIDCProvider) setUser(claims jwt.MapClaims) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.user = claims
+}
+
+func TestSSOController(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+	userService := services.NewUserService()
+	existing, _ := userService.Register("ada@example.com", "correct horse battery")
+
+	router := mux.NewRouter()
+	app := httptest.NewServer(router)
+	defer app.Close()
+	ssoService := services.NewSSOService(userService, oidc.NewProvider(oidc.Config{
+		Name:         "corporate",
+		Issuer:       provider.URL,
+		ClientID:     "task-manager",
+		ClientSecret: "s3cret",
+		RedirectURL:  app.URL + "/api/sso/corporate/callback",
+	}, provider.Client()))
+	tokenService := services.NewTokenService(userService)
+	mfaService := services.NewMFAService(userService)
+	routes.RegisterSSORoutes(router, &controllers.SSOController{SSOService: ssoService, TokenService: tokenService, MFAService: mfaService})
+	userController := &controllers.UserController{UserService: userService, TokenService: tokenService, MFAService: mfaService}
+
+	type loginResponse struct {
+		models.TokenPair
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	// login follows the whole redirect flow like a browser and returns the final response
+	login := func(t *testing.T) (int, loginResponse) {
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+		resp, err := client.Get(app.URL + "/api/sso/corporate/login")
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		var response struct {
+			Data loginResponse `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&response)
+		return resp.StatusCode, response.Data
+	}
+
+	t.Run("RefusesUnverifiedExistingUser", func(t *testing.T) {
+		// Anyone could have registered with the address, so the account is not linked
+		provider.setUser(jwt.MapClaims{"sub": "u-1", "email": "Ada@example.com", "email_verified": true})
+		code, _ := login(t)
+		assert.Equal(t, http.StatusConflict, code)
+		user, _ := userService.GetUserByID(existing.ID)
+		assert.False(t, user.EmailVerified)
+		assert.Len(t, userService.GetUsers(), 1)
+	})
+
+	t.Run("LinksExistingUserByVerifiedEmail", func(t *testing.T) {
+		assert.NoError(t, userService.MarkEmailVerified(existing.ID))
+		provider.setUser(jwt.MapClaims{"sub": "u-1", "email": "Ada@example.com", "email_verified": true})
+		code, tokens := login(t)
+		assert.Equal(t, http.StatusOK, code)
+		claims, err := utils.ValidateJWT(tokens.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, existing.ID, claims.UserID)
+		assert.Len(t, userService.GetUsers(), 1)
+	})
+
+	t.Run("LinkedIdentityIsMatchedBySubject", func(t *testing.T) {
+		provider.setUser(jwt.MapClaims{"sub": "u-1", "email": "ada.lovelace@example.com", "email_verified": true})
+		code, _ := login(t)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Len(t, userService.GetUsers(), 1)
+	})
+
+	t.Run("CreatesNewUser", func(t *testing.T) {
+		provider.setUser(jwt.MapClaims{"sub": "u-2", "email": "bob@example.com", "email_verified": true})
+		code, _ := login(t)
+		assert.Equal(t, http.StatusOK, code)
+		user, err := userService.GetUserByEmail("bob@example.com")
+		assert.NoError(t, err)
+		// SSO users have no password to log in with
+		_, err = userService.Authenticate(user.Email, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("RequiresSecondFactor", func(t *testing.T) {
+		bob, _ := userService.GetUserByEmail("bob@example.com")
+		enrollment, _ := mfaService.StartEnrollment(bob.ID)
+		totp, _ := utils.TOTPCode(enrollment.Secret, time.Now())
+		_, err := mfaService.ConfirmEnrollment(bob.ID, totp)
+		assert.NoError(t, err)
+
+		provider.setUser(jwt.MapClaims{"sub": "u-2", "email": "bob@example.com", "email_verified": true})
+		code, challenge := login(t)
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, challenge.MFARequired)
+		assert.Empty(t, challenge.AccessToken)
+
+		// The challenge is completed like one from a password login
+		totp, _ = utils.TOTPCode(enrollment.Secret, time.Now().Add(30*time.Second))
+		req, _ := http.NewRequest(http.MethodPost, "/api/login/mfa", strings.NewReader(`{"mfa_token": "`+challenge.MFAToken+`", "code": "`+totp+`"}`))
+		rr := httptest.NewRecorder()
+		userController.LoginMFA(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("UnverifiedEmail", func(t *testing.T) {
+		provider.setUser(jwt.MapClaims{"sub": "u-3", "email": "ada@example.com", "email_verified": false})
+		code, _ := login(t)
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("WrongNonce", func(t *testing.T) {
+		provider.setUser(jwt.MapClaims{"sub": "u-1", "email": "ada@example.com", "email_verified": true, "nonce": "replayed"})
+		code, _ := login(t)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("ForeignState", func(t *testing.T) {
+		// A callback URL from a login started in another browser is rejected
+		noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, _ := noRedirects.Get(app.URL + "/api/sso/corporate/login")
+		authURL, _ := url.Parse(resp.Header.Get("Location"))
+		assert.True(t, strings.HasPrefix(authURL.String(), provider.URL+"/authorize"))
+		assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+
+		resp, _ = noRedirects.Get(authURL.String())
+		resp, _ = noRedirects.Get(resp.Header.Get("Location"))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("UnknownProvider", func(t *testing.T) {
+		resp, _ := http.Get(app.URL + "/api/sso/other/login")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"task-manager/models"
+	"task-manager/services"
+	"task-manager/utils"
+)
+
+// maxSyncChanges caps the number of changes accepted by a single push.
+const maxSyncChanges = 500
+
+// SyncController implements the delta sync protocol used by offline-capable clients.
+type SyncController struct {
+	TaskService *services.TaskService
+}
+
+// GetChanges returns the tasks changed and deleted since the "since" sync token,
+// and the token to use next time. Without a token, all tasks are returned.
+// An expired token (from before a server restart) yields 410 Gone; the client
+// should then sync from scratch.
+func (sc *SyncController) GetChanges(w http.ResponseWriter, r *http.Request) {
+	changes, err := sc.TaskService.ChangesSince(r.URL.Query().Get("since"))
+	switch {
+	case errors.Is(err, services.ErrSyncTokenExpired):
+		utils.SendJSONResponse(w, http.StatusGone, "error", "Sync token expired, sync from scratch", nil)
+		return
+	case err != nil:
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid sync token", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Changes retrieved successfully", changes)
+}
+
+// PushChanges applies a batch of offline changes.
+// It expects a JSON payload with a "changes" array of create, update and delete
+// operations and returns a result per change, listing the fields that
+// conflicted with newer server changes and were not applied.
+func (sc *SyncController) PushChanges(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	var input struct {
+		Changes []models.SyncChange `json:"changes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
+		return
+	}
+	if len(input.Changes) > maxSyncChanges {
+		utils.SendJSONResponse(w, http.StatusRequestEntityTooLarge, "error", "Too many changes", nil)
+		return
+	}
+	results := sc.TaskService.ApplyChanges(userID, input.Changes)
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Changes applied", map[string]interface{}{"results": results})
+}
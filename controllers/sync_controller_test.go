@@ -0,0 +1,135 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/models"
+	"task-manager/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncController(t *testing.T) {
+	user := &models.User{ID: 1, Email: "ada@example.com"}
+	taskService := services.NewTaskService()
+	syncController := &controllers.SyncController{TaskService: taskService}
+
+	pull := func(token string) (int, services.SyncChanges) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/sync?since="+token, nil)
+		rr := httptest.NewRecorder()
+		syncController.GetChanges(rr, asUser(req, user))
+		var response struct {
+			Data services.SyncChanges `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response.Data
+	}
+	push := func(body string) []models.SyncResult {
+		req, _ := http.NewRequest(http.MethodPost, "/api/sync", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		syncController.PushChanges(rr, asUser(req, user))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response struct {
+			Data struct {
+				Results []models.SyncResult `json:"results"`
+			} `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return response.Data.Results
+	}
+
+	taskService.CreateTask(models.Task{Title: "Write docs", Description: "API reference"})
+	taskService.CreateTask(models.Task{Title: "Fix bug", Description: "crash on save"})
+	// A client goes offline and edits the first task before the server changes it
+	offlineEdit := time.Now()
+	time.Sleep(time.Millisecond)
+
+	code, initial := pull("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, initial.Tasks, 2)
+	assert.NotEmpty(t, initial.Token)
+
+	t.Run("DeltaWithTombstones", func(t *testing.T) {
+		taskService.UpdateTask(user.ID, 1, "Write docs", "API reference and guide", models.InProgress)
+		taskService.DeleteTask(user.ID, 2)
+
+		code, changes := pull(initial.Token)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Len(t, changes.Tasks, 1)
+		assert.Equal(t, "API reference and guide", changes.Tasks[0].Description)
+		assert.Len(t, changes.Deleted, 1)
+		assert.Equal(t, 2, changes.Deleted[0].ID)
+
+		_, none := pull(changes.Token)
+		assert.Empty(t, none.Tasks)
+		assert.Empty(t, none.Deleted)
+	})
+
+	t.Run("PushCreate", func(t *testing.T) {
+		results := push(`{"changes": [{"op": "create", "client_id": "tmp-1", "fields": {"title": "Offline", "description": "made on a plane", "status": "IN_PROGRESS"}}]}`)
+		assert.Len(t, results, 1)
+		assert.Equal(t, models.SyncApplied, results[0].Status)
+		assert.Equal(t, "tmp-1", results[0].ClientID)
+		task, err := taskService.GetTaskByID(results[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.InProgress, task.Status)
+	})
+
+	t.Run("PerFieldLastWriterWins", func(t *testing.T) {
+		// The client's status change is older than the server's; its title change wins
+		editedAt := offlineEdit.Format(time.RFC3339Nano)
+		results := push(`{"changes": [{"op": "update", "id": 1, "updated_at": "` + editedAt + `", "fields": {"title": "Write the docs", "status": "COMPLETED"}}]}`)
+		assert.Len(t, results, 1)
+		assert.Equal(t, models.SyncPartial, results[0].Status)
+		assert.Len(t, results[0].Conflicts, 1)
+		assert.Equal(t, "status", results[0].Conflicts[0].Field)
+		assert.Equal(t, string(models.InProgress), results[0].Conflicts[0].ServerValue)
+
+		task, _ := taskService.GetTaskByID(1)
+		assert.Equal(t, "Write the docs", task.Title)
+		assert.Equal(t, models.InProgress, task.Status)
+	})
+
+	t.Run("DeletedTask", func(t *testing.T) {
+		results := push(`{"changes": [{"op": "update", "id": 2, "fields": {"title": "Fix it"}}, {"op": "delete", "id": 2}]}`)
+		assert.Equal(t, models.SyncConflicted, results[0].Status)
+		assert.Equal(t, models.SyncApplied, results[1].Status)
+	})
+
+	t.Run("StaleDelete", func(t *testing.T) {
+		deletedAt := time.Now().Add(-time.Hour).Format(time.RFC3339)
+		results := push(`{"changes": [{"op": "delete", "id": 1, "updated_at": "` + deletedAt + `"}]}`)
+		assert.Equal(t, models.SyncConflicted, results[0].Status)
+		_, err := taskService.GetTaskByID(1)
+		assert.NoError(t, err)
+	})
+
+	t.Run("InvalidChanges", func(t *testing.T) {
+		results := push(`{"changes": [{"op": "update", "id": 1, "fields": {"priority": 1}}, {"op": "create", "fields": {"title": "No description"}}, {"op": "move", "id": 1}]}`)
+		for _, result := range results {
+			assert.Equal(t, models.SyncRejected, result.Status)
+		}
+	})
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		code, _ := pull("not-a-token")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = pull(services.EncodeSyncToken(1 << 40))
+		assert.Equal(t, http.StatusGone, code)
+	})
+	t.Run("PurgedDeletion", func(t *testing.T) {
+		assert.Equal(t, 1, taskService.PurgeDeleted(time.Now().Add(time.Second)))
+
+		code, _ := pull(initial.Token)
+		assert.Equal(t, http.StatusGone, code)
+		code, current := pull("")
+		assert.Equal(t, http.StatusOK, code)
+		code, _ = pull(current.Token)
+		assert.Equal(t, http.StatusOK, code)
+	})
+}
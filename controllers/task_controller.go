@@ -2,11 +2,13 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"task-manager/models"
 	"task-manager/services"
 	"task-manager/utils"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -20,13 +22,23 @@ func NewTaskController(service *services.TaskService) *TaskController {
 	return &TaskController{TaskService: service}
 }
 
+// maxOccurrencePreview caps the "count" parameter of GetOccurrences.
+const maxOccurrencePreview = 100
+
 // CreateTask creates a new task.
-// It expects a JSON payload with "title" and "description" fields.
+// It expects a JSON payload with "title" and "description" fields, and optionally an
+// "assignee_id", a "due_date" (RFC 3339) and a "recurrence" object with an RRULE "rule" and "timezone".
 // On success, it returns the created task in the response.
 func (tc *TaskController) CreateTask(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
+		Title       string     `json:"title"`
+		Description string     `json:"description"`
+		AssigneeID  int        `json:"assignee_id"`
+		DueDate     *time.Time `json:"due_date"`
+		Recurrence  *struct {
+			Rule     string `json:"rule"`
+			Timezone string `json:"timezone"`
+		} `json:"recurrence"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
@@ -37,8 +49,39 @@ func (tc *TaskController) CreateTask(w http.ResponseWriter, r *http.Request) {
 		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "title and description are required", nil)
 		return
 	}
+	if err := tc.TaskService.CheckAssignee(input.AssigneeID); err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Assignee does not exist", nil)
+		return
+	}
+
+	task := models.Task{
+		Title:       input.Title,
+		Description: input.Description,
+		CreatorID:   currentUserID(r),
+		AssigneeID:  input.AssigneeID,
+		DueDate:     input.DueDate,
+	}
+	if input.Recurrence != nil {
+		if input.DueDate == nil {
+			utils.SendJSONResponse(w, http.StatusBadRequest, "error", "due_date is required for recurring tasks", nil)
+			return
+		}
+		if _, err := models.ParseRRule(input.Recurrence.Rule); err != nil {
+			utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid recurrence rule: "+err.Error(), nil)
+			return
+		}
+		if _, err := time.LoadLocation(input.Recurrence.Timezone); err != nil {
+			utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid timezone", nil)
+			return
+		}
+		task.Recurrence = &models.Recurrence{
+			Rule:     input.Recurrence.Rule,
+			Timezone: input.Recurrence.Timezone,
+			Start:    *input.DueDate,
+		}
+	}
 
-	task := tc.TaskService.CreateTask(input.Title, input.Description)
+	task = tc.TaskService.CreateTask(task)
 	utils.SendJSONResponse(w, http.StatusCreated, "success", "Task created successfully", task)
 }
 
@@ -106,13 +149,41 @@ func (tc *TaskController) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
 		return
 	}
-	if err := tc.TaskService.UpdateTask(id, input.Title, input.Description, input.Status); err != nil {
-		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Task not found", nil)
+	if err := tc.TaskService.UpdateTask(currentUserID(r), id, input.Title, input.Description, input.Status); err != nil {
+		sendTaskError(w, r, err)
 		return
 	}
 	utils.SendJSONResponse(w, http.StatusOK, "success", "Task updated successfully", nil)
 }
 
+// AssignTask assigns a task to a user.
+// It expects the task ID as a URL parameter and a JSON payload with an "assignee_id" field (0 to unassign).
+// On success, it returns a success message in the response.
+func (tc *TaskController) AssignTask(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid task ID", nil)
+		return
+	}
+	var input struct {
+		AssigneeID int `json:"assignee_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.AssigneeID < 0 {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
+		return
+	}
+	err = tc.TaskService.AssignTask(currentUserID(r), id, input.AssigneeID)
+	switch {
+	case errors.Is(err, services.ErrAssigneeNotFound):
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Assignee does not exist", nil)
+		return
+	case err != nil:
+		sendTaskError(w, r, err)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Task assigned successfully", nil)
+}
+
 // DeleteTask deletes a task by ID.
 // It expects the task ID as a URL parameter.
 // On success, it returns a success message in the response.
@@ -122,7 +193,7 @@ func (tc *TaskController) DeleteTask(w http.ResponseWriter, r *http.Request) {
 		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid task ID", nil)
 		return
 	}
-	if err := tc.TaskService.DeleteTask(id); err != nil {
+	if err := tc.TaskService.DeleteTask(currentUserID(r), id); err != nil {
 		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Task not found", nil)
 		return
 	}
@@ -138,9 +209,46 @@ func (tc *TaskController) MarkTaskAsComplete(w http.ResponseWriter, r *http.Requ
 		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid task ID", nil)
 		return
 	}
-	if err := tc.TaskService.MarkTaskAsComplete(id); err != nil {
-		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Task not found", nil)
+	next, err := tc.TaskService.MarkTaskAsComplete(currentUserID(r), id)
+	if err != nil {
+		sendTaskError(w, r, err)
+		return
+	}
+	if next != nil {
+		utils.SendJSONResponse(w, http.StatusOK, "success", "Task marked as complete", map[string]*models.Task{"next_task": next})
 		return
 	}
 	utils.SendJSONResponse(w, http.StatusOK, "success", "Task marked as complete", nil)
 }
+
+// GetOccurrences previews the upcoming due dates of a recurring task.
+// It expects the task ID as a URL parameter and supports a "count" query parameter (default 5).
+// On success, it returns the list of due dates in the response.
+func (tc *TaskController) GetOccurrences(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid task ID", nil)
+		return
+	}
+
+	count := 5
+	if countStr := r.URL.Query().Get("count"); countStr != "" {
+		c, err := strconv.Atoi(countStr)
+		if err != nil || c < 1 || c > maxOccurrencePreview {
+			utils.SendJSONResponse(w, http.StatusBadRequest, "error", "count must be between 1 and 100", nil)
+			return
+		}
+		count = c
+	}
+
+	occurrences, err := tc.TaskService.GetOccurrences(id, count)
+	switch {
+	case errors.Is(err, services.ErrTaskNotRecurring):
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Task does not recur", nil)
+		return
+	case err != nil:
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Task not found", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Occurrences retrieved successfully", occurrences)
+}
@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"task-manager/controllers"
+	"task-manager/models"
 	"task-manager/services"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
@@ -309,3 +312,127 @@ func TestTaskController_MarkTaskAsComplete(t *testing.T) {
 		assert.Nil(t, response["data"])
 	})
 }
+
+func TestTaskController_RecurringTask(t *testing.T) {
+	taskService := services.NewTaskService()
+	taskController := &controllers.TaskController{TaskService: taskService}
+
+	t.Run("CompleteCreatesNextOccurrence", func(t *testing.T) {
+		// Every other Monday and Thursday at 09:00 Berlin time, four times in total
+		requestBody := `{"title": "Release", "description": "Cut a release", "due_date": "2024-03-25T09:00:00+01:00",
+			"recurrence": {"rule": "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=4", "timezone": "Europe/Berlin"}}`
+		req, _ := http.NewRequest(http.MethodPost, "/api/tasks", strings.NewReader(requestBody))
+		rr := httptest.NewRecorder()
+		taskController.CreateTask(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		// Preview the rest of the series; the Thursday falls after the DST change
+		req, _ = http.NewRequest(http.MethodGet, "/api/tasks/1/occurrences?count=10", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		rr = httptest.NewRecorder()
+		taskController.GetOccurrences(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var preview struct {
+			Data []string `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&preview)
+		assert.Equal(t, []string{
+			"2024-03-28T09:00:00+01:00",
+			"2024-04-08T09:00:00+02:00",
+			"2024-04-11T09:00:00+02:00",
+		}, preview.Data)
+
+		// Completing the task creates the next one in the series
+		req, _ = http.NewRequest(http.MethodPatch, "/api/tasks/1/complete", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		rr = httptest.NewRecorder()
+		taskController.MarkTaskAsComplete(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		next, err := taskService.GetTaskByID(2)
+		assert.NoError(t, err)
+		assert.Equal(t, "Release", next.Title)
+		assert.Equal(t, 2, next.Recurrence.Index)
+		assert.Equal(t, "2024-03-28T09:00:00+01:00", next.DueDate.Format(time.RFC3339))
+	})
+
+	t.Run("UpdateToCompletedCreatesNextOccurrence", func(t *testing.T) {
+		requestBody := `{"title": "Backup", "description": "Check backups", "due_date": "2024-01-01T08:00:00Z",
+			"recurrence": {"rule": "FREQ=MONTHLY;BYDAY=1MO"}}`
+		req, _ := http.NewRequest(http.MethodPost, "/api/tasks", strings.NewReader(requestBody))
+		rr := httptest.NewRecorder()
+		taskController.CreateTask(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var created struct {
+			Data models.Task `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&created)
+		id := strconv.Itoa(created.Data.ID)
+
+		req, _ = http.NewRequest(http.MethodPut, "/api/tasks/"+id, strings.NewReader(`{"title": "Backup", "description": "Check backups", "status": "COMPLETED"}`))
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rr = httptest.NewRecorder()
+		taskController.UpdateTask(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		next, err := taskService.GetTaskByID(created.Data.ID + 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-02-05T08:00:00Z", next.DueDate.Format(time.RFC3339))
+	})
+
+	t.Run("UnknownTask", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPatch, "/api/tasks/999/complete", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "999"})
+		rr := httptest.NewRecorder()
+		taskController.MarkTaskAsComplete(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("InvalidRule", func(t *testing.T) {
+		requestBody := `{"title": "Audit", "description": "Monthly audit", "due_date": "2024-01-31T10:00:00Z",
+			"recurrence": {"rule": "FREQ=HOURLY"}}`
+		req, _ := http.NewRequest(http.MethodPost, "/api/tasks", strings.NewReader(requestBody))
+		rr := httptest.NewRecorder()
+		taskController.CreateTask(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestTaskController_AssignTask(t *testing.T) {
+	userService := services.NewUserService()
+	bob, _ := userService.Register("bob@example.com", "correct horse battery staple")
+	taskService := services.NewTaskService()
+	taskService.SetUsers(userService)
+	taskController := &controllers.TaskController{TaskService: taskService}
+	task := taskService.CreateTask(models.Task{Title: "Review", Description: "Review the PR"})
+	id := strconv.Itoa(task.ID)
+
+	assign := func(id, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPatch, "/api/tasks/"+id+"/assign", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rr := httptest.NewRecorder()
+		taskController.AssignTask(rr, req)
+		return rr
+	}
+
+	t.Run("ValidRequest", func(t *testing.T) {
+		rr := assign(id, `{"assignee_id": `+strconv.Itoa(bob.ID)+`}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assigned, _ := taskService.GetTaskByID(task.ID)
+		assert.Equal(t, bob.ID, assigned.AssigneeID)
+	})
+
+	t.Run("UnknownAssignee", func(t *testing.T) {
+		rr := assign(id, `{"assignee_id": 999}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assigned, _ := taskService.GetTaskByID(task.ID)
+		assert.Equal(t, bob.ID, assigned.AssigneeID)
+	})
+
+	t.Run("UnknownTask", func(t *testing.T) {
+		rr := assign("999", `{"assignee_id": 0}`)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -2,19 +2,33 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"task-manager/logging"
+	"task-manager/middleware"
+	"task-manager/models"
 	"task-manager/services"
 	"task-manager/utils"
+	"time"
 )
 
 // UserController handles user-related HTTP requests.
 type UserController struct {
 	UserService *services.UserService
+	// TokenService issues refresh tokens. Without it, only access tokens are issued.
+	TokenService *services.TokenService
+	// MFAService adds a second login step for users with two-factor authentication.
+	MFAService *services.MFAService
+	// AccountService sends new users a link to verify their email address.
+	AccountService *services.AccountService
+	// LoginAttempts locks accounts after failed logins and records login history.
+	LoginAttempts *services.LoginAttemptService
 }
 
 // Register handles user registration requests.
 // It expects a JSON payload with "email" and "password" fields.
-// On success, it returns a JWT token in the response.
+// On success, it returns a JWT token in the response and emails a link to
+// verify the address. Registration succeeds even if the email cannot be sent.
 func (uc *UserController) Register(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Email    string `json:"email"`
@@ -33,22 +47,24 @@ func (uc *UserController) Register(w http.ResponseWriter, r *http.Request) {
 
 	user, err := uc.UserService.Register(input.Email, input.Password)
 	if err != nil {
-		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		sendBadRequest(w, err)
 		return
 	}
 
-	token, err := utils.GenerateJWT(user.ID, user.Email)
-	if err != nil {
-		utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not generate token", nil)
-		return
+	if uc.AccountService != nil {
+		if err := uc.AccountService.SendVerification(r.Context(), user); err != nil {
+			logger.ErrorContext(r.Context(), "could not send verification email", "new_user_id", user.ID, "error", err)
+		}
 	}
-
-	utils.SendJSONResponse(w, http.StatusOK, "success", "User registered successfully", map[string]string{"token": token})
+	uc.completeLogin(w, r, user, "User registered successfully")
 }
 
 // Login handles user login requests.
 // It expects a JSON payload with "email" and "password" fields.
-// On success, it returns a JWT token in the response.
+// On success, it returns a JWT token in the response. Users with two-factor
+// authentication instead get an "mfa_token" to pass to LoginMFA with their code.
+// Accounts are locked for a while after repeated failures. Disabled users
+// and users required to reset their password get a 403.
 func (uc *UserController) Login(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Email    string `json:"email"`
@@ -59,17 +75,217 @@ func (uc *UserController) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if uc.LoginAttempts != nil {
+		if wait, err := uc.LoginAttempts.Check(input.Email); err != nil {
+			logger.WarnContext(r.Context(), "login refused, account locked", "retry_after", wait.Round(time.Second).String())
+			middleware.TooManyRequests(w, wait)
+			return
+		}
+	}
+
 	user, err := uc.UserService.Authenticate(input.Email, input.Password)
+	if uc.LoginAttempts != nil {
+		attempted := user
+		if attempted == nil {
+			attempted, _ = uc.UserService.GetUserByEmail(input.Email)
+		}
+		uc.LoginAttempts.Record(input.Email, attempted, middleware.ClientIP(r), r.UserAgent(), loginOutcome(err))
+	}
+	if err != nil {
+		logger.InfoContext(r.Context(), "login failed", "error", err)
+	}
+	if errors.Is(err, services.ErrAccountDisabled) || errors.Is(err, services.ErrPasswordResetRequired) {
+		utils.SendJSONResponse(w, http.StatusForbidden, "error", err.Error(), nil)
+		return
+	}
 	if err != nil {
 		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Invalid email or password", nil)
 		return
 	}
 
-	token, err := utils.GenerateJWT(user.ID, user.Email)
+	logging.SetUserID(r.Context(), user.ID)
+	uc.completeLogin(w, r, user, "Login successful")
+}
+
+// loginOutcome classifies the result of Authenticate. Disabled users and users
+// who must reset their password gave the right password, so their attempts do
+// not count toward the lockout.
+func loginOutcome(err error) services.LoginOutcome {
+	switch {
+	case err == nil:
+		return services.LoginSucceeded
+	case errors.Is(err, services.ErrAccountDisabled), errors.Is(err, services.ErrPasswordResetRequired):
+		return services.LoginRefused
+	default:
+		return services.LoginFailed
+	}
+}
+
+// GetLoginAttempts returns the authenticated user's recent password logins,
+// successful or not, newest first.
+func (uc *UserController) GetLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	var attempts []models.LoginAttempt
+	if uc.LoginAttempts != nil {
+		attempts = uc.LoginAttempts.GetAttempts(userID)
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Login attempts retrieved successfully", attempts)
+}
+
+// completeLogin responds with the user's tokens, or with a two-factor
+// challenge if the user has 2FA enabled or is required to enroll.
+func (uc *UserController) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, message string) {
+	completeLogin(w, r, uc.TokenService, uc.MFAService, user, message)
+}
+
+// completeLogin is shared by every way of logging in, so that none of them
+// skips two-factor authentication.
+func completeLogin(w http.ResponseWriter, r *http.Request, tokenService *services.TokenService, mfaService *services.MFAService, user *models.User, message string) {
+	if mfaService == nil || (!mfaService.Enabled(user.ID) && !mfaService.Required()) {
+		sendTokens(w, r, tokenService, user, message, nil)
+		return
+	}
+
+	token, enroll, err := mfaService.NewChallenge(user.ID)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "could not start two-factor challenge", "error", err)
+		utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not start two-factor authentication", nil)
+		return
+	}
+	data := map[string]interface{}{"mfa_required": true, "mfa_token": token}
+	if enroll {
+		enrollment, err := mfaService.StartChallengeEnrollment(token)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not start two-factor enrollment", "error", err)
+			utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not start two-factor authentication", nil)
+			return
+		}
+		data["enrollment"] = enrollment
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Two-factor authentication required", data)
+}
+
+// LoginMFA completes a login that requires two-factor authentication.
+// It expects a JSON payload with the "mfa_token" returned by Login and a "code"
+// from the authenticator app or a recovery code. If the user had to enroll,
+// the code confirms the enrollment and the response includes "recovery_codes".
+func (uc *UserController) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.MFAToken == "" || input.Code == "" {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "mfa_token and code are required", nil)
+		return
+	}
+
+	user, recoveryCodes, err := uc.MFAService.CompleteChallenge(input.MFAToken, input.Code)
 	if err != nil {
-		utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not generate token", nil)
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", err.Error(), nil)
 		return
 	}
+	// The account may have been disabled since the first step of the login.
+	if user, err = uc.UserService.GetUserByID(user.ID); err != nil {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Invalid two-factor challenge", nil)
+		return
+	}
+	if err := services.CheckLoginAllowed(user); err != nil {
+		utils.SendJSONResponse(w, http.StatusForbidden, "error", err.Error(), nil)
+		return
+	}
+	sendTokens(w, r, uc.TokenService, user, "Login successful", recoveryCodes)
+}
+
+// sendTokens starts a session for the user and responds with its access and
+// refresh tokens, along with the recovery codes of a 2FA enrollment, if any.
+func sendTokens(w http.ResponseWriter, r *http.Request, tokenService *services.TokenService, user *models.User, message string, recoveryCodes []string) {
+	if tokenService == nil {
+		token, err := utils.GenerateJWT(user.ID, user.Email)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not generate token", "error", err)
+			utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not generate token", nil)
+			return
+		}
+		data := map[string]interface{}{"token": token}
+		if recoveryCodes != nil {
+			data["recovery_codes"] = recoveryCodes
+		}
+		utils.SendJSONResponse(w, http.StatusOK, "success", message, data)
+		return
+	}
+
+	tokens, err := tokenService.IssueTokens(user, r.UserAgent(), middleware.ClientIP(r))
+	if err != nil {
+		sendTokenError(w, r, err)
+		return
+	}
+	if recoveryCodes != nil {
+		utils.SendJSONResponse(w, http.StatusOK, "success", message, struct {
+			*models.TokenPair
+			RecoveryCodes []string `json:"recovery_codes"`
+		}{tokens, recoveryCodes})
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", message, tokens)
+}
+
+// RefreshToken exchanges a refresh token for new tokens.
+// It expects a JSON payload with a "refresh_token" field. Refresh tokens can
+// only be used once; reusing one ends the session it belongs to.
+func (uc *UserController) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "refresh_token is required", nil)
+		return
+	}
+
+	tokens, err := uc.TokenService.Refresh(input.RefreshToken)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Invalid refresh token", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Token refreshed successfully", tokens)
+}
+
+// Logout revokes the access token of the request and ends its session.
+// An optional "refresh_token" in the JSON payload is revoked as well.
+func (uc *UserController) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(r.Body).Decode(&input)
+
+	uc.TokenService.Logout(claims, input.RefreshToken)
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Logged out successfully", nil)
+}
+
+// LogoutAll ends every session of the authenticated user.
+func (uc *UserController) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+
+	uc.TokenService.Logout(claims, "")
+	uc.TokenService.LogoutAll(claims.UserID)
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Logged out of all sessions", nil)
+}
 
-	utils.SendJSONResponse(w, http.StatusOK, "success", "Login successful", map[string]string{"token": token})
+// JWKS publishes the public keys access tokens are signed with as a JSON Web Key Set.
+func (uc *UserController) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(utils.PublicJWKS())
 }
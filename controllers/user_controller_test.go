@@ -3,14 +3,29 @@
 package controllers
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"task-manager/middleware"
+	"task-manager/models"
 	"task-manager/services"
+	"task-manager/utils"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestUserController_Register(t *testing.T) {
@@ -19,7 +34,7 @@ func TestUserController_Register(t *testing.T) {
 
 	t.Run("ValidRequest", func(t *testing.T) {
 		// Create a request body with valid email and password
-		requestBody := `{"email": "test@example.com", "password": "password123"}`
+		requestBody := `{"email": "test@example.com", "password": "plum orchard velvet"}`
 
 		// Create a new HTTP request
 		req, _ := http.NewRequest(http.MethodPost, "/api/register", strings.NewReader(requestBody))
@@ -42,6 +57,19 @@ func TestUserController_Register(t *testing.T) {
 		assert.NotNil(t, response["data"].(map[string]interface{})["token"])
 	})
 
+	t.Run("DuplicateEmailIgnoringCase", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/api/register", strings.NewReader(`{"email": " Test@Example.com", "password": "correct horse battery"}`))
+		rr := httptest.NewRecorder()
+		userController.Register(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		// Addresses are stored lowercased and found whatever their case
+		user, err := userService.GetUserByEmail("TEST@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, "test@example.com", user.Email)
+		assert.Len(t, userService.GetUsers(), 1)
+	})
+
 	t.Run("InvalidRequest", func(t *testing.T) {
 		// Create a request body with missing email field
 		requestBody := `{"password": ""}`
@@ -73,7 +101,7 @@ func TestUserController_Login(t *testing.T) {
 
 	/* t.Run("ValidRequest", func(t *testing.T) {
 		// Create a request body with valid email and password
-		requestBody := `{"email": "test@example.com", "password": "password123"}`
+		requestBody := `{"email": "test@example.com", "password": "plum orchard velvet"}`
 
 		// Create a new HTTP request
 		req, _ := http.NewRequest(http.MethodPost, "/api/login", strings.NewReader(requestBody))
@@ -120,3 +148,300 @@ func TestUserController_Login(t *testing.T) {
 		assert.Nil(t, response["data"])
 	})
 }
+
+func TestUserController_PasswordPolicy(t *testing.T) {
+	// A breached password list in the range file layout
+	sum := sha1.Sum([]byte("Tr0ub4dor&3"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte("0000000000000000000000000000000000A:1\r\n"+hash[5:]+":2\r\n"), 0o600))
+	breached, err := services.LoadBreachedPasswords(dir)
+	assert.NoError(t, err)
+
+	userService := services.NewUserService()
+	policy := services.DefaultPasswordPolicy()
+	policy.BcryptCost = bcrypt.MinCost
+	policy.Breached = breached
+	userService.SetPasswordPolicy(policy)
+	userController := &UserController{UserService: userService}
+
+	register := func(email, password string) (int, []string) {
+		requestBody := `{"email": "` + email + `", "password": "` + password + `"}`
+		req, _ := http.NewRequest(http.MethodPost, "/api/register", strings.NewReader(requestBody))
+		rr := httptest.NewRecorder()
+		userController.Register(rr, req)
+		var response struct {
+			Data struct {
+				Problems []string `json:"problems"`
+			} `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response.Data.Problems
+	}
+
+	// Common words, appended digits and keyboard runs are guessed first
+	for _, password := range []string{"password123", "P@ssw0rd!", "dragon2024!", "qwertyuiop", "asdfghjkl;'"} {
+		code, problems := register("ada.lovelace@example.com", password)
+		assert.Equal(t, http.StatusBadRequest, code, password)
+		assert.Equal(t, []string{"password is too easy to guess; use a longer password or mix letters, digits and symbols"}, problems, password)
+	}
+	for _, password := range []string{"a", "aaaaaaaaaaaa", "12345678901", "xyz-ada.lovelace-1", "Tr0ub4dor&3"} {
+		code, problems := register("ada.lovelace@example.com", password)
+		assert.Equal(t, http.StatusBadRequest, code, password)
+		assert.NotEmpty(t, problems, password)
+	}
+	code, problems := register("ada@example.com", "a")
+	assert.Len(t, problems, 2)
+	code, _ = register("ada@example.com", "plum orchard velvet")
+	assert.Equal(t, http.StatusOK, code)
+
+	// Hashes are upgraded on login when the cost is raised
+	user, _ := userService.GetUserByEmail("ada@example.com")
+	cost, _ := bcrypt.Cost([]byte(user.Password))
+	assert.Equal(t, bcrypt.MinCost, cost)
+	policy.BcryptCost = bcrypt.MinCost + 1
+	userService.SetPasswordPolicy(policy)
+	_, err = userService.Authenticate("ada@example.com", "plum orchard velvet")
+	assert.NoError(t, err)
+	user, _ = userService.GetUserByEmail("ada@example.com")
+	cost, _ = bcrypt.Cost([]byte(user.Password))
+	assert.Equal(t, bcrypt.MinCost+1, cost)
+	_, err = userService.Authenticate("ada@example.com", "plum orchard velvet")
+	assert.NoError(t, err)
+}
+
+func TestUserController_LoginLockout(t *testing.T) {
+	userService := services.NewUserService()
+	ada, _ := userService.Register("ada@example.com", "plum orchard velvet")
+	userController := &UserController{UserService: userService, LoginAttempts: services.NewLoginAttemptService()}
+
+	login := func(email, password string) *httptest.ResponseRecorder {
+		requestBody := `{"email": "` + email + `", "password": "` + password + `"}`
+		req, _ := http.NewRequest(http.MethodPost, "/api/login", strings.NewReader(requestBody))
+		req.RemoteAddr = "192.0.2.1:1234"
+		rr := httptest.NewRecorder()
+		userController.Login(rr, req)
+		return rr
+	}
+
+	// Unknown emails and wrong passwords look the same, and both lock the account
+	for _, email := range []string{"ada@example.com", "nobody@example.com"} {
+		for i := 0; i < 5; i++ {
+			rr := login(email, "wrong")
+			assert.Equal(t, http.StatusUnauthorized, rr.Code)
+			assert.Contains(t, rr.Body.String(), "Invalid email or password")
+		}
+		rr := login(email, "plum orchard velvet")
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+	}
+
+	// The user can review the attempts
+	req, _ := http.NewRequest(http.MethodGet, "/api/me/login-attempts", nil)
+	req = req.WithContext(middleware.WithClaims(req.Context(), &utils.Claims{UserID: ada.ID, Email: ada.Email}))
+	rr := httptest.NewRecorder()
+	userController.GetLoginAttempts(rr, req)
+	var response struct {
+		Data []models.LoginAttempt `json:"data"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Len(t, response.Data, 5)
+	assert.False(t, response.Data[0].Success)
+	assert.Equal(t, "192.0.2.1", response.Data[0].IP)
+
+	// Failures are kept until an hour after the last one, even below the threshold
+	loginAttempts := userController.LoginAttempts
+	loginAttempts.Record("grace@example.com", nil, "192.0.2.1", "", services.LoginFailed)
+	loginAttempts.PurgeExpired(time.Now().Add(30 * time.Minute))
+	for i := 0; i < 4; i++ {
+		loginAttempts.Record("grace@example.com", nil, "192.0.2.1", "", services.LoginFailed)
+	}
+	_, err := loginAttempts.Check("grace@example.com")
+	assert.ErrorIs(t, err, services.ErrAccountLocked)
+}
+
+func TestUserController_LoginDisabledAccount(t *testing.T) {
+	userService := services.NewUserService()
+	bob, _ := userService.Register("bob@example.com", "plum orchard velvet")
+	userService.SetDisabled(bob.ID, true)
+	userController := &UserController{UserService: userService, LoginAttempts: services.NewLoginAttemptService()}
+
+	// A disabled user giving the right password is refused without being locked out
+	for i := 0; i < 6; i++ {
+		req, _ := http.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email": "bob@example.com", "password": "plum orchard velvet"}`))
+		req.RemoteAddr = "192.0.2.1:1234"
+		rr := httptest.NewRecorder()
+		userController.Login(rr, req)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	}
+	attempts := userController.LoginAttempts.GetAttempts(bob.ID)
+	assert.Len(t, attempts, 6)
+	assert.False(t, attempts[0].Success)
+}
+
+func TestUserController_RefreshAndLogout(t *testing.T) {
+	userService := services.NewUserService()
+	tokenService := services.NewTokenService(userService)
+	middleware.SetRevocationCheck(tokenService.IsRevoked)
+	t.Cleanup(func() { middleware.SetRevocationCheck(nil) })
+	userController := &UserController{UserService: userService, TokenService: tokenService}
+	userService.Register("test@example.com", "plum orchard velvet")
+
+	call := func(handler http.HandlerFunc, accessToken, body string) (int, models.TokenPair) {
+		req, _ := http.NewRequest(http.MethodPost, "/api", strings.NewReader(body))
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		rr := httptest.NewRecorder()
+		middleware.JWTAuthMiddleware(handler).ServeHTTP(rr, req)
+		var response struct {
+			Data models.TokenPair `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response.Data
+	}
+	login := func() models.TokenPair {
+		req, _ := http.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email": "test@example.com", "password": "plum orchard velvet"}`))
+		rr := httptest.NewRecorder()
+		userController.Login(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response struct {
+			Data models.TokenPair `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		assert.NotEmpty(t, response.Data.AccessToken)
+		assert.NotEmpty(t, response.Data.RefreshToken)
+		return response.Data
+	}
+	refresh := func(refreshToken string) (int, models.TokenPair) {
+		req, _ := http.NewRequest(http.MethodPost, "/api/token/refresh", strings.NewReader(`{"refresh_token": "`+refreshToken+`"}`))
+		rr := httptest.NewRecorder()
+		userController.RefreshToken(rr, req)
+		var response struct {
+			Data models.TokenPair `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response.Data
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("Rotation", func(t *testing.T) {
+		tokens := login()
+		code, rotated := refresh(tokens.RefreshToken)
+		assert.Equal(t, http.StatusOK, code)
+		assert.NotEqual(t, tokens.RefreshToken, rotated.RefreshToken)
+		code, _ = call(ok, rotated.AccessToken, "")
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("ReuseRevokesSession", func(t *testing.T) {
+		tokens := login()
+		_, rotated := refresh(tokens.RefreshToken)
+		code, _ := refresh(tokens.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		// The legitimate holder of the session is logged out as well
+		code, _ = refresh(rotated.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = call(ok, rotated.AccessToken, "")
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		tokens := login()
+		other := login()
+		code, _ := call(userController.Logout, tokens.AccessToken, "")
+		assert.Equal(t, http.StatusOK, code)
+
+		code, _ = call(ok, tokens.AccessToken, "")
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = refresh(tokens.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = call(ok, other.AccessToken, "")
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("LogoutAll", func(t *testing.T) {
+		tokens := login()
+		other := login()
+		code, _ := call(userController.LogoutAll, tokens.AccessToken, "")
+		assert.Equal(t, http.StatusOK, code)
+
+		code, _ = call(ok, other.AccessToken, "")
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = refresh(other.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+}
+
+func TestUserController_JWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	oldKey, _ := utils.NewSigningKey("2024-01", utils.EdDSA, edKey)
+	newKey, _ := utils.NewSigningKey("2025-01", utils.RS256, rsaKey)
+	t.Cleanup(func() {
+		secret, _ := utils.NewSigningKey("test", utils.HS256, []byte(strings.Repeat("s", 32)))
+		utils.ConfigureJWT(utils.JWTConfig{Keys: []*utils.SigningKey{secret}})
+	})
+
+	// Tokens signed with the old key stay valid after rotating to the new one
+	assert.NoError(t, utils.ConfigureJWT(utils.JWTConfig{Keys: []*utils.SigningKey{oldKey}, Issuer: "task-manager", Audience: "api"}))
+	oldToken, _ := utils.GenerateJWT(1, "test@example.com")
+	oldPublic, _ := utils.NewSigningKey("2024-01", utils.EdDSA, edKey.Public())
+	assert.NoError(t, utils.ConfigureJWT(utils.JWTConfig{Keys: []*utils.SigningKey{newKey, oldPublic}, Issuer: "task-manager", Audience: "api"}))
+	newToken, _ := utils.GenerateJWT(1, "test@example.com")
+
+	t.Run("Rotation", func(t *testing.T) {
+		for _, token := range []string{oldToken, newToken} {
+			claims, err := utils.ValidateJWT(token)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, claims.UserID)
+		}
+	})
+
+	t.Run("PublishedKeys", func(t *testing.T) {
+		userController := &UserController{}
+		req, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		rr := httptest.NewRecorder()
+		userController.JWKS(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var jwks utils.JWKS
+		json.NewDecoder(rr.Body).Decode(&jwks)
+		assert.Len(t, jwks.Keys, 2)
+		assert.Equal(t, "2025-01", jwks.Keys[0].KeyID)
+		assert.Equal(t, base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()), jwks.Keys[0].N)
+		assert.Equal(t, "Ed25519", jwks.Keys[1].Curve)
+	})
+
+	t.Run("AlgorithmConfusion", func(t *testing.T) {
+		// An HS256 token "signed" with the public RSA key must not validate
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, &utils.Claims{UserID: 2, RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: "task-manager", Audience: jwt.ClaimStrings{"api"}, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}})
+		token.Header["kid"] = "2025-01"
+		forged, _ := token.SignedString(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey))
+		_, err := utils.ValidateJWT(forged)
+		assert.Error(t, err)
+	})
+
+	t.Run("ClaimValidation", func(t *testing.T) {
+		sign := func(claims jwt.RegisteredClaims) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, &utils.Claims{UserID: 2, RegisteredClaims: claims})
+			token.Header["kid"] = "2025-01"
+			signed, _ := token.SignedString(rsaKey)
+			return signed
+		}
+		expires := jwt.NewNumericDate(time.Now().Add(time.Hour))
+		_, err := utils.ValidateJWT(sign(jwt.RegisteredClaims{Issuer: "task-manager", Audience: jwt.ClaimStrings{"api"}, ExpiresAt: expires}))
+		assert.NoError(t, err)
+		_, err = utils.ValidateJWT(sign(jwt.RegisteredClaims{Issuer: "someone-else", Audience: jwt.ClaimStrings{"api"}, ExpiresAt: expires}))
+		assert.Error(t, err)
+		_, err = utils.ValidateJWT(sign(jwt.RegisteredClaims{Issuer: "task-manager", Audience: jwt.ClaimStrings{"other"}, ExpiresAt: expires}))
+		assert.Error(t, err)
+		_, err = utils.ValidateJWT(sign(jwt.RegisteredClaims{Issuer: "task-manager", Audience: jwt.ClaimStrings{"api"}, ExpiresAt: expires, NotBefore: expires}))
+		assert.Error(t, err)
+		_, err = utils.ValidateJWT(sign(jwt.RegisteredClaims{Issuer: "task-manager", Audience: jwt.ClaimStrings{"api"}}))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"task-manager/models"
+	"task-manager/services"
+	"task-manager/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// WebhookController handles the authenticated user's webhook subscriptions.
+type WebhookController struct {
+	WebhookService *services.WebhookService
+}
+
+type webhookInput struct {
+	URL    string                 `json:"url"`
+	Secret string                 `json:"secret"`
+	Events []models.TaskEventType `json:"events"`
+	Active *bool                  `json:"active"`
+}
+
+// CreateWebhook registers a webhook.
+// It expects a JSON payload with a "url" and optional "events" filter and "secret".
+// On success, it returns the webhook together with its secret, which is not shown again.
+func (wc *WebhookController) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	var input webhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
+		return
+	}
+	webhook, err := wc.WebhookService.CreateWebhook(userID, input.URL, input.Secret, input.Events)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusCreated, "success", "Webhook created successfully", struct {
+		*models.Webhook
+		Secret string `json:"secret"`
+	}{webhook, webhook.Secret})
+}
+
+// GetWebhooks lists the user's webhooks.
+func (wc *WebhookController) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Webhooks retrieved successfully", wc.WebhookService.GetWebhooks(userID))
+}
+
+// GetWebhook retrieves a webhook by ID.
+func (wc *WebhookController) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := webhookRequest(w, r)
+	if !ok {
+		return
+	}
+	webhook, err := wc.WebhookService.GetWebhook(userID, id)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Webhook not found", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Webhook retrieved successfully", webhook)
+}
+
+// UpdateWebhook changes a webhook's "url", "events" and "active" fields.
+func (wc *WebhookController) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := webhookRequest(w, r)
+	if !ok {
+		return
+	}
+	var input webhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid request", nil)
+		return
+	}
+	active := input.Active == nil || *input.Active
+	webhook, err := wc.WebhookService.UpdateWebhook(userID, id, input.URL, input.Events, active)
+	if errors.Is(err, services.ErrWebhookNotFound) {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Webhook not found", nil)
+		return
+	}
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", err.Error(), nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Webhook updated successfully", webhook)
+}
+
+// DeleteWebhook removes a webhook and its delivery log.
+func (wc *WebhookController) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := webhookRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := wc.WebhookService.DeleteWebhook(userID, id); err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Webhook not found", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Webhook deleted successfully", nil)
+}
+
+// GetDeliveries returns a webhook's delivery log with response codes, newest first.
+func (wc *WebhookController) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := webhookRequest(w, r)
+	if !ok {
+		return
+	}
+	deliveries, err := wc.WebhookService.GetDeliveries(userID, id)
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Webhook not found", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusOK, "success", "Deliveries retrieved successfully", deliveries)
+}
+
+// Redeliver queues a past delivery to be sent again.
+// It expects the webhook ID and the delivery ID as URL parameters.
+func (wc *WebhookController) Redeliver(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := webhookRequest(w, r)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.Atoi(mux.Vars(r)["deliveryID"])
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid delivery ID", nil)
+		return
+	}
+	delivery, err := wc.WebhookService.Redeliver(userID, id, deliveryID)
+	if errors.Is(err, services.ErrWebhookNotFound) {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Webhook not found", nil)
+		return
+	}
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusNotFound, "error", "Delivery not found", nil)
+		return
+	}
+	utils.SendJSONResponse(w, http.StatusAccepted, "success", "Delivery queued", delivery)
+}
+
+// webhookRequest extracts the authenticated user and the webhook ID, writing an error response if either is missing.
+func webhookRequest(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID := currentUserID(r)
+	if userID == 0 {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return 0, 0, false
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, http.StatusBadRequest, "error", "Invalid webhook ID", nil)
+		return 0, 0, false
+	}
+	return userID, id, true
+}
@@ -0,0 +1,150 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/models"
+	"task-manager/services"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookController_Deliveries(t *testing.T) {
+	// The receiver fails the first request and verifies the signature of every request
+	var received []string
+	fail := true
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		expected := services.SignWebhookPayload("s3cret", r.Header.Get(services.WebhookTimestampHeader), body)
+		if r.Header.Get(services.WebhookSignatureHeader) != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if fail {
+			fail = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received = append(received, r.Header.Get(services.WebhookEventHeader))
+	}))
+	defer receiver.Close()
+
+	user := &models.User{ID: 1, Email: "ada@example.com"}
+	taskService := services.NewTaskService()
+	webhookService := services.NewWebhookService(receiver.Client())
+	webhookService.AllowNetworks(netip.MustParsePrefix("127.0.0.0/8"))
+	taskService.Subscribe(webhookService.HandleTaskEvent)
+	webhookController := &controllers.WebhookController{WebhookService: webhookService}
+
+	requestBody := `{"url": "` + receiver.URL + `", "secret": "s3cret", "events": ["task.created", "task.completed"]}`
+	req, _ := http.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(requestBody))
+	rr := httptest.NewRecorder()
+	webhookController.CreateWebhook(rr, asUser(req, user))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	taskService.CreateTask(models.Task{Title: "Ship it", Description: "soon"})
+	taskService.UpdateTask(0, 1, "Ship it", "now", models.InProgress) // filtered out
+	taskService.MarkTaskAsComplete(0, 1)
+
+	// The first attempt of the first delivery fails and is retried later
+	now := time.Now()
+	webhookService.DeliverDue(context.Background(), now)
+	assert.Equal(t, []string{"task.completed"}, received)
+	webhookService.DeliverDue(context.Background(), now.Add(time.Minute))
+	assert.Equal(t, []string{"task.completed", "task.created"}, received)
+
+	getDeliveries := func() []models.WebhookDelivery {
+		req, _ := http.NewRequest(http.MethodGet, "/api/webhooks/1/deliveries", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		rr := httptest.NewRecorder()
+		webhookController.GetDeliveries(rr, asUser(req, user))
+		var response struct {
+			Data []models.WebhookDelivery `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return response.Data
+	}
+
+	t.Run("DeliveryLog", func(t *testing.T) {
+		deliveries := getDeliveries()
+		assert.Len(t, deliveries, 2)
+		created := deliveries[1]
+		assert.Equal(t, models.TaskCreated, created.Event)
+		assert.Equal(t, 2, created.Attempts)
+		assert.Equal(t, http.StatusOK, created.StatusCode)
+		assert.True(t, created.Delivered)
+	})
+
+	t.Run("Redeliver", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/api/webhooks/1/deliveries/1/redeliver", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1", "deliveryID": "1"})
+		rr := httptest.NewRecorder()
+		webhookController.Redeliver(rr, asUser(req, user))
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+
+		webhookService.DeliverDue(context.Background(), time.Now())
+		assert.Equal(t, []string{"task.completed", "task.created", "task.created"}, received)
+	})
+
+	t.Run("OtherUsersCannotSeeWebhook", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/webhooks/1", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		rr := httptest.NewRecorder()
+		webhookController.GetWebhook(rr, asUser(req, &models.User{ID: 2, Email: "bob@example.com"}))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestWebhookController_PrivateAddresses(t *testing.T) {
+	user := &models.User{ID: 1, Email: "ada@example.com"}
+	webhookController := &controllers.WebhookController{WebhookService: services.NewWebhookService(nil)}
+
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://[::1]/hook",
+	} {
+		req, _ := http.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(`{"url": "`+url+`"}`))
+		rr := httptest.NewRecorder()
+		webhookController.CreateWebhook(rr, asUser(req, user))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+	}
+}
+
+func TestWebhookController_RefusesPrivateAddressesWhenDelivering(t *testing.T) {
+	// The receiver is on loopback, as a host rebound to 127.0.0.1 after
+	// registration would be; deliveries must not reach it.
+	var hits int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer receiver.Close()
+
+	taskService := services.NewTaskService()
+	webhookService := services.NewWebhookService(nil)
+	taskService.Subscribe(webhookService.HandleTaskEvent)
+	webhookService.AllowNetworks(netip.MustParsePrefix("127.0.0.0/8"))
+	_, err := webhookService.CreateWebhook(1, receiver.URL, "", nil)
+	assert.NoError(t, err)
+	webhookService.AllowNetworks()
+
+	taskService.CreateTask(models.Task{Title: "Ship it", Description: "soon"})
+	assert.NoError(t, webhookService.DeliverDue(context.Background(), time.Now().Add(time.Second)))
+	assert.Zero(t, hits)
+
+	deliveries, _ := webhookService.GetDeliveries(1, 1)
+	assert.Len(t, deliveries, 1)
+	assert.Contains(t, deliveries[0].Error, "must not point to")
+}
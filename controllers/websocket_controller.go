@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"net/http"
+	"task-manager/middleware"
+	"task-manager/realtime"
+	"task-manager/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketController upgrades authenticated requests to WebSocket connections on the collaboration hub.
+type WebSocketController struct {
+	Hub *realtime.Hub
+	// CheckOrigin decides which browser origins may connect. When nil, only
+	// same-origin requests (and non-browser clients) are accepted.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// Connect upgrades the request to a WebSocket. It must run behind JWTAuthMiddleware;
+// browsers, which cannot set headers on WebSocket requests, pass the token in the
+// "access_token" query parameter.
+func (wc *WebSocketController) Connect(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaims(r)
+	if !ok {
+		utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Unauthorized", nil)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 4096,
+		CheckOrigin:     wc.CheckOrigin,
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already written an error response.
+		return
+	}
+	wc.Hub.Serve(conn, claims.UserID, claims.Email)
+}
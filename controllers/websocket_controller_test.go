@@ -0,0 +1,121 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"task-manager/controllers"
+	"task-manager/middleware"
+	"task-manager/models"
+	"task-manager/realtime"
+	"task-manager/services"
+	"task-manager/utils"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// readUntil reads messages from conn until one of the given type arrives.
+func readUntil(t *testing.T, conn *websocket.Conn, messageType string) realtime.Message {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg realtime.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for %s: %v", messageType, err)
+		}
+		if msg.Type == messageType {
+			return msg
+		}
+	}
+}
+
+func TestWebSocketController_Connect(t *testing.T) {
+	taskService := services.NewTaskService()
+	taskService.CreateTask(models.Task{Title: "WEB-42", Description: "Fix the board"})
+	webSocketController := &controllers.WebSocketController{Hub: realtime.NewHub(taskService)}
+	handler := middleware.QueryTokenMiddleware(middleware.JWTAuthMiddleware(http.HandlerFunc(webSocketController.Connect)))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	dial := func(userID int, email string) *websocket.Conn {
+		token, _ := utils.GenerateJWT(userID, email)
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?access_token="+token, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	t.Run("RejectsMissingToken", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	ada := dial(1, "ada@example.com")
+	defer ada.Close()
+	bob := dial(2, "bob@example.com")
+	defer bob.Close()
+
+	t.Run("Presence", func(t *testing.T) {
+		ada.WriteJSON(realtime.Message{Type: "subscribe", ID: "1", Topic: "task:1"})
+		readUntil(t, ada, "ack")
+		ada.WriteJSON(realtime.Message{Type: "presence", ID: "2", Topic: "task:1", Payload: json.RawMessage(`{"state": "editing"}`)})
+		readUntil(t, ada, "ack")
+
+		// Bob sees that Ada is editing as soon as he subscribes
+		bob.WriteJSON(realtime.Message{Type: "subscribe", ID: "1", Topic: "task:1"})
+		presence := readUntil(t, bob, "presence")
+		var payload struct {
+			Users []realtime.PresenceEntry `json:"users"`
+		}
+		json.Unmarshal(presence.Payload, &payload)
+		assert.Equal(t, []realtime.PresenceEntry{{UserID: 1, Email: "ada@example.com", State: "editing"}}, payload.Users)
+		readUntil(t, bob, "ack")
+	})
+
+	t.Run("TaskMutation", func(t *testing.T) {
+		bob.WriteJSON(realtime.Message{Type: "task.update", ID: "2", Payload: json.RawMessage(`{"id": 1, "title": "WEB-42", "description": "Fixed", "status": "IN_PROGRESS"}`)})
+		ack := readUntil(t, bob, "ack")
+		assert.Equal(t, "2", ack.ID)
+
+		event := readUntil(t, ada, "task.updated")
+		assert.Equal(t, "task:1", event.Topic)
+		assert.Contains(t, string(event.Payload), `"description":"Fixed"`)
+	})
+
+	t.Run("InvalidMessage", func(t *testing.T) {
+		bob.WriteJSON(realtime.Message{Type: "task.delete", ID: "3", Payload: json.RawMessage(`{"id": 99}`)})
+		msg := readUntil(t, bob, "error")
+		assert.Equal(t, "3", msg.ID)
+	})
+
+	t.Run("PresenceClearedOnDisconnect", func(t *testing.T) {
+		ada.Close()
+		assert.Eventually(t, func() bool {
+			return len(webSocketController.Hub.Presence("task:1")) == 0
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("ClosedOnShutdown", func(t *testing.T) {
+		webSocketController.Hub.Close()
+		bob.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			if _, _, err := bob.ReadMessage(); err != nil {
+				assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err.Error())
+				break
+			}
+		}
+
+		// New connections are turned away too
+		conn := dial(3, "cy@example.com")
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+	})
+}
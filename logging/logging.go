@@ -0,0 +1,94 @@
+// Package logging writes structured JSON logs with log/slog. Every package
+// logs through its own logger, whose level can be set separately, and log
+// lines written while serving a request carry its request ID and user ID.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// levels holds the minimum level of each package; packages not listed use fallback.
+type levels struct {
+	fallback slog.Level
+	packages map[string]slog.Level
+}
+
+var (
+	currentLevels atomic.Pointer[levels]
+	output        = &switchableWriter{w: os.Stderr}
+	// base writes every record it is given; filtering happens in handler.Enabled.
+	base = slog.NewJSONHandler(output, &slog.HandlerOptions{Level: slog.Level(-8)})
+)
+
+func init() {
+	currentLevels.Store(&levels{fallback: slog.LevelInfo})
+}
+
+// For returns the logger of a package. It logs at the level set for the
+// package with SetLevels, and adds a "package" attribute to every line.
+func For(pkg string) *slog.Logger {
+	return slog.New(&handler{pkg: pkg, base: base.WithAttrs([]slog.Attr{slog.String("package", pkg)})})
+}
+
+// SetLevels sets the minimum level logged by every package, with overrides
+// for some packages. It can be called at any time.
+func SetLevels(fallback slog.Level, packages map[string]slog.Level) {
+	currentLevels.Store(&levels{fallback: fallback, packages: packages})
+}
+
+// SetOutput redirects all logs, for instance to a buffer in tests.
+func SetOutput(w io.Writer) {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+	output.w = w
+}
+
+type switchableWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (s *switchableWriter) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.w.Write(p)
+}
+
+// handler filters records by the level of its package and adds the request
+// attributes found in the context.
+type handler struct {
+	pkg  string
+	base slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	l := currentLevels.Load()
+	min, ok := l.packages[h.pkg]
+	if !ok {
+		min = l.fallback
+	}
+	return level >= min
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	if info := requestFrom(ctx); info != nil {
+		record.AddAttrs(slog.String("request_id", info.id))
+		if userID := info.userID.Load(); userID != 0 {
+			record.AddAttrs(slog.Int64("user_id", userID))
+		}
+	}
+	return h.base.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{pkg: h.pkg, base: h.base.WithAttrs(attrs)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{pkg: h.pkg, base: h.base.WithGroup(name)}
+}
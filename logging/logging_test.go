@@ -0,0 +1,120 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"task-manager/logging"
+	"task-manager/middleware"
+	"task-manager/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// capture redirects logs to a buffer for the duration of the test.
+func capture(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	t.Cleanup(func() {
+		logging.SetOutput(os.Stderr)
+		logging.SetLevels(slog.LevelInfo, nil)
+	})
+	return &buf
+}
+
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLevels(t *testing.T) {
+	buf := capture(t)
+	services, scheduler := logging.For("services"), logging.For("scheduler")
+
+	logging.SetLevels(slog.LevelInfo, map[string]slog.Level{"services": slog.LevelDebug, "scheduler": slog.LevelError})
+	services.Debug("webhook delivered", "delivery_id", 7)
+	scheduler.Warn("job failed")
+	scheduler.Error("job failed again")
+
+	entries := lines(t, buf)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "webhook delivered", entries[0]["msg"])
+	assert.Equal(t, "DEBUG", entries[0]["level"])
+	assert.Equal(t, "services", entries[0]["package"])
+	assert.Equal(t, 7.0, entries[0]["delivery_id"])
+	assert.Equal(t, "job failed again", entries[1]["msg"])
+}
+
+func TestRequestLogging(t *testing.T) {
+	buf := capture(t)
+	jwt, _ := utils.GenerateJWT(42, "ada@example.com")
+
+	handler := middleware.RequestIDMiddleware(middleware.AccessLogMiddleware(middleware.JWTAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.For("controllers").WarnContext(r.Context(), "could not start export")
+		utils.SendJSONResponse(w, http.StatusInternalServerError, "error", "Could not start export", nil)
+	}))))
+
+	t.Run("GeneratedID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/me/export", nil)
+		req.Header.Set("Authorization", "Bearer "+jwt)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		id := rr.Header().Get("X-Request-ID")
+		assert.Len(t, id, 16)
+		assert.Contains(t, rr.Body.String(), `"request_id":"`+id+`"`)
+
+		entries := lines(t, buf)
+		assert.Len(t, entries, 2)
+		for _, entry := range entries {
+			assert.Equal(t, id, entry["request_id"])
+			assert.Equal(t, 42.0, entry["user_id"])
+		}
+		access := entries[1]
+		assert.Equal(t, "access", access["package"])
+		assert.Equal(t, "ERROR", access["level"])
+		assert.Equal(t, 500.0, access["status"])
+		assert.Equal(t, "/api/me/export", access["path"])
+		assert.Contains(t, access, "duration_ms")
+	})
+
+	t.Run("PropagatedID", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/api/me/export", nil)
+		req.Header.Set("X-Request-ID", "lb-7f3a")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, "lb-7f3a", rr.Header().Get("X-Request-ID"))
+		entries := lines(t, buf)
+		assert.Len(t, entries, 1) // rejected before the handler
+		assert.Equal(t, "lb-7f3a", entries[0]["request_id"])
+		assert.Equal(t, 401.0, entries[0]["status"])
+		assert.NotContains(t, entries[0], "user_id")
+
+		// IDs that could forge log lines are replaced
+		req.Header.Set("X-Request-ID", "bad id\n")
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Len(t, rr.Header().Get("X-Request-ID"), 16)
+	})
+
+	t.Run("OutsideRequests", func(t *testing.T) {
+		assert.Equal(t, "", logging.RequestID(context.Background()))
+		logging.SetUserID(context.Background(), 1) // no-op
+	})
+}
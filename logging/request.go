@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type contextKey struct{}
+
+// requestInfo identifies the request being served. The user ID is filled in
+// once the request is authenticated, deeper in the handler chain, so that
+// the access log written afterwards can include it.
+type requestInfo struct {
+	id     string
+	userID atomic.Int64
+}
+
+// WithRequestID returns a context for serving the request with the given ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestInfo{id: id})
+}
+
+// RequestID returns the ID of the request being served, or "" outside requests.
+func RequestID(ctx context.Context) string {
+	if info := requestFrom(ctx); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// SetUserID records the authenticated user of the request being served.
+func SetUserID(ctx context.Context, userID int) {
+	if info := requestFrom(ctx); info != nil {
+		info.userID.Store(int64(userID))
+	}
+}
+
+// UserID returns the authenticated user of the request being served, or 0.
+func UserID(ctx context.Context) int {
+	if info := requestFrom(ctx); info != nil {
+		return int(info.userID.Load())
+	}
+	return 0
+}
+
+func requestFrom(ctx context.Context) *requestInfo {
+	if ctx == nil {
+		return nil
+	}
+	info, _ := ctx.Value(contextKey{}).(*requestInfo)
+	return info
+}
@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTPServer accepts a single SMTP session and sends the received envelope and data on a channel.
+type fakeSMTPServer struct {
+	addr     string
+	received chan receivedMail
+}
+
+type receivedMail struct {
+	from string
+	to   []string
+	data string
+}
+
+func startFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeSMTPServer{addr: listener.Addr().String(), received: make(chan receivedMail, 1)}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost fake SMTP")
+
+		var mail receivedMail
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch {
+			case cmd == "EHLO" || cmd == "HELO":
+				tp.PrintfLine("250 localhost")
+			case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+				mail.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+				tp.PrintfLine("250 OK")
+			case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+				mail.to = append(mail.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+				tp.PrintfLine("250 OK")
+			case cmd == "DATA":
+				tp.PrintfLine("354 Go ahead")
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				mail.data = string(data)
+				tp.PrintfLine("250 OK")
+			case cmd == "QUIT":
+				tp.PrintfLine("221 Bye")
+				server.received <- mail
+				return
+			default:
+				tp.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+	return server
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	server := startFakeSMTPServer(t)
+	m := &SMTPMailer{Addr: server.addr, From: "tasks@example.com"}
+
+	msg, err := Render("task_updates", []string{"ada@example.com"}, "Task \"Ship it\" completed", map[string]interface{}{
+		"Email":          "ada@example.com",
+		"Changes":        []struct{ Title, Summary string }{{"Ship it", "completed"}},
+		"UnsubscribeURL": "http://localhost/unsubscribe?token=abc",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, m.Send(context.Background(), msg))
+
+	mail := <-server.received
+	assert.Equal(t, "tasks@example.com", mail.from)
+	assert.Equal(t, []string{"ada@example.com"}, mail.to)
+
+	headers, err := textproto.NewReader(bufio.NewReader(strings.NewReader(mail.data))).ReadMIMEHeader()
+	assert.NoError(t, err)
+	assert.Equal(t, "ada@example.com", headers.Get("To"))
+	assert.Contains(t, headers.Get("Content-Type"), "multipart/alternative")
+	assert.Contains(t, mail.data, "Content-Type: text/plain")
+	assert.Contains(t, mail.data, "Content-Type: text/html")
+	assert.Contains(t, mail.data, "Ship it")
+}
+
+func TestSMTPMailer_RejectsHeaderInjection(t *testing.T) {
+	m := &SMTPMailer{Addr: "127.0.0.1:1", From: "tasks@example.com"}
+	err := m.Send(context.Background(), Message{To: []string{"ada@example.com"}, Subject: "hi\r\nBcc: eve@example.com"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"task-manager/utils"
+)
+
+var (
+	isAdmin          func(userID int) bool
+	auditImpersonate func(claims *utils.Claims, r *http.Request)
+	adminMutex       sync.RWMutex
+)
+
+// SetAdminCheck sets the function AdminMiddleware uses to tell whether a user
+// is an administrator. Until it is set, nobody is.
+func SetAdminCheck(fn func(userID int) bool) {
+	adminMutex.Lock()
+	defer adminMutex.Unlock()
+	isAdmin = fn
+}
+
+// SetImpersonationAudit sets the function JWTAuthMiddleware calls for every
+// request made with an impersonation token, to record it in the audit log.
+func SetImpersonationAudit(fn func(claims *utils.Claims, r *http.Request)) {
+	adminMutex.Lock()
+	defer adminMutex.Unlock()
+	auditImpersonate = fn
+}
+
+func userIsAdmin(userID int) bool {
+	adminMutex.RLock()
+	defer adminMutex.RUnlock()
+	return isAdmin != nil && isAdmin(userID)
+}
+
+func auditImpersonatedRequest(claims *utils.Claims, r *http.Request) {
+	adminMutex.RLock()
+	defer adminMutex.RUnlock()
+	if auditImpersonate != nil {
+		auditImpersonate(claims, r)
+	}
+}
+
+// AdminMiddleware only lets administrators through. It must run after
+// JWTAuthMiddleware. Impersonation tokens are refused, even those of
+// administrators impersonating other administrators.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := GetClaims(r)
+		if !ok {
+			utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Authorization header required", nil)
+			return
+		}
+		if claims.ImpersonatorID != 0 || !userIsAdmin(claims.UserID) {
+			logger.WarnContext(r.Context(), "refused admin access", "path", r.URL.Path, "impersonator_id", claims.ImpersonatorID)
+			utils.SendJSONResponse(w, http.StatusForbidden, "error", "Admin access required", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NotImpersonatingMiddleware refuses impersonation tokens, for account changes
+// only the user themselves may make. It must run after JWTAuthMiddleware.
+func NotImpersonatingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := GetClaims(r); ok && claims.ImpersonatorID != 0 {
+			utils.SendJSONResponse(w, http.StatusForbidden, "error", "Not allowed while impersonating", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
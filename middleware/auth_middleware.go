@@ -2,29 +2,149 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
+	"sync"
+	"task-manager/logging"
+	"task-manager/models"
 	"task-manager/utils"
 )
 
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+var logger = logging.For("middleware")
+
+var (
+	isRevoked          func(*utils.Claims) bool
+	touchSession       func(claims *utils.Claims, ip string)
+	authenticateToken  func(string) (*utils.Claims, error)
+	authFunctionsMutex sync.RWMutex
+)
+
+// SetRevocationCheck sets the function JWTAuthMiddleware uses to reject revoked tokens.
+func SetRevocationCheck(fn func(*utils.Claims) bool) {
+	authFunctionsMutex.Lock()
+	defer authFunctionsMutex.Unlock()
+	isRevoked = fn
+}
+
+// SetSessionTracker sets the function JWTAuthMiddleware calls on every
+// authenticated request to record when and where the token's session was last seen.
+func SetSessionTracker(fn func(claims *utils.Claims, ip string)) {
+	authFunctionsMutex.Lock()
+	defer authFunctionsMutex.Unlock()
+	touchSession = fn
+}
+
+// SetAccessTokenAuthenticator sets the function TokenAuthMiddleware uses to
+// check personal access tokens.
+func SetAccessTokenAuthenticator(fn func(token string) (*utils.Claims, error)) {
+	authFunctionsMutex.Lock()
+	defer authFunctionsMutex.Unlock()
+	authenticateToken = fn
+}
+
+func tokenRevoked(claims *utils.Claims) bool {
+	authFunctionsMutex.RLock()
+	defer authFunctionsMutex.RUnlock()
+	return isRevoked != nil && isRevoked(claims)
+}
+
+func sessionSeen(claims *utils.Claims, ip string) {
+	authFunctionsMutex.RLock()
+	defer authFunctionsMutex.RUnlock()
+	if touchSession != nil && claims.SessionID != "" {
+		touchSession(claims, ip)
+	}
+}
+
+func authenticateAccessToken(token string) (*utils.Claims, error) {
+	authFunctionsMutex.RLock()
+	defer authFunctionsMutex.RUnlock()
+	if authenticateToken == nil {
+		return nil, utils.ErrUnauthorized
+	}
+	return authenticateToken(token)
+}
+
 func JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Authorization header required", nil)
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		claims, err := utils.ValidateJWT(tokenString)
+		if err == nil && tokenRevoked(claims) {
+			err = errors.New("session revoked")
+		}
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			logger.DebugContext(r.Context(), "rejected token", "error", err)
+			utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Invalid token", nil)
 			return
 		}
+		sessionSeen(claims, ClientIP(r))
+		if claims.ImpersonatorID != 0 {
+			auditImpersonatedRequest(claims, r)
+		}
 
 		// Set the user information in the request context
-		ctx := context.WithValue(r.Context(), "user", claims)
-		r = r.WithContext(ctx)
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+	})
+}
+
+// TokenAuthMiddleware accepts a JWT like JWTAuthMiddleware, or a personal
+// access token granted the given scope. Routes not wrapped in it cannot be
+// used with personal access tokens at all.
+func TokenAuthMiddleware(scope string, next http.Handler) http.Handler {
+	jwtAuth := JWTAuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !strings.HasPrefix(tokenString, models.PersonalAccessTokenPrefix) {
+			jwtAuth.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := authenticateAccessToken(tokenString)
+		if err != nil {
+			logger.DebugContext(r.Context(), "rejected personal access token", "error", err)
+			utils.SendJSONResponse(w, http.StatusUnauthorized, "error", "Invalid token", nil)
+			return
+		}
+		if !claims.HasScope(scope) {
+			utils.SendJSONResponse(w, http.StatusForbidden, "error", "Token lacks the "+scope+" scope", nil)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+	})
+}
+
+// GetClaims returns the claims stored in the request context by JWTAuthMiddleware.
+func GetClaims(r *http.Request) (*utils.Claims, bool) {
+	claims, ok := r.Context().Value(userContextKey).(*utils.Claims)
+	return claims, ok
+}
+
+// WithClaims returns a copy of ctx carrying the given claims, as JWTAuthMiddleware
+// would, and records the user in the request's log lines.
+func WithClaims(ctx context.Context, claims *utils.Claims) context.Context {
+	logging.SetUserID(ctx, claims.UserID)
+	return context.WithValue(ctx, userContextKey, claims)
+}
+
+// QueryTokenMiddleware lets clients that cannot set headers, such as browser
+// WebSockets, pass their token in the "access_token" query parameter. It must
+// run before JWTAuthMiddleware.
+func QueryTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
 		next.ServeHTTP(w, r)
 	})
 }
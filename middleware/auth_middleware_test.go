@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"task-manager/models"
+	"task-manager/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthMiddleware_JSONErrors(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		name          string
+		handler       http.Handler
+		authorization string
+	}{
+		{"MissingHeader", JWTAuthMiddleware(ok), ""},
+		{"InvalidToken", JWTAuthMiddleware(ok), "Bearer not-a-token"},
+		{"InvalidAccessToken", TokenAuthMiddleware(models.ScopeTasksRead, ok), "Bearer " + models.PersonalAccessTokenPrefix + "unknown"},
+		{"AdminWithoutClaims", AdminMiddleware(ok), ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/tasks", nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			rr := httptest.NewRecorder()
+			RequestIDMiddleware(test.handler).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusUnauthorized, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			var response utils.Response
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			assert.Equal(t, "error", response.Status)
+			assert.NotEmpty(t, response.RequestID)
+			assert.Equal(t, rr.Header().Get("X-Request-ID"), response.RequestID)
+		})
+	}
+}
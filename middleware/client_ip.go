@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// TrustedProxies are the reverse proxies whose X-Forwarded-For header is
+// believed: those connecting from Networks, and with Unix set, those
+// connecting over a Unix socket.
+type TrustedProxies struct {
+	Networks []netip.Prefix
+	Unix     bool
+}
+
+var (
+	trustedProxies      TrustedProxies
+	trustedProxiesMutex sync.RWMutex
+)
+
+// SetTrustedProxies sets the proxies ClientIP takes the client address from.
+// By default none is trusted and X-Forwarded-For is ignored.
+func SetTrustedProxies(proxies TrustedProxies) {
+	trustedProxiesMutex.Lock()
+	defer trustedProxiesMutex.Unlock()
+	trustedProxies = proxies
+}
+
+func (p TrustedProxies) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, network := range p.Networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client that sent the request. When
+// the request comes from a trusted proxy, X-Forwarded-For is read from the
+// right, skipping trusted proxies, so that clients cannot forge the address
+// by sending the header themselves.
+func ClientIP(r *http.Request) string {
+	trustedProxiesMutex.RLock()
+	proxies := trustedProxies
+	trustedProxiesMutex.RUnlock()
+
+	client := r.RemoteAddr
+	trusted := proxies.Unix // Unix socket peers have no IP address
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		client = addrPort.Addr().Unmap().String()
+		trusted = proxies.contains(addrPort.Addr())
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		client = host
+		trusted = false
+	}
+	if !trusted {
+		return client
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap().String()
+		if !proxies.contains(addr) {
+			break
+		}
+	}
+	return client
+}
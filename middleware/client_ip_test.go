@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP_TrustedProxies(t *testing.T) {
+	SetTrustedProxies(TrustedProxies{Networks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, Unix: true})
+	t.Cleanup(func() { SetTrustedProxies(TrustedProxies{}) })
+
+	for _, tt := range []struct {
+		remoteAddr, forwardedFor, want string
+	}{
+		{"192.0.2.1:1234", "203.0.113.9", "192.0.2.1"},                          // untrusted peers cannot forge the address
+		{"10.0.0.2:1234", "203.0.113.9", "203.0.113.9"},                         // behind a trusted proxy
+		{"10.0.0.2:1234", "198.51.100.1, 203.0.113.9, 10.0.0.3", "203.0.113.9"}, // the client's own header is ignored
+		{"10.0.0.2:1234", "", "10.0.0.2"},
+		{"@", "203.0.113.9", "203.0.113.9"}, // proxy on the Unix socket
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		assert.Equal(t, tt.want, ClientIP(req), tt.remoteAddr+" "+tt.forwardedFor)
+	}
+}
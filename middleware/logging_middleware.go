@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"task-manager/logging"
+	"time"
+)
+
+// RequestIDHeader carries the ID of a request, from the client or a proxy
+// in front of the server, and back in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs taken from clients.
+const maxRequestIDLength = 128
+
+var accessLog = logging.For("access")
+
+// probePaths are requested every few seconds by orchestrators and scrapers;
+// they are only logged at debug level.
+var probePaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// RequestIDMiddleware gives every request an ID: the one in its X-Request-ID
+// header when valid, or a new random one. The ID is returned in the
+// X-Request-ID response header and included in every log line written while
+// serving the request.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts IDs of printable ASCII characters without spaces,
+// which cannot forge log lines or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLogMiddleware logs every request once it has been served, with its
+// status, size and latency. It must run inside RequestIDMiddleware, so that
+// the line carries the request ID and the user ID set by JWTAuthMiddleware.
+// Server errors are logged at error level.
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		level := slog.LevelInfo
+		switch {
+		case recorder.Status() >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case probePaths[r.URL.Path]:
+			level = slog.LevelDebug
+		}
+		accessLog.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.Status()),
+			slog.Int("bytes", recorder.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("ip", ClientIP(r)),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
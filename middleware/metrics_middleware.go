@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// unmatchedRoute labels requests that match no route, so that scanners
+	// probing random paths cannot create a series per path.
+	unmatchedRoute = "unmatched"
+	// otherMethod labels requests with non-standard methods, for the same reason.
+	otherMethod = "other"
+)
+
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// InstrumentRouter counts the requests served by router and their latency,
+// labelled by method, route template (such as /api/tasks/{id:[0-9]+}) and
+// status code, in registerer. Requests that match no route are counted as
+// well, through the router's not found and method not allowed handlers.
+func InstrumentRouter(router *mux.Router, registerer prometheus.Registerer) {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served.",
+	}, []string{"method", "route", "status"})
+	durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	registerer.MustRegister(requests, durations)
+
+	instrument := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+
+			labels := prometheus.Labels{"method": methodLabel(r.Method), "route": routeLabel(r), "status": strconv.Itoa(recorder.Status())}
+			requests.With(labels).Inc()
+			durations.With(labels).Observe(time.Since(start).Seconds())
+		})
+	}
+	router.Use(instrument)
+	notFound := router.NotFoundHandler
+	if notFound == nil {
+		notFound = http.NotFoundHandler()
+	}
+	router.NotFoundHandler = instrument(notFound)
+	methodNotAllowed := router.MethodNotAllowedHandler
+	if methodNotAllowed == nil {
+		methodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		})
+	}
+	router.MethodNotAllowedHandler = instrument(methodNotAllowed)
+}
+
+func methodLabel(method string) string {
+	if standardMethods[method] {
+		return method
+	}
+	return otherMethod
+}
+
+// routeLabel returns the template of the route that served the request. It
+// is known once the router has passed the request on, so the instrumented
+// handler must run inside the router.
+func routeLabel(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return unmatchedRoute
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentRouter(t *testing.T) {
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/tasks/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods(http.MethodGet)
+	registry := prometheus.NewRegistry()
+	InstrumentRouter(router, registry)
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/api/tasks/1"},
+		{http.MethodGet, "/api/tasks/2"},
+		{http.MethodGet, "/wp-login.php"},
+		{"PROPFIND", "/api/tasks/1"},
+		{"X-RANDOM-1", "/api/tasks/1"},
+	} {
+		r, _ := http.NewRequest(req.method, req.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	expected := `
+# HELP http_requests_total HTTP requests served.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/api/tasks/{id:[0-9]+}",status="204"} 2
+http_requests_total{method="GET",route="unmatched",status="404"} 1
+http_requests_total{method="other",route="unmatched",status="405"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_requests_total"))
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"task-manager/utils"
+	"time"
+)
+
+var (
+	// authLimiter limits requests to the authentication endpoints per client IP.
+	authLimiter      = utils.NewRateLimiter(6*time.Second, 10)
+	authLimiterMutex sync.RWMutex
+)
+
+// SetAuthRateLimit sets the limiter AuthRateLimitMiddleware uses. A nil
+// limiter disables rate limiting.
+func SetAuthRateLimit(limiter *utils.RateLimiter) {
+	authLimiterMutex.Lock()
+	defer authLimiterMutex.Unlock()
+	authLimiter = limiter
+}
+
+// AuthRateLimitMiddleware limits requests per client IP, by default to bursts
+// of 10 and then one every 6 seconds. Rejected requests get 429 Too Many
+// Requests with a Retry-After header.
+func AuthRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authLimiterMutex.RLock()
+		limiter := authLimiter
+		authLimiterMutex.RUnlock()
+
+		if limiter != nil {
+			if ok, wait := limiter.Allow(ClientIP(r)); !ok {
+				logger.InfoContext(r.Context(), "rate limited", "ip", ClientIP(r), "path", r.URL.Path, "retry_after", wait.Round(time.Second).String())
+				TooManyRequests(w, wait)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TooManyRequests responds with 429 and a Retry-After header of wait, in whole seconds.
+func TooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	utils.SendJSONResponse(w, http.StatusTooManyRequests, "error", "Too many requests, try again later", nil)
+}
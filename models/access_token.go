@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// PersonalAccessTokenPrefix starts every personal access token, which tells
+// them apart from JWTs and makes leaked tokens easy to scan for.
+const PersonalAccessTokenPrefix = "tmpat_"
+
+// Scopes a personal access token can be granted.
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+)
+
+var Scopes = []string{ScopeTasksRead, ScopeTasksWrite}
+
+// PersonalAccessToken lets scripts authenticate as a user with limited scopes.
+// Only a hash of the token is stored; the token itself is shown once on creation.
+type PersonalAccessToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Hint       string     `json:"hint"` // the last characters of the token
+	Hash       string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
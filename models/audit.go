@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Audited actions.
+const (
+	AuditUserDisabled         = "user.disabled"
+	AuditUserEnabled          = "user.enabled"
+	AuditPasswordResetForced  = "user.password_reset_forced"
+	AuditRoleChanged          = "user.role_changed"
+	AuditImpersonationStarted = "impersonation.started"
+	AuditImpersonatedRequest  = "impersonation.request"
+)
+
+// AuditEntry records an administrative action, or a request made by an
+// administrator impersonating a user.
+type AuditEntry struct {
+	ID      int    `json:"id"`
+	Action  string `json:"action"`
+	ActorID int    `json:"actor_id"` // the user the action was performed as
+	// ImpersonatorID is the administrator acting as ActorID, for requests
+	// made with an impersonation token.
+	ImpersonatorID int       `json:"impersonator_id,omitempty"`
+	TargetUserID   int       `json:"target_user_id,omitempty"`
+	Details        string    `json:"details,omitempty"`
+	IP             string    `json:"ip,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
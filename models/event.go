@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type TaskEventType string
+
+const (
+	TaskCreated       TaskEventType = "task.created"
+	TaskUpdated       TaskEventType = "task.updated"
+	TaskStatusChanged TaskEventType = "task.status_changed"
+	TaskAssigned      TaskEventType = "task.assigned"
+	TaskCompleted     TaskEventType = "task.completed"
+	TaskDeleted       TaskEventType = "task.deleted"
+	TaskDueSoon       TaskEventType = "task.due_soon"
+	TaskOverdue       TaskEventType = "task.overdue"
+)
+
+// TaskEvent describes something that happened to a task.
+// ID is assigned when the event is published and increases with every event.
+// ActorID is the user who caused the event, or 0 for system events.
+// Previous holds the task as it was before an update.
+type TaskEvent struct {
+	ID       int64         `json:"id"`
+	Type     TaskEventType `json:"type"`
+	ActorID  int           `json:"actor_id,omitempty"`
+	Task     Task          `json:"task"`
+	Previous *Task         `json:"previous,omitempty"`
+	Time     time.Time     `json:"time"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// ExportStatus is the state of a personal data export.
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportReady   ExportStatus = "ready"
+	ExportFailed  ExportStatus = "failed"
+)
+
+// DataExport is an archive of everything stored about a user, built in the
+// background. Once ready, it can be downloaded until it expires.
+type DataExport struct {
+	ID          int          `json:"id"`
+	UserID      int          `json:"-"`
+	Status      ExportStatus `json:"status"`
+	Error       string       `json:"error,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty"`
+	DownloadURL string       `json:"download_url,omitempty"`
+}
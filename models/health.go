@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Health check statuses.
+const (
+	HealthOK      = "ok"
+	HealthFailing = "failing"
+)
+
+// HealthCheckResult is the outcome of one readiness check. Error and
+// Duration are only logged, not served.
+type HealthCheckResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// HealthReport is the outcome of all readiness checks. Status is failing if
+// any check failed.
+type HealthReport struct {
+	Status    string              `json:"status"`
+	Checks    []HealthCheckResult `json:"checks"`
+	CheckedAt time.Time           `json:"checked_at"`
+}
+
+// BuildInfo describes the running binary. Version, Commit and BuildTime are
+// set at link time.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginAttempt is a password login to an account, successful or not.
+type LoginAttempt struct {
+	UserID    int       `json:"-"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+type NotificationType string
+
+const (
+	NotificationAssigned      NotificationType = "ASSIGNED"
+	NotificationStatusChanged NotificationType = "STATUS_CHANGED"
+	NotificationMentioned     NotificationType = "MENTIONED"
+	NotificationDueSoon       NotificationType = "DUE_SOON"
+)
+
+// NotificationTypes lists every notification type a user can opt out of.
+var NotificationTypes = []NotificationType{
+	NotificationAssigned,
+	NotificationStatusChanged,
+	NotificationMentioned,
+	NotificationDueSoon,
+}
+
+type Notification struct {
+	ID        int              `json:"id"`
+	UserID    int              `json:"user_id"`
+	Type      NotificationType `json:"type"`
+	TaskID    int              `json:"task_id"`
+	Message   string           `json:"message"`
+	Read      bool             `json:"read"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// NotificationPreferences says, per notification type, whether a user wants it.
+// Types missing from the map are enabled.
+type NotificationPreferences map[NotificationType]bool
+
+// EmailPreferences controls which emails a user receives and when.
+type EmailPreferences struct {
+	TaskUpdates bool   `json:"task_updates"`
+	Digest      bool   `json:"digest"`
+	DigestHour  int    `json:"digest_hour"` // local hour (0-23) at which the daily digest is sent
+	Timezone    string `json:"timezone"`    // IANA time zone, e.g. "Europe/Berlin"
+}
+
+// DefaultEmailPreferences apply to users who never changed their email settings.
+var DefaultEmailPreferences = EmailPreferences{
+	TaskUpdates: true,
+	Digest:      true,
+	DigestHour:  8,
+	Timezone:    "UTC",
+}
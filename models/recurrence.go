@@ -0,0 +1,440 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the FREQ part of an RRULE.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// maxRecurrencePeriods bounds how many periods are scanned when looking for
+// occurrences, so that rules which never match (e.g. BYMONTHDAY=31 with
+// FREQ=YEARLY starting in February) cannot loop forever.
+const maxRecurrencePeriods = 10000
+
+// Recurrence describes how a task repeats.
+// Rule is an RFC 5545 RRULE, Start is the DTSTART of the series and
+// Timezone is the IANA zone in which occurrences are computed.
+type Recurrence struct {
+	Rule     string    `json:"rule"`
+	Timezone string    `json:"timezone,omitempty"`
+	Start    time.Time `json:"start"`
+	Index    int       `json:"index"` // 1-based position of the task in its series
+}
+
+// WeekdayNum is a BYDAY entry such as "MO" or "-1FR".
+// Ordinal is only meaningful for MONTHLY and YEARLY rules; 0 means every such
+// weekday. It counts weeks of the month, or of the year for YEARLY rules
+// without BYMONTH.
+type WeekdayNum struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+// RRule is a parsed RRULE. Only the subset DAILY/WEEKLY/MONTHLY/YEARLY with
+// INTERVAL, BYDAY, BYMONTHDAY, BYMONTH, COUNT and UNTIL is supported.
+type RRule struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	Count      int
+	Until      *time.Time
+	// UntilLocal is set when UNTIL had no "Z" suffix and is a wall-clock
+	// time in the series time zone rather than UTC.
+	UntilLocal bool
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// ParseRRule parses an RRULE value such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR".
+// A leading "RRULE:" prefix is accepted.
+func ParseRRule(rule string) (*RRule, error) {
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	if rule == "" {
+		return nil, errors.New("empty recurrence rule")
+	}
+
+	r := &RRule{Interval: 1}
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("malformed rule part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			switch f := Frequency(strings.ToUpper(value)); f {
+			case Daily, Weekly, Monthly, Yearly:
+				r.Freq = f
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			until, local, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = &until
+			r.UntilLocal = local
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				wd, err := parseWeekdayNum(v)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q", v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 || n > 12 {
+					return nil, fmt.Errorf("invalid BYMONTH %q", v)
+				}
+				r.ByMonth = append(r.ByMonth, time.Month(n))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("FREQ is required")
+	}
+	if r.Count > 0 && r.Until != nil {
+		return nil, errors.New("COUNT and UNTIL are mutually exclusive")
+	}
+	for _, wd := range r.ByDay {
+		if wd.Ordinal != 0 && r.Freq != Monthly && r.Freq != Yearly {
+			return nil, errors.New("BYDAY ordinals are only allowed with MONTHLY or YEARLY")
+		}
+		// Ordinals count weeks of the year only for YEARLY rules without BYMONTH.
+		if (wd.Ordinal < -5 || wd.Ordinal > 5) && (r.Freq != Yearly || len(r.ByMonth) > 0) {
+			return nil, fmt.Errorf("BYDAY ordinal %d is out of range for a month", wd.Ordinal)
+		}
+	}
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, false, nil
+	}
+	for _, layout := range []string{"20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A date-only UNTIL includes the whole day.
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, true, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("invalid UNTIL %q", value)
+}
+
+func parseWeekdayNum(value string) (WeekdayNum, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if len(value) < 2 {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", value)
+	}
+	wd, ok := weekdayCodes[value[len(value)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", value)
+	}
+	ordinal := 0
+	if prefix := value[:len(value)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", value)
+		}
+		ordinal = n
+	}
+	return WeekdayNum{Ordinal: ordinal, Weekday: wd}, nil
+}
+
+// Occurrences returns up to n occurrences of the rule for a series starting at
+// start that fall strictly after the given time. Dates are computed as wall-clock
+// times in loc, so a 09:00 meeting stays at 09:00 across DST changes.
+// COUNT is counted from start, not from after.
+func (r *RRule) Occurrences(start, after time.Time, n int, loc *time.Location) []time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	start = start.In(loc)
+
+	var result []time.Time
+	seen := 0
+	for period := 0; period < maxRecurrencePeriods && len(result) < n; period++ {
+		for _, t := range r.expand(start, period, loc) {
+			if t.Before(start) {
+				continue
+			}
+			if r.Until != nil && t.After(r.untilIn(loc)) {
+				return result
+			}
+			seen++
+			if r.Count > 0 && seen > r.Count {
+				return result
+			}
+			if t.After(after) {
+				result = append(result, t)
+				if len(result) == n {
+					return result
+				}
+			}
+		}
+	}
+	return result
+}
+
+// untilIn returns UNTIL as an absolute time, interpreting a local UNTIL in loc.
+func (r *RRule) untilIn(loc *time.Location) time.Time {
+	u := *r.Until
+	if !r.UntilLocal {
+		return u
+	}
+	return time.Date(u.Year(), u.Month(), u.Day(), u.Hour(), u.Minute(), u.Second(), 0, loc)
+}
+
+// expand returns the sorted candidate occurrences within the given period.
+func (r *RRule) expand(start time.Time, period int, loc *time.Location) []time.Time {
+	step := period * r.Interval
+	hour, min, sec := start.Clock()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hour, min, sec, 0, loc)
+	}
+
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		d := at(start.Year(), start.Month(), start.Day()+step)
+		if r.matchesDay(d) {
+			days = append(days, d)
+		}
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			days = append(days, at(start.Year(), start.Month(), start.Day()+7*step))
+			break
+		}
+		// Weeks start on Monday (WKST=MO).
+		offset := (int(start.Weekday()) + 6) % 7
+		monday := at(start.Year(), start.Month(), start.Day()-offset+7*step)
+		for i := 0; i < 7; i++ {
+			d := at(monday.Year(), monday.Month(), monday.Day()+i)
+			if r.matchesDay(d) {
+				days = append(days, d)
+			}
+		}
+	case Monthly:
+		first := at(start.Year(), start.Month()+time.Month(step), 1)
+		if r.matchesMonth(first.Month()) {
+			days = r.expandMonth(first, start.Day(), at)
+		}
+	case Yearly:
+		days = r.expandYear(start.Year()+step, start, at)
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// expandYear returns the matching days of the year. BYDAY and BYMONTHDAY
+// apply to every month, or to the BYMONTH months; without either, the
+// DTSTART day of the DTSTART month, or of each BYMONTH month, is used.
+func (r *RRule) expandYear(year int, start time.Time, at func(int, time.Month, int) time.Time) []time.Time {
+	months := r.ByMonth
+	if len(months) == 0 {
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			months = []time.Month{start.Month()}
+		} else {
+			for m := time.January; m <= time.December; m++ {
+				months = append(months, m)
+			}
+		}
+	}
+
+	var days []time.Time
+	for _, month := range months {
+		first := at(year, month, 1)
+		if len(r.ByDay) == 0 || len(r.ByMonth) > 0 {
+			days = append(days, r.expandMonth(first, start.Day(), at)...)
+			continue
+		}
+		// BYDAY ordinals count weeks of the year.
+		daysInMonth := at(year, month+1, 0).Day()
+		for day := 1; day <= daysInMonth; day++ {
+			if len(r.ByMonthDay) > 0 && !r.matchesMonthDay(day, daysInMonth) {
+				continue
+			}
+			if d := at(year, month, day); r.matchesWeekdayInYear(d) {
+				days = append(days, d)
+			}
+		}
+	}
+	return days
+}
+
+// expandMonth returns the matching days of the month that first falls in.
+// Without BYDAY or BYMONTHDAY, defaultDay is used and months lacking it are skipped.
+func (r *RRule) expandMonth(first time.Time, defaultDay int, at func(int, time.Month, int) time.Time) []time.Time {
+	year, month := first.Year(), first.Month()
+	daysInMonth := at(year, month+1, 0).Day()
+
+	if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+		if defaultDay > daysInMonth {
+			return nil
+		}
+		return []time.Time{at(year, month, defaultDay)}
+	}
+
+	var days []time.Time
+	for day := 1; day <= daysInMonth; day++ {
+		d := at(year, month, day)
+		if len(r.ByMonthDay) > 0 && !r.matchesMonthDay(day, daysInMonth) {
+			continue
+		}
+		if len(r.ByDay) > 0 && !r.matchesWeekdayInMonth(d, daysInMonth) {
+			continue
+		}
+		days = append(days, d)
+	}
+	return days
+}
+
+func (r *RRule) matchesMonth(m time.Month) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, month := range r.ByMonth {
+		if month == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RRule) matchesDay(d time.Time) bool {
+	if !r.matchesMonth(d.Month()) {
+		return false
+	}
+	if len(r.ByMonthDay) > 0 {
+		daysInMonth := time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, d.Location()).Day()
+		if !r.matchesMonthDay(d.Day(), daysInMonth) {
+			return false
+		}
+	}
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wd := range r.ByDay {
+		if wd.Weekday == d.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RRule) matchesMonthDay(day, daysInMonth int) bool {
+	for _, md := range r.ByMonthDay {
+		if md == day || (md < 0 && daysInMonth+md+1 == day) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RRule) matchesWeekdayInMonth(d time.Time, daysInMonth int) bool {
+	for _, wd := range r.ByDay {
+		if wd.Weekday != d.Weekday() {
+			continue
+		}
+		switch {
+		case wd.Ordinal == 0:
+			return true
+		case wd.Ordinal > 0 && (d.Day()-1)/7+1 == wd.Ordinal:
+			return true
+		case wd.Ordinal < 0 && (daysInMonth-d.Day())/7+1 == -wd.Ordinal:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RRule) matchesWeekdayInYear(d time.Time) bool {
+	daysInYear := time.Date(d.Year(), time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+	for _, wd := range r.ByDay {
+		if wd.Weekday != d.Weekday() {
+			continue
+		}
+		switch {
+		case wd.Ordinal == 0:
+			return true
+		case wd.Ordinal > 0 && (d.YearDay()-1)/7+1 == wd.Ordinal:
+			return true
+		case wd.Ordinal < 0 && (daysInYear-d.YearDay())/7+1 == -wd.Ordinal:
+			return true
+		}
+	}
+	return false
+}
+
+// Location returns the time zone of the recurrence, defaulting to UTC.
+func (rec *Recurrence) Location() (*time.Location, error) {
+	if rec.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(rec.Timezone)
+}
+
+// Next returns up to n occurrences of the series strictly after the given time.
+func (rec *Recurrence) Next(after time.Time, n int) ([]time.Time, error) {
+	rule, err := ParseRRule(rec.Rule)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := rec.Location()
+	if err != nil {
+		return nil, err
+	}
+	return rule.Occurrences(rec.Start, after, n, loc), nil
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 9, 0, 0, 0, time.UTC)
+}
+
+func occurrences(t *testing.T, rule string, start time.Time, n int) []time.Time {
+	t.Helper()
+	r, err := ParseRRule(rule)
+	require.NoError(t, err)
+	return r.Occurrences(start, start.Add(-time.Second), n, time.UTC)
+}
+
+func TestRRule_Expansion(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		want  []time.Time
+	}{
+		{
+			name:  "daily with interval",
+			rule:  "FREQ=DAILY;INTERVAL=2;COUNT=3",
+			start: date(2024, time.March, 30),
+			want:  []time.Time{date(2024, time.March, 30), date(2024, time.April, 1), date(2024, time.April, 3)},
+		},
+		{
+			name:  "weekly by day",
+			rule:  "FREQ=WEEKLY;BYDAY=MO,FR",
+			start: date(2024, time.January, 3), // Wednesday
+			want:  []time.Time{date(2024, time.January, 5), date(2024, time.January, 8), date(2024, time.January, 12)},
+		},
+		{
+			name:  "monthly skips months without the day",
+			rule:  "FREQ=MONTHLY",
+			start: date(2024, time.January, 31),
+			want:  []time.Time{date(2024, time.January, 31), date(2024, time.March, 31), date(2024, time.May, 31)},
+		},
+		{
+			name:  "monthly last friday",
+			rule:  "FREQ=MONTHLY;BYDAY=-1FR",
+			start: date(2024, time.January, 1),
+			want:  []time.Time{date(2024, time.January, 26), date(2024, time.February, 23), date(2024, time.March, 29)},
+		},
+		{
+			name:  "monthly limited by month",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=1;BYMONTH=1,7",
+			start: date(2024, time.January, 1),
+			want:  []time.Time{date(2024, time.January, 1), date(2024, time.July, 1), date(2025, time.January, 1)},
+		},
+		{
+			name:  "yearly on the start date",
+			rule:  "FREQ=YEARLY",
+			start: date(2024, time.February, 29),
+			want:  []time.Time{date(2024, time.February, 29), date(2028, time.February, 29), date(2032, time.February, 29)},
+		},
+		{
+			name:  "yearly by month day covers every month",
+			rule:  "FREQ=YEARLY;BYMONTHDAY=15",
+			start: date(2024, time.November, 1),
+			want:  []time.Time{date(2024, time.November, 15), date(2024, time.December, 15), date(2025, time.January, 15)},
+		},
+		{
+			name:  "yearly by day counts weeks of the year",
+			rule:  "FREQ=YEARLY;BYDAY=20MO",
+			start: date(2024, time.January, 1),
+			want:  []time.Time{date(2024, time.May, 13), date(2025, time.May, 19), date(2026, time.May, 18)},
+		},
+		{
+			name:  "yearly last week of the year",
+			rule:  "FREQ=YEARLY;BYDAY=-1SU",
+			start: date(2024, time.January, 1),
+			want:  []time.Time{date(2024, time.December, 29), date(2025, time.December, 28), date(2026, time.December, 27)},
+		},
+		{
+			name:  "yearly by day and month",
+			rule:  "FREQ=YEARLY;BYMONTH=5;BYDAY=2SU",
+			start: date(2024, time.January, 1),
+			want:  []time.Time{date(2024, time.May, 12), date(2025, time.May, 11), date(2026, time.May, 10)},
+		},
+		{
+			name:  "yearly by month uses the start day",
+			rule:  "FREQ=YEARLY;BYMONTH=3,9",
+			start: date(2024, time.March, 10),
+			want:  []time.Time{date(2024, time.March, 10), date(2024, time.September, 10), date(2025, time.March, 10)},
+		},
+		{
+			name:  "until is inclusive",
+			rule:  "FREQ=WEEKLY;UNTIL=20240115",
+			start: date(2024, time.January, 1),
+			want:  []time.Time{date(2024, time.January, 1), date(2024, time.January, 8), date(2024, time.January, 15)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, occurrences(t, tt.rule, tt.start, 3))
+		})
+	}
+}
+
+func TestParseRRule_Invalid(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;COUNT=2;UNTIL=20240101",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYDAY=6MO",
+		"FREQ=YEARLY;BYDAY=54MO",
+		"FREQ=YEARLY;BYMONTH=5;BYDAY=20MO",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+	} {
+		_, err := ParseRRule(rule)
+		assert.Error(t, err, rule)
+	}
+}
+
+func TestParseRRule_YearlyOrdinals(t *testing.T) {
+	r, err := ParseRRule("FREQ=YEARLY;BYDAY=53FR,-53MO")
+	require.NoError(t, err)
+	assert.Equal(t, []WeekdayNum{{Ordinal: 53, Weekday: time.Friday}, {Ordinal: -53, Weekday: time.Monday}}, r.ByDay)
+}
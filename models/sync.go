@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SyncFields are the task fields clients can change through sync, each
+// resolved independently with last-writer-wins.
+var SyncFields = []string{"title", "description", "status", "assignee_id", "due_date"}
+
+// Tombstone records a deleted task so that syncing clients learn about the deletion.
+type Tombstone struct {
+	ID        int       `json:"id"`
+	Version   int64     `json:"version"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type SyncOperation string
+
+const (
+	SyncCreate SyncOperation = "create"
+	SyncUpdate SyncOperation = "update"
+	SyncDelete SyncOperation = "delete"
+)
+
+// SyncChange is a change made by a client while offline.
+// ClientID identifies created tasks until they have a server ID.
+// UpdatedAt is when the client made the change and is compared per field
+// with the server's modification times.
+type SyncChange struct {
+	Op        SyncOperation              `json:"op"`
+	ID        int                        `json:"id,omitempty"`
+	ClientID  string                     `json:"client_id,omitempty"`
+	Fields    map[string]json.RawMessage `json:"fields,omitempty"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+}
+
+// SyncConflict is a field where the server kept its own, newer value.
+type SyncConflict struct {
+	ID              int             `json:"id"`
+	Field           string          `json:"field"`
+	ClientValue     json.RawMessage `json:"client_value,omitempty"`
+	ServerValue     interface{}     `json:"server_value"`
+	ServerUpdatedAt time.Time       `json:"server_updated_at"`
+}
+
+type SyncStatus string
+
+const (
+	SyncApplied    SyncStatus = "applied"  // all fields were applied
+	SyncPartial    SyncStatus = "partial"  // some fields lost to newer server values
+	SyncConflicted SyncStatus = "conflict" // nothing was applied
+	SyncRejected   SyncStatus = "rejected" // the change was invalid
+)
+
+// SyncResult is the outcome of one pushed change.
+type SyncResult struct {
+	ID        int            `json:"id,omitempty"`
+	ClientID  string         `json:"client_id,omitempty"`
+	Status    SyncStatus     `json:"status"`
+	Error     string         `json:"error,omitempty"`
+	Conflicts []SyncConflict `json:"conflicts,omitempty"`
+	Task      *Task          `json:"task,omitempty"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Status string
 
 const (
@@ -9,8 +11,20 @@ const (
 )
 
 type Task struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Status      Status `json:"status"`
+	ID          int         `json:"id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Status      Status      `json:"status"`
+	CreatorID   int         `json:"creator_id,omitempty"`
+	AssigneeID  int         `json:"assignee_id,omitempty"`
+	DueDate     *time.Time  `json:"due_date,omitempty"`
+	Recurrence  *Recurrence `json:"recurrence,omitempty"`
+	Overdue     bool        `json:"overdue"`
+	RemindedAt  *time.Time  `json:"reminded_at,omitempty"`
+	// Version increases with every change to the task; see TaskService.ChangesSince.
+	Version   int64     `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// FieldUpdatedAt records when each of the SyncFields last changed.
+	// It is replaced, never modified, so that copies of the task can share it.
+	FieldUpdatedAt map[string]time.Time `json:"-"`
 }
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// RefreshToken is a stored refresh token. Only the hash of the token is kept.
+// Refresh tokens rotate: each one can be used once and is replaced by a new
+// token of the same session.
+type RefreshToken struct {
+	Hash      string
+	UserID    int
+	SessionID string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// TokenPair is returned when logging in and when refreshing.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // access token lifetime in seconds
+}
+
+// Session is a login on one device, from the first token issued until it is
+// revoked or its refresh tokens expire.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"` // address the session was last seen from
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// ImpersonatorID is set for sessions started by an administrator to act as the user.
+	ImpersonatorID int `json:"impersonator_id,omitempty"`
+	// Current is set in listings for the session the request was made with.
+	Current bool `json:"current"`
+}
+
+// ImpersonationToken lets an administrator act as another user for a short
+// while. It cannot be refreshed.
+type ImpersonationToken struct {
+	AccessToken    string    `json:"token"`
+	UserID         int       `json:"user_id"`
+	ImpersonatorID int       `json:"impersonator_id"`
+	SessionID      string    `json:"session_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
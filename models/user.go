@@ -1,7 +1,51 @@
 package models
 
+// Roles a user can have. Administrators can use the /api/admin endpoints.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID       int    `json:"id"`
 	Email    string `json:"email"`
 	Password string `json:"-"` // Store hashed password, not plaintext
+	// EmailVerified is set once the user proves they receive email at Email.
+	EmailVerified bool `json:"email_verified"`
+
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	// Timezone is an IANA time zone name, e.g. "Europe/Paris".
+	Timezone string `json:"timezone,omitempty"`
+	// Locale is a BCP 47 language tag, e.g. "en-US".
+	Locale string `json:"locale,omitempty"`
+
+	Role string `json:"role"`
+	// Disabled users cannot log in and their sessions are ended.
+	Disabled bool `json:"disabled"`
+	// PasswordResetRequired is set by an administrator; the user cannot log in
+	// with their password until they reset it.
+	PasswordResetRequired bool `json:"reset_required"`
+}
+
+// IsAdmin reports whether the user may use the admin endpoints.
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin && !u.Disabled
+}
+
+// ProfileUpdate holds the profile fields to change. Nil fields are left as
+// they are; empty strings clear them.
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+	Timezone    *string `json:"timezone"`
+	Locale      *string `json:"locale"`
+}
+
+// UserFilter selects users in admin listings. Empty fields match every user.
+type UserFilter struct {
+	// Query matches part of the email address or display name, ignoring case.
+	Query    string
+	Role     string
+	Disabled *bool
 }
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookEvents lists the task events webhooks can subscribe to.
+var WebhookEvents = []TaskEventType{TaskCreated, TaskUpdated, TaskCompleted, TaskDeleted}
+
+type Webhook struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"user_id"`
+	URL       string          `json:"url"`
+	Secret    string          `json:"-"`
+	Events    []TaskEventType `json:"events"` // empty means all of WebhookEvents
+	Active    bool            `json:"active"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID            int             `json:"id"`
+	WebhookID     int             `json:"webhook_id"`
+	Event         TaskEventType   `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      int             `json:"attempts"`
+	StatusCode    int             `json:"status_code,omitempty"` // response code of the last attempt
+	Error         string          `json:"error,omitempty"`
+	Delivered     bool            `json:"delivered"`
+	CreatedAt     time.Time       `json:"created_at"`
+	LastAttemptAt *time.Time      `json:"last_attempt_at,omitempty"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"` // nil once delivered or given up
+}
@@ -0,0 +1,112 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// minKeyRefreshInterval limits how often unknown key IDs make us refetch the
+// provider's keys, so that forged tokens cannot flood the provider.
+const minKeyRefreshInterval = time.Minute
+
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+}
+
+type publicKey struct {
+	algorithm string
+	key       interface{}
+}
+
+// keySet caches a provider's signing keys and refetches them when a token
+// names a key it has not seen, which happens after the provider rotates keys.
+type keySet struct {
+	uri   string
+	fetch func(ctx context.Context, uri string, v interface{}) error
+
+	mutex     sync.Mutex
+	keys      map[string]publicKey
+	fetchedAt time.Time
+}
+
+func (s *keySet) get(ctx context.Context, kid, algorithm string) (interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key, ok := s.keys[kid]
+	if !ok && time.Since(s.fetchedAt) >= minKeyRefreshInterval {
+		if err := s.refreshLocked(ctx); err != nil {
+			return nil, err
+		}
+		key, ok = s.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.algorithm != algorithm {
+		return nil, errors.New("unexpected signing algorithm")
+	}
+	return key.key, nil
+}
+
+func (s *keySet) refreshLocked(ctx context.Context) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := s.fetch(ctx, s.uri, &set); err != nil {
+		return fmt.Errorf("fetching keys: %w", err)
+	}
+	keys := map[string]publicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.KeyID] = key
+		}
+	}
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	return nil
+}
+
+func (k jwk) publicKey() (publicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch {
+	case k.KeyType == "RSA" && (k.Algorithm == "" || k.Algorithm == "RS256"):
+		n, err := decode(k.N)
+		if err != nil {
+			return publicKey{}, err
+		}
+		e, err := decode(k.E)
+		if err != nil || len(e) > 4 {
+			return publicKey{}, errors.New("invalid RSA exponent")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < 2048 {
+			return publicKey{}, errors.New("RSA key too small")
+		}
+		return publicKey{algorithm: "RS256", key: key}, nil
+	case k.KeyType == "OKP" && k.Curve == "Ed25519":
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, errors.New("invalid Ed25519 key")
+		}
+		return publicKey{algorithm: "EdDSA", key: ed25519.PublicKey(x)}, nil
+	}
+	return publicKey{}, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
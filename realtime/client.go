@@ -0,0 +1,244 @@
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"task-manager/logging"
+	"task-manager/models"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var logger = logging.For("realtime")
+
+const (
+	// outboxSize is how many messages may queue for a client before it is
+	// considered too slow and disconnected.
+	outboxSize = 64
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize limits incoming messages.
+	maxMessageSize = 64 << 10
+)
+
+// Message is the envelope of every message exchanged over the WebSocket.
+// ID is chosen by the client for requests and echoed in the matching "ack" or "error".
+type Message struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Topic   string          `json:"topic,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Client is a single WebSocket connection of an authenticated user.
+type Client struct {
+	hub       *Hub
+	conn      *websocket.Conn
+	userID    int
+	email     string
+	outbox    chan Message
+	done      chan struct{}
+	closeOnce sync.Once
+	// closeCode and closeText are sent in the close message once done is closed.
+	closeCode int
+	closeText string
+}
+
+// Serve handles an upgraded connection until it is closed.
+func (h *Hub) Serve(conn *websocket.Conn, userID int, email string) {
+	c := &Client{
+		hub:    h,
+		conn:   conn,
+		userID: userID,
+		email:  email,
+		outbox: make(chan Message, outboxSize),
+		done:   make(chan struct{}),
+	}
+	if !h.register(c) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+	go c.writePump()
+	c.readPump()
+}
+
+// send queues a message without blocking. A client whose queue is full is
+// disconnected rather than slowing down the hub; it can reconnect and resubscribe.
+func (c *Client) send(msg Message) {
+	select {
+	case <-c.done:
+	case c.outbox <- msg:
+	default:
+		logger.Warn("disconnecting slow WebSocket client", "user_id", c.userID)
+		c.close()
+	}
+}
+
+func (c *Client) close() {
+	c.closeWith(websocket.CloseTryAgainLater, "client too slow or disconnected")
+}
+
+// closeWith disconnects the client with the given close code, unless it is already closing.
+func (c *Client) closeWith(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode, c.closeText = code, text
+		close(c.done)
+	})
+}
+
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.remove(c)
+		c.close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.sendError("", "invalid message")
+			continue
+		}
+		c.handle(msg)
+	}
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeText))
+			return
+		case msg := <-c.outbox:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) sendError(id, message string) {
+	payload, _ := json.Marshal(map[string]string{"message": message})
+	c.send(Message{Type: "error", ID: id, Payload: payload})
+}
+
+func (c *Client) ack(id string, data interface{}) {
+	var payload json.RawMessage
+	if data != nil {
+		payload, _ = json.Marshal(data)
+	}
+	c.send(Message{Type: "ack", ID: id, Payload: payload})
+}
+
+// taskPayload is the payload of task mutation messages.
+type taskPayload struct {
+	ID          int           `json:"id"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Status      models.Status `json:"status"`
+	AssigneeID  int           `json:"assignee_id"`
+	DueDate     *time.Time    `json:"due_date"`
+}
+
+func (c *Client) handle(msg Message) {
+	switch msg.Type {
+	case "subscribe":
+		if !validTopic(msg.Topic) {
+			c.sendError(msg.ID, "unknown topic")
+			return
+		}
+		c.hub.subscribe(c, msg.Topic)
+		c.ack(msg.ID, nil)
+	case "unsubscribe":
+		c.hub.unsubscribe(c, msg.Topic)
+		c.ack(msg.ID, nil)
+	case "presence":
+		var input struct {
+			State string `json:"state"`
+		}
+		if err := json.Unmarshal(msg.Payload, &input); err != nil || (input.State != "" && input.State != Viewing && input.State != Editing) {
+			c.sendError(msg.ID, "state must be viewing, editing or empty")
+			return
+		}
+		if !c.hub.setPresence(c, msg.Topic, input.State) {
+			c.sendError(msg.ID, "subscribe to the topic first")
+			return
+		}
+		c.ack(msg.ID, nil)
+	case "task.create", "task.update", "task.complete", "task.delete", "task.assign":
+		var input taskPayload
+		if err := json.Unmarshal(msg.Payload, &input); err != nil {
+			c.sendError(msg.ID, "invalid payload")
+			return
+		}
+		result, err := c.mutateTask(msg.Type, input)
+		if err != nil {
+			c.sendError(msg.ID, err.Error())
+			return
+		}
+		c.ack(msg.ID, result)
+	default:
+		c.sendError(msg.ID, "unknown message type")
+	}
+}
+
+func (c *Client) mutateTask(messageType string, input taskPayload) (interface{}, error) {
+	tasks := c.hub.tasks
+	switch messageType {
+	case "task.create":
+		if input.Title == "" || input.Description == "" {
+			return nil, errors.New("title and description are required")
+		}
+		if err := tasks.CheckAssignee(input.AssigneeID); err != nil {
+			return nil, err
+		}
+		task := tasks.CreateTask(models.Task{
+			Title:       input.Title,
+			Description: input.Description,
+			CreatorID:   c.userID,
+			AssigneeID:  input.AssigneeID,
+			DueDate:     input.DueDate,
+		})
+		return task, nil
+	case "task.update":
+		return nil, tasks.UpdateTask(c.userID, input.ID, input.Title, input.Description, input.Status)
+	case "task.complete":
+		next, err := tasks.MarkTaskAsComplete(c.userID, input.ID)
+		if next != nil {
+			return map[string]*models.Task{"next_task": next}, err
+		}
+		return nil, err
+	case "task.delete":
+		return nil, tasks.DeleteTask(c.userID, input.ID)
+	default: // task.assign
+		return nil, tasks.AssignTask(c.userID, input.ID, input.AssigneeID)
+	}
+}
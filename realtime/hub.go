@@ -0,0 +1,226 @@
+// Package realtime implements the WebSocket collaboration hub: topic
+// subscriptions, presence tracking and task mutations over typed JSON messages.
+package realtime
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"task-manager/models"
+	"task-manager/services"
+
+	"github.com/gorilla/websocket"
+)
+
+// Topics clients can subscribe to.
+const (
+	// TasksTopic receives events for every task.
+	TasksTopic = "tasks"
+	// taskTopicPrefix followed by a task ID receives events and presence for that task.
+	taskTopicPrefix = "task:"
+)
+
+// Presence states.
+const (
+	Viewing = "viewing"
+	Editing = "editing"
+)
+
+// PresenceEntry is one user's presence on a topic.
+type PresenceEntry struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	State  string `json:"state"`
+}
+
+// Hub routes messages between connected clients and the task service.
+type Hub struct {
+	tasks *services.TaskService
+
+	mutex    sync.Mutex
+	clients  map[*Client]bool
+	topics   map[string]map[*Client]bool
+	presence map[string]map[*Client]string // topic -> client -> state
+	closed   bool
+}
+
+// NewHub creates a hub and subscribes it to task events.
+func NewHub(tasks *services.TaskService) *Hub {
+	h := &Hub{
+		tasks:    tasks,
+		clients:  map[*Client]bool{},
+		topics:   map[string]map[*Client]bool{},
+		presence: map[string]map[*Client]string{},
+	}
+	tasks.Subscribe(h.handleTaskEvent)
+	return h
+}
+
+// TaskTopic returns the topic of a single task.
+func TaskTopic(id int) string {
+	return taskTopicPrefix + strconv.Itoa(id)
+}
+
+func validTopic(topic string) bool {
+	if topic == TasksTopic {
+		return true
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(topic, taskTopicPrefix))
+	return strings.HasPrefix(topic, taskTopicPrefix) && err == nil && id > 0
+}
+
+// handleTaskEvent forwards task events to subscribers of the tasks topic and of the task's own topic.
+func (h *Hub) handleTaskEvent(event models.TaskEvent) {
+	switch event.Type {
+	case models.TaskCreated, models.TaskUpdated, models.TaskCompleted, models.TaskDeleted:
+	default:
+		return
+	}
+	payload, err := json.Marshal(map[string]interface{}{"task": event.Task, "actor_id": event.ActorID})
+	if err != nil {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	sent := map[*Client]bool{}
+	for _, topic := range []string{TaskTopic(event.Task.ID), TasksTopic} {
+		for client := range h.topics[topic] {
+			if sent[client] {
+				continue
+			}
+			sent[client] = true
+			client.send(Message{Type: string(event.Type), Topic: topic, Payload: payload})
+		}
+	}
+}
+
+func (h *Hub) subscribe(c *Client, topic string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.topics[topic] == nil {
+		h.topics[topic] = map[*Client]bool{}
+	}
+	h.topics[topic][c] = true
+	// Let the new subscriber see who is already there.
+	c.send(h.presenceMessageLocked(topic))
+}
+
+func (h *Hub) unsubscribe(c *Client, topic string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.unsubscribeLocked(c, topic)
+}
+
+func (h *Hub) unsubscribeLocked(c *Client, topic string) {
+	delete(h.topics[topic], c)
+	if len(h.topics[topic]) == 0 {
+		delete(h.topics, topic)
+	}
+	if _, ok := h.presence[topic][c]; ok {
+		delete(h.presence[topic], c)
+		if len(h.presence[topic]) == 0 {
+			delete(h.presence, topic)
+		}
+		h.broadcastPresenceLocked(topic)
+	}
+}
+
+// setPresence records the client's state on a topic it is subscribed to.
+// An empty state clears the client's presence.
+func (h *Hub) setPresence(c *Client, topic, state string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.topics[topic][c] {
+		return false
+	}
+	if state == "" {
+		delete(h.presence[topic], c)
+	} else {
+		if h.presence[topic] == nil {
+			h.presence[topic] = map[*Client]string{}
+		}
+		h.presence[topic][c] = state
+	}
+	h.broadcastPresenceLocked(topic)
+	return true
+}
+
+// Presence returns who is on a topic. A user connected more than once is
+// listed once, with "editing" taking precedence over "viewing".
+func (h *Hub) Presence(topic string) []PresenceEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.presenceLocked(topic)
+}
+
+func (h *Hub) presenceLocked(topic string) []PresenceEntry {
+	byUser := map[int]PresenceEntry{}
+	for client, state := range h.presence[topic] {
+		if existing, ok := byUser[client.userID]; ok && existing.State == Editing {
+			continue
+		}
+		byUser[client.userID] = PresenceEntry{UserID: client.userID, Email: client.email, State: state}
+	}
+	entries := make([]PresenceEntry, 0, len(byUser))
+	for _, entry := range byUser {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].UserID < entries[j].UserID })
+	return entries
+}
+
+func (h *Hub) presenceMessageLocked(topic string) Message {
+	payload, _ := json.Marshal(map[string]interface{}{"users": h.presenceLocked(topic)})
+	return Message{Type: "presence", Topic: topic, Payload: payload}
+}
+
+func (h *Hub) broadcastPresenceLocked(topic string) {
+	msg := h.presenceMessageLocked(topic)
+	for client := range h.topics[topic] {
+		client.send(msg)
+	}
+}
+
+// Close disconnects every client with a "going away" close message and
+// refuses new connections. It is called when the server shuts down, which
+// does not wait for hijacked connections such as WebSockets.
+func (h *Hub) Close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.closed = true
+	for client := range h.clients {
+		client.closeWith(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+// register adds a connected client, unless the hub is closed.
+func (h *Hub) register(c *Client) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return false
+	}
+	h.clients[c] = true
+	return true
+}
+
+// remove drops a disconnected client from all topics.
+func (h *Hub) remove(c *Client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.clients, c)
+	for topic, clients := range h.topics {
+		if clients[c] {
+			h.unsubscribeLocked(c, topic)
+		}
+	}
+}
@@ -4,16 +4,181 @@ import (
 	"net/http"
 	"task-manager/controllers"
 	"task-manager/middleware"
+	"task-manager/models"
 
 	"github.com/gorilla/mux"
 )
 
 func RegisterTaskRoutes(router *mux.Router, taskController *controllers.TaskController) {
 	api := router.PathPrefix("/api").Subrouter()
-	api.Handle("/tasks", middleware.JWTAuthMiddleware(http.HandlerFunc(taskController.CreateTask))).Methods(http.MethodPost)
-	api.Handle("/tasks", middleware.JWTAuthMiddleware(http.HandlerFunc(taskController.GetTasks))).Methods(http.MethodGet)
-	api.Handle("/tasks/{id:[0-9]+}", middleware.JWTAuthMiddleware(http.HandlerFunc(taskController.GetTaskByID))).Methods(http.MethodGet)
-	api.Handle("/tasks/{id:[0-9]+}", middleware.JWTAuthMiddleware(http.HandlerFunc(taskController.UpdateTask))).Methods(http.MethodPut)
-	api.Handle("/tasks/{id:[0-9]+}", middleware.JWTAuthMiddleware(http.HandlerFunc(taskController.DeleteTask))).Methods(http.MethodDelete)
-	api.Handle("/tasks/{id:[0-9]+}/complete", middleware.JWTAuthMiddleware(http.HandlerFunc(taskController.MarkTaskAsComplete))).Methods(http.MethodPatch)
+	api.Handle("/tasks", scoped(models.ScopeTasksWrite, taskController.CreateTask)).Methods(http.MethodPost)
+	api.Handle("/tasks", scoped(models.ScopeTasksRead, taskController.GetTasks)).Methods(http.MethodGet)
+	api.Handle("/tasks/{id:[0-9]+}", scoped(models.ScopeTasksRead, taskController.GetTaskByID)).Methods(http.MethodGet)
+	api.Handle("/tasks/{id:[0-9]+}", scoped(models.ScopeTasksWrite, taskController.UpdateTask)).Methods(http.MethodPut)
+	api.Handle("/tasks/{id:[0-9]+}", scoped(models.ScopeTasksWrite, taskController.DeleteTask)).Methods(http.MethodDelete)
+	api.Handle("/tasks/{id:[0-9]+}/complete", scoped(models.ScopeTasksWrite, taskController.MarkTaskAsComplete)).Methods(http.MethodPatch)
+	api.Handle("/tasks/{id:[0-9]+}/assign", scoped(models.ScopeTasksWrite, taskController.AssignTask)).Methods(http.MethodPatch)
+	api.Handle("/tasks/{id:[0-9]+}/occurrences", scoped(models.ScopeTasksRead, taskController.GetOccurrences)).Methods(http.MethodGet)
+}
+
+// scoped lets a route be used with a JWT or with a personal access token granted the scope.
+func scoped(scope string, handler http.HandlerFunc) http.Handler {
+	return middleware.TokenAuthMiddleware(scope, handler)
+}
+
+func RegisterAdminRoutes(router *mux.Router, jobController *controllers.JobController) {
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	admin.Handle("/jobs", adminOnly(jobController.GetJobs)).Methods(http.MethodGet)
+	admin.Handle("/jobs/{name}", adminOnly(jobController.GetJob)).Methods(http.MethodGet)
+}
+
+func adminOnly(handler http.HandlerFunc) http.Handler {
+	return middleware.JWTAuthMiddleware(middleware.AdminMiddleware(handler))
+}
+
+// ownerOnly is for account changes that administrators impersonating the user may not make.
+func ownerOnly(handler http.HandlerFunc) http.Handler {
+	return middleware.JWTAuthMiddleware(middleware.NotImpersonatingMiddleware(handler))
+}
+
+func RegisterUserAdminRoutes(router *mux.Router, adminController *controllers.AdminController) {
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	admin.Handle("/users", adminOnly(adminController.GetUsers)).Methods(http.MethodGet)
+	admin.Handle("/users/{id:[0-9]+}", adminOnly(adminController.GetUser)).Methods(http.MethodGet)
+	admin.Handle("/users/{id:[0-9]+}/disable", adminOnly(adminController.DisableUser)).Methods(http.MethodPost)
+	admin.Handle("/users/{id:[0-9]+}/enable", adminOnly(adminController.EnableUser)).Methods(http.MethodPost)
+	admin.Handle("/users/{id:[0-9]+}/password-reset", adminOnly(adminController.ForcePasswordReset)).Methods(http.MethodPost)
+	admin.Handle("/users/{id:[0-9]+}/role", adminOnly(adminController.SetRole)).Methods(http.MethodPut)
+	admin.Handle("/users/{id:[0-9]+}/impersonate", adminOnly(adminController.Impersonate)).Methods(http.MethodPost)
+	admin.Handle("/audit", adminOnly(adminController.GetAuditLog)).Methods(http.MethodGet)
+}
+
+func RegisterNotificationRoutes(router *mux.Router, notificationController *controllers.NotificationController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.Handle("/notifications", middleware.JWTAuthMiddleware(http.HandlerFunc(notificationController.GetNotifications))).Methods(http.MethodGet)
+	api.Handle("/notifications/read", middleware.JWTAuthMiddleware(http.HandlerFunc(notificationController.MarkAllAsRead))).Methods(http.MethodPost)
+	api.Handle("/notifications/preferences", middleware.JWTAuthMiddleware(http.HandlerFunc(notificationController.GetPreferences))).Methods(http.MethodGet)
+	api.Handle("/notifications/preferences", middleware.JWTAuthMiddleware(http.HandlerFunc(notificationController.UpdatePreferences))).Methods(http.MethodPut)
+	api.Handle("/notifications/{id:[0-9]+}/read", middleware.JWTAuthMiddleware(http.HandlerFunc(notificationController.MarkAsRead))).Methods(http.MethodPatch)
+}
+
+func RegisterEmailRoutes(router *mux.Router, emailController *controllers.EmailController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.Handle("/email/preferences", middleware.JWTAuthMiddleware(http.HandlerFunc(emailController.GetPreferences))).Methods(http.MethodGet)
+	api.Handle("/email/preferences", middleware.JWTAuthMiddleware(http.HandlerFunc(emailController.UpdatePreferences))).Methods(http.MethodPut)
+	api.HandleFunc("/email/unsubscribe", emailController.ConfirmUnsubscribe).Methods(http.MethodGet)
+	api.HandleFunc("/email/unsubscribe", emailController.Unsubscribe).Methods(http.MethodPost)
+}
+
+func RegisterWebhookRoutes(router *mux.Router, webhookController *controllers.WebhookController) {
+	api := router.PathPrefix("/api").Subrouter()
+	// Webhooks send the user's tasks elsewhere, so impersonators may not see or touch them.
+	api.Handle("/webhooks", ownerOnly(webhookController.CreateWebhook)).Methods(http.MethodPost)
+	api.Handle("/webhooks", ownerOnly(webhookController.GetWebhooks)).Methods(http.MethodGet)
+	api.Handle("/webhooks/{id:[0-9]+}", ownerOnly(webhookController.GetWebhook)).Methods(http.MethodGet)
+	api.Handle("/webhooks/{id:[0-9]+}", ownerOnly(webhookController.UpdateWebhook)).Methods(http.MethodPut)
+	api.Handle("/webhooks/{id:[0-9]+}", ownerOnly(webhookController.DeleteWebhook)).Methods(http.MethodDelete)
+	api.Handle("/webhooks/{id:[0-9]+}/deliveries", ownerOnly(webhookController.GetDeliveries)).Methods(http.MethodGet)
+	api.Handle("/webhooks/{id:[0-9]+}/deliveries/{deliveryID:[0-9]+}/redeliver", ownerOnly(webhookController.Redeliver)).Methods(http.MethodPost)
+}
+
+func RegisterEventRoutes(router *mux.Router, eventController *controllers.EventController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.Handle("/events", middleware.JWTAuthMiddleware(http.HandlerFunc(eventController.StreamEvents))).Methods(http.MethodGet)
+}
+
+func RegisterWebSocketRoutes(router *mux.Router, webSocketController *controllers.WebSocketController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.Handle("/ws", middleware.QueryTokenMiddleware(middleware.JWTAuthMiddleware(http.HandlerFunc(webSocketController.Connect)))).Methods(http.MethodGet)
+}
+
+func RegisterSyncRoutes(router *mux.Router, syncController *controllers.SyncController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.Handle("/sync", middleware.JWTAuthMiddleware(http.HandlerFunc(syncController.GetChanges))).Methods(http.MethodGet)
+	api.Handle("/sync", middleware.JWTAuthMiddleware(http.HandlerFunc(syncController.PushChanges))).Methods(http.MethodPost)
+}
+
+func RegisterAuthRoutes(router *mux.Router, userController *controllers.UserController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.Handle("/register", rateLimited(userController.Register)).Methods(http.MethodPost)
+	api.Handle("/login", rateLimited(userController.Login)).Methods(http.MethodPost)
+	api.Handle("/login/mfa", rateLimited(userController.LoginMFA)).Methods(http.MethodPost)
+	api.Handle("/token/refresh", rateLimited(userController.RefreshToken)).Methods(http.MethodPost)
+	api.Handle("/logout", middleware.JWTAuthMiddleware(http.HandlerFunc(userController.Logout))).Methods(http.MethodPost)
+	api.Handle("/logout/all", middleware.JWTAuthMiddleware(http.HandlerFunc(userController.LogoutAll))).Methods(http.MethodPost)
+	api.Handle("/me/login-attempts", middleware.JWTAuthMiddleware(http.HandlerFunc(userController.GetLoginAttempts))).Methods(http.MethodGet)
+	router.HandleFunc("/.well-known/jwks.json", userController.JWKS).Methods(http.MethodGet)
+}
+
+// rateLimited limits how often a client IP can call an unauthenticated endpoint.
+func rateLimited(handler http.HandlerFunc) http.Handler {
+	return middleware.AuthRateLimitMiddleware(handler)
+}
+
+func RegisterAccessTokenRoutes(router *mux.Router, accessTokenController *controllers.AccessTokenController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.Handle("/tokens", ownerOnly(accessTokenController.CreateToken)).Methods(http.MethodPost)
+	api.Handle("/tokens", middleware.JWTAuthMiddleware(http.HandlerFunc(accessTokenController.GetTokens))).Methods(http.MethodGet)
+	api.Handle("/tokens/{id:[0-9]+}", ownerOnly(accessTokenController.RevokeToken)).Methods(http.MethodDelete)
+}
+
+func RegisterSSORoutes(router *mux.Router, ssoController *controllers.SSOController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/sso/providers", ssoController.GetProviders).Methods(http.MethodGet)
+	api.HandleFunc("/sso/{provider}/login", ssoController.Login).Methods(http.MethodGet)
+	api.HandleFunc("/sso/{provider}/callback", ssoController.Callback).Methods(http.MethodGet)
+}
+
+func RegisterMFARoutes(router *mux.Router, mfaController *controllers.MFAController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.Handle("/me/2fa", middleware.JWTAuthMiddleware(http.HandlerFunc(mfaController.GetStatus))).Methods(http.MethodGet)
+	api.Handle("/me/2fa", ownerOnly(mfaController.Disable)).Methods(http.MethodDelete)
+	api.Handle("/me/2fa/enroll", ownerOnly(mfaController.Enroll)).Methods(http.MethodPost)
+	api.Handle("/me/2fa/confirm", ownerOnly(mfaController.ConfirmEnrollment)).Methods(http.MethodPost)
+	api.Handle("/me/2fa/recovery-codes", ownerOnly(mfaController.RegenerateRecoveryCodes)).Methods(http.MethodPost)
+	api.Handle("/admin/2fa", adminOnly(mfaController.SetRequirement)).Methods(http.MethodPut)
+}
+
+func RegisterAccountRoutes(router *mux.Router, accountController *controllers.AccountController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/email/verify", accountController.VerifyEmail).Methods(http.MethodGet, http.MethodPost)
+	api.Handle("/email/verify/resend", middleware.JWTAuthMiddleware(http.HandlerFunc(accountController.ResendVerification))).Methods(http.MethodPost)
+	api.Handle("/password/forgot", rateLimited(accountController.ForgotPassword)).Methods(http.MethodPost)
+	api.Handle("/password/reset", rateLimited(accountController.ResetPassword)).Methods(http.MethodPost)
+}
+
+func RegisterProfileRoutes(router *mux.Router, profileController *controllers.ProfileController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.Handle("/me", middleware.JWTAuthMiddleware(http.HandlerFunc(profileController.GetProfile))).Methods(http.MethodGet)
+	api.Handle("/me", ownerOnly(profileController.UpdateProfile)).Methods(http.MethodPatch)
+	api.Handle("/me", ownerOnly(profileController.DeleteAccount)).Methods(http.MethodDelete)
+	api.Handle("/me/password", ownerOnly(profileController.ChangePassword)).Methods(http.MethodPost)
+	api.Handle("/me/email", ownerOnly(profileController.ChangeEmail)).Methods(http.MethodPost)
+}
+
+func RegisterExportRoutes(router *mux.Router, exportController *controllers.ExportController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.Handle("/me/export", ownerOnly(exportController.RequestExport)).Methods(http.MethodPost)
+	api.Handle("/me/exports", middleware.JWTAuthMiddleware(http.HandlerFunc(exportController.GetExports))).Methods(http.MethodGet)
+	api.Handle("/me/exports/{id:[0-9]+}", middleware.JWTAuthMiddleware(http.HandlerFunc(exportController.GetExport))).Methods(http.MethodGet)
+	api.HandleFunc("/exports/download", exportController.Download).Methods(http.MethodGet)
+}
+
+func RegisterSessionRoutes(router *mux.Router, sessionController *controllers.SessionController) {
+	api := router.PathPrefix("/api").Subrouter()
+	api.Handle("/me/sessions", middleware.JWTAuthMiddleware(http.HandlerFunc(sessionController.GetSessions))).Methods(http.MethodGet)
+	api.Handle("/me/sessions/{id:[0-9a-f]+}", ownerOnly(sessionController.RevokeSession)).Methods(http.MethodDelete)
+}
+
+// RegisterHealthRoutes registers the probes, which need no authentication.
+func RegisterHealthRoutes(router *mux.Router, healthController *controllers.HealthController) {
+	router.HandleFunc("/healthz", healthController.Live).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/readyz", healthController.Ready).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/version", healthController.Version).Methods(http.MethodGet)
+}
+
+// RegisterMetricsRoutes serves the Prometheus metrics. Like the probes, they
+// need no authentication; keep /metrics off the public network.
+func RegisterMetricsRoutes(router *mux.Router, handler http.Handler) {
+	router.Handle("/metrics", handler).Methods(http.MethodGet)
 }
@@ -0,0 +1,269 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"task-manager/logging"
+	"time"
+)
+
+var logger = logging.For("scheduler")
+
+// JobFunc is the work performed by a job. It should return promptly once ctx is done.
+type JobFunc func(ctx context.Context) error
+
+// Job is the persisted state of a scheduled job.
+type Job struct {
+	Name        string        `json:"name"`
+	Interval    time.Duration `json:"interval"`
+	NextRun     time.Time     `json:"next_run"`
+	LastRun     *time.Time    `json:"last_run,omitempty"`
+	LastError   string        `json:"last_error,omitempty"`
+	Failures    int           `json:"failures"` // consecutive failed attempts
+	Runs        int           `json:"runs"`
+	LockedBy    string        `json:"locked_by,omitempty"`
+	LockedUntil time.Time     `json:"locked_until,omitempty"`
+}
+
+// Options tunes a Scheduler. Zero values fall back to sensible defaults.
+type Options struct {
+	TickInterval time.Duration    // how often due jobs are looked for
+	Timeout      time.Duration    // maximum run time of a job, also the lease length
+	MaxRetries   int              // failed attempts retried before waiting for the next interval
+	RetryBackoff time.Duration    // delay before the first retry, doubled on each further failure
+	Owner        string           // identifies this instance in job leases
+	Now          func() time.Time // current time, time.Now unless set by tests
+}
+
+type registration struct {
+	interval time.Duration
+	fn       JobFunc
+}
+
+// Scheduler runs registered jobs periodically. Job state lives in a Store so
+// that several instances sharing a store never run the same job concurrently.
+type Scheduler struct {
+	store   Store
+	opts    Options
+	jobs    map[string]registration
+	running map[string]bool
+	mutex   sync.Mutex
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+	stop    chan struct{}
+	done    chan struct{}
+	now     func() time.Time
+}
+
+func New(store Store, opts Options) *Scheduler {
+	if opts.TickInterval <= 0 {
+		opts.TickInterval = time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Minute
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 5
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 10 * time.Second
+	}
+	if opts.Owner == "" {
+		host, _ := os.Hostname()
+		opts.Owner = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Scheduler{
+		store:   store,
+		opts:    opts,
+		jobs:    map[string]registration{},
+		running: map[string]bool{},
+		now:     opts.Now,
+	}
+}
+
+// Register adds a job that runs every interval. The first run happens one
+// interval after the job is first stored; persisted jobs keep their schedule.
+func (s *Scheduler) Register(name string, interval time.Duration, fn JobFunc) error {
+	if interval <= 0 {
+		return errors.New("job interval must be positive")
+	}
+	if _, err := s.store.Ensure(Job{Name: name, Interval: interval, NextRun: s.now().Add(interval)}); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.jobs[name] = registration{interval: interval, fn: fn}
+	return nil
+}
+
+// Jobs returns the state of all stored jobs.
+func (s *Scheduler) Jobs() ([]Job, error) {
+	return s.store.List()
+}
+
+// Job returns the state of a single job.
+func (s *Scheduler) Job(name string) (*Job, error) {
+	return s.store.Get(name)
+}
+
+// Start begins running due jobs in the background until ctx is done or Stop is called.
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.opts.TickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.runDue(ctx)
+			}
+		}
+	}()
+}
+
+// Running reports whether the scheduler has been started and is still
+// looking for due jobs.
+func (s *Scheduler) Running() bool {
+	if s.done == nil {
+		return false
+	}
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Stop stops scheduling new runs and waits for running jobs to finish.
+// If ctx expires first, running jobs have their context cancelled and ctx.Err() is returned.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.done == nil {
+		return nil
+	}
+	close(s.stop)
+	<-s.done
+
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) runDue(ctx context.Context) {
+	jobs, err := s.store.List()
+	if err != nil {
+		return
+	}
+	now := s.now()
+	for _, job := range jobs {
+		s.mutex.Lock()
+		reg, registered := s.jobs[job.Name]
+		busy := s.running[job.Name]
+		s.mutex.Unlock()
+		if !registered || busy || now.Before(job.NextRun) {
+			continue
+		}
+
+		locked, err := s.store.TryLock(job.Name, s.opts.Owner, now.Add(s.opts.Timeout), now)
+		if err != nil || !locked {
+			continue
+		}
+		// Another instance may have run the job between List and TryLock.
+		current, err := s.store.Get(job.Name)
+		if err != nil || now.Before(current.NextRun) {
+			s.store.Unlock(job.Name, s.opts.Owner)
+			continue
+		}
+
+		s.mutex.Lock()
+		s.running[job.Name] = true
+		s.mutex.Unlock()
+		s.wg.Add(1)
+		go s.run(ctx, job.Name, reg)
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, name string, reg registration) {
+	defer s.wg.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.running, name)
+		s.mutex.Unlock()
+	}()
+
+	runCtx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	err := safeRun(runCtx, reg.fn)
+	cancel()
+
+	job, getErr := s.store.Get(name)
+	if getErr != nil {
+		return
+	}
+	finished := s.now()
+	job.LastRun = &finished
+	job.Runs++
+	job.LockedBy = ""
+	job.LockedUntil = time.Time{}
+	if err == nil {
+		job.LastError = ""
+		job.Failures = 0
+		job.NextRun = finished.Add(reg.interval)
+		logger.Debug("job finished", "job", name)
+	} else {
+		job.LastError = err.Error()
+		job.Failures++
+		job.NextRun = finished.Add(s.retryDelay(job.Failures, reg.interval))
+		logger.Error("job failed", "job", name, "failures", job.Failures, "next_run", job.NextRun, "error", err)
+	}
+	s.store.Save(*job)
+}
+
+// retryDelay returns the exponential backoff before the next attempt, capped at
+// the job interval. After MaxRetries failures the job waits a full interval.
+func (s *Scheduler) retryDelay(failures int, interval time.Duration) time.Duration {
+	if failures > s.opts.MaxRetries {
+		return interval
+	}
+	delay := s.opts.RetryBackoff << (failures - 1)
+	if delay <= 0 || delay > interval {
+		return interval
+	}
+	return delay
+}
+
+// safeRun turns a panicking job into a failed run instead of crashing the server.
+func safeRun(ctx context.Context, fn JobFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopLetsRunningJobsFinish(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		deadline  time.Duration
+		cancelled bool
+	}{
+		{"Finishes", time.Second, false},
+		{"CancelledAtDeadline", 10 * time.Millisecond, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			jobs := New(NewMemoryStore(), Options{TickInterval: time.Millisecond})
+			started := make(chan struct{})
+			result := make(chan error, 1)
+			assert.NoError(t, jobs.Register("slow", time.Millisecond, func(ctx context.Context) error {
+				close(started)
+				select {
+				case <-time.After(100 * time.Millisecond):
+					result <- nil
+				case <-ctx.Done():
+					result <- ctx.Err()
+				}
+				return nil
+			}))
+			jobs.Start(context.Background())
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tc.deadline)
+			defer cancel()
+			err := jobs.Stop(ctx)
+			if tc.cancelled {
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+				assert.ErrorIs(t, <-result, context.Canceled)
+			} else {
+				assert.NoError(t, err)
+				assert.NoError(t, <-result)
+			}
+			assert.False(t, jobs.Running())
+		})
+	}
+}
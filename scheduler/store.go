@@ -0,0 +1,268 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is returned when a job is not present in the store.
+var ErrJobNotFound = errors.New("job not found")
+
+// Store persists job state and leases. Implementations must make TryLock
+// atomic so that only one scheduler instance runs a job at a time.
+type Store interface {
+	List() ([]Job, error)
+	Get(name string) (*Job, error)
+	// Ensure creates the job if it does not exist yet and returns the stored state.
+	Ensure(job Job) (*Job, error)
+	Save(job Job) error
+	// TryLock takes the lease on a job for owner until the given time.
+	// It reports false if another owner holds an unexpired lease.
+	TryLock(name, owner string, until, now time.Time) (bool, error)
+	Unlock(name, owner string) error
+}
+
+// MemoryStore keeps jobs in memory. It is safe for a single process only.
+type MemoryStore struct {
+	jobs  map[string]Job
+	mutex sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: map[string]Job{}}
+}
+
+func (s *MemoryStore) List() ([]Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return sortedJobs(s.jobs), nil
+}
+
+func (s *MemoryStore) Get(name string) (*Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job, ok := s.jobs[name]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return &job, nil
+}
+
+func (s *MemoryStore) Ensure(job Job) (*Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ensureJob(s.jobs, &job)
+	return &job, nil
+}
+
+func (s *MemoryStore) Save(job Job) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.jobs[job.Name] = job
+	return nil
+}
+
+func (s *MemoryStore) TryLock(name, owner string, until, now time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return lockJob(s.jobs, name, owner, until, now)
+}
+
+func (s *MemoryStore) Unlock(name, owner string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unlockJob(s.jobs, name, owner)
+	return nil
+}
+
+// FileStore keeps jobs in a JSON file so that schedules, failure counts and
+// leases survive restarts and can be shared by several processes on one host.
+// Every operation holds an exclusive lock file while it reads and rewrites the state.
+type FileStore struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// staleLockAge is how old a lock file may get before it is assumed to be left
+// behind by a crashed process and removed.
+const staleLockAge = 30 * time.Second
+
+func NewFileStore(path string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{path: path}, nil
+}
+
+func (s *FileStore) List() ([]Job, error) {
+	var jobs []Job
+	err := s.update(false, func(m map[string]Job) error {
+		jobs = sortedJobs(m)
+		return nil
+	})
+	return jobs, err
+}
+
+func (s *FileStore) Get(name string) (*Job, error) {
+	var job Job
+	err := s.update(false, func(m map[string]Job) error {
+		j, ok := m[name]
+		if !ok {
+			return ErrJobNotFound
+		}
+		job = j
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *FileStore) Ensure(job Job) (*Job, error) {
+	err := s.update(true, func(m map[string]Job) error {
+		ensureJob(m, &job)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *FileStore) Save(job Job) error {
+	return s.update(true, func(m map[string]Job) error {
+		m[job.Name] = job
+		return nil
+	})
+}
+
+func (s *FileStore) TryLock(name, owner string, until, now time.Time) (bool, error) {
+	var locked bool
+	err := s.update(true, func(m map[string]Job) error {
+		var err error
+		locked, err = lockJob(m, name, owner, until, now)
+		return err
+	})
+	return locked, err
+}
+
+func (s *FileStore) Unlock(name, owner string) error {
+	return s.update(true, func(m map[string]Job) error {
+		unlockJob(m, name, owner)
+		return nil
+	})
+}
+
+// update loads the state under the lock file, applies fn and writes the state
+// back atomically when write is set.
+func (s *FileStore) update(write bool, fn func(map[string]Job) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	release, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	jobs := map[string]Job{}
+	data, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &jobs); err != nil {
+			return err
+		}
+	}
+
+	if err := fn(jobs); err != nil {
+		return err
+	}
+	if !write {
+		return nil
+	}
+
+	data, err = json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *FileStore) lock() (func(), error) {
+	lockPath := s.path + ".lock"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for job store lock")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func sortedJobs(m map[string]Job) []Job {
+	jobs := make([]Job, 0, len(m))
+	for _, job := range m {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// ensureJob keeps the persisted run state of an existing job but refreshes its
+// interval, so that changing a job's schedule in code takes effect on restart.
+func ensureJob(m map[string]Job, job *Job) {
+	if existing, ok := m[job.Name]; ok {
+		existing.Interval = job.Interval
+		*job = existing
+	}
+	m[job.Name] = *job
+}
+
+func lockJob(m map[string]Job, name, owner string, until, now time.Time) (bool, error) {
+	job, ok := m[name]
+	if !ok {
+		return false, ErrJobNotFound
+	}
+	if job.LockedBy != "" && job.LockedBy != owner && now.Before(job.LockedUntil) {
+		return false, nil
+	}
+	job.LockedBy = owner
+	job.LockedUntil = until
+	m[name] = job
+	return true, nil
+}
+
+func unlockJob(m map[string]Job, name, owner string) {
+	job, ok := m[name]
+	if !ok || job.LockedBy != owner {
+		return
+	}
+	job.LockedBy = ""
+	job.LockedUntil = time.Time{}
+	m[name] = job
+}
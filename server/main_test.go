@@ -0,0 +1,14 @@
+package server
+
+import (
+	"io"
+	"os"
+	"task-manager/logging"
+	"testing"
+)
+
+// TestMain keeps the log lines written while reloading certificates out of the test output.
+func TestMain(m *testing.M) {
+	logging.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
@@ -0,0 +1,108 @@
+// Package server runs the HTTP server: listening on TCP or a Unix socket,
+// optionally with TLS, and draining requests in flight on shutdown.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"task-manager/config"
+	"task-manager/logging"
+	"time"
+)
+
+var logger = logging.For("server")
+
+// Server is an HTTP server bound to its listener.
+type Server struct {
+	http     *http.Server
+	listener net.Listener
+}
+
+// New listens on cfg.Addr and returns a server for handler. A stale Unix
+// socket left behind by a previous run is removed first.
+func New(cfg config.ServerConfig, handler http.Handler) (*Server, error) {
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.IdleTimeout),
+	}
+
+	listener, err := listen(cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TLSCertFile != "" {
+		certificates, err := newCertificateReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certificates.GetCertificate,
+		}
+	}
+
+	return &Server{http: srv, listener: listener}, nil
+}
+
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		// A socket nobody accepts on is left over from a previous run.
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// RegisterOnShutdown registers fn to be called when shutdown starts. Use it
+// to close hijacked and long-lived connections, such as WebSockets and event
+// streams, which shutdown does not wait for.
+func (s *Server) RegisterOnShutdown(fn func()) {
+	s.http.RegisterOnShutdown(fn)
+}
+
+// Serve serves requests until Shutdown is called, after which it returns nil.
+func (s *Server) Serve() error {
+	var err error
+	if s.http.TLSConfig != nil {
+		err = s.http.ServeTLS(s.listener, "", "") // certificates come from TLSConfig
+	} else {
+		err = s.http.Serve(s.listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for requests in flight to
+// finish. When ctx expires first, the remaining connections are closed and
+// ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.http.Shutdown(ctx); err != nil {
+		s.http.Close()
+		return err
+	}
+	return nil
+}
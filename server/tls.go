@@ -0,0 +1,87 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadCheckInterval limits how often the certificate files are checked for changes.
+const reloadCheckInterval = time.Second
+
+// certificateReloader serves a certificate from files, loading it again when
+// either file changes so that renewed certificates need no restart.
+type certificateReloader struct {
+	certFile, keyFile string
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	modified    time.Time // latest modification time of the two files
+	checked     time.Time
+	now         func() time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	r := &certificateReloader{certFile: certFile, keyFile: keyFile, now: time.Now}
+	modified, err := r.modTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modified); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate for tls.Config. When the
+// files changed but cannot be loaded, for instance because only one of them
+// has been written yet, the previous certificate is kept.
+func (r *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.now()
+	if now.Sub(r.checked) < reloadCheckInterval {
+		return r.certificate, nil
+	}
+	r.checked = now
+
+	modified, err := r.modTime()
+	if err == nil && modified.After(r.modified) {
+		err = r.load(modified)
+		if err == nil {
+			logger.Info("reloaded TLS certificate", "file", r.certFile)
+		}
+	}
+	if err != nil {
+		logger.Error("could not reload TLS certificate, keeping the current one", "error", err)
+	}
+	return r.certificate, nil
+}
+
+// load reads the key pair; the caller holds the mutex unless r is new.
+func (r *certificateReloader) load(modified time.Time) error {
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load TLS certificate: %w", err)
+	}
+	r.certificate = &certificate
+	r.modified = modified
+	return nil
+}
+
+func (r *certificateReloader) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("could not read TLS certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
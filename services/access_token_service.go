@@ -0,0 +1,160 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"task-manager/models"
+	"task-manager/utils"
+	"time"
+)
+
+// maxAccessTokensPerUser limits how many personal access tokens a user can have.
+const maxAccessTokensPerUser = 50
+
+// ErrAccessTokenNotFound is returned for tokens that do not exist or belong to another user.
+var ErrAccessTokenNotFound = errors.New("access token not found")
+
+// AccessTokenService manages personal access tokens.
+type AccessTokenService struct {
+	users  *UserService
+	tokens []models.PersonalAccessToken
+	nextID int
+	mutex  sync.Mutex
+}
+
+func NewAccessTokenService(users *UserService) *AccessTokenService {
+	return &AccessTokenService{users: users, nextID: 1}
+}
+
+// CreateToken creates a token for the user and returns it together with its
+// secret value, which is not stored and cannot be retrieved again.
+func (s *AccessTokenService) CreateToken(userID int, name string, scopes []string, expiresAt *time.Time) (*models.PersonalAccessToken, string, error) {
+	if name == "" {
+		return nil, "", errors.New("name is required")
+	}
+	if len(scopes) == 0 {
+		return nil, "", errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(models.Scopes, scope) {
+			return nil, "", errors.New("unknown scope " + scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", errors.New("expires_at must be in the future")
+	}
+
+	random, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret := models.PersonalAccessTokenPrefix + random
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, token := range s.tokens {
+		if token.UserID == userID {
+			count++
+		}
+	}
+	if count >= maxAccessTokensPerUser {
+		return nil, "", errors.New("too many access tokens")
+	}
+
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+	token := models.PersonalAccessToken{
+		ID:        s.nextID,
+		UserID:    userID,
+		Name:      name,
+		Scopes:    slices.Compact(scopes),
+		Hint:      secret[len(secret)-4:],
+		Hash:      utils.HashToken(secret),
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	s.tokens = append(s.tokens, token)
+	s.nextID++
+	return &token, secret, nil
+}
+
+// GetTokens returns the user's tokens.
+func (s *AccessTokenService) GetTokens(userID int) []models.PersonalAccessToken {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tokens := []models.PersonalAccessToken{}
+	for _, token := range s.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// RevokeToken deletes one of the user's tokens.
+func (s *AccessTokenService) RevokeToken(userID, id int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, token := range s.tokens {
+		if token.ID == id && token.UserID == userID {
+			s.tokens = append(s.tokens[:i], s.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return ErrAccessTokenNotFound
+}
+
+// Authenticate returns the claims of a valid token and records that it was used.
+// It is used by middleware.TokenAuthMiddleware.
+func (s *AccessTokenService) Authenticate(secret string) (*utils.Claims, error) {
+	hash := utils.HashToken(secret)
+	now := time.Now()
+
+	s.mutex.Lock()
+	var token *models.PersonalAccessToken
+	for i := range s.tokens {
+		if s.tokens[i].Hash == hash {
+			token = &s.tokens[i]
+			break
+		}
+	}
+	if token == nil || (token.ExpiresAt != nil && now.After(*token.ExpiresAt)) {
+		s.mutex.Unlock()
+		return nil, utils.ErrUnauthorized
+	}
+	token.LastUsedAt = &now
+	userID, scopes := token.UserID, token.Scopes
+	s.mutex.Unlock()
+
+	user, err := s.users.GetUserByID(userID)
+	if err != nil || user.Disabled {
+		return nil, utils.ErrUnauthorized
+	}
+	return &utils.Claims{UserID: user.ID, Email: user.Email, Scopes: scopes}, nil
+}
+
+// RevokeAll revokes all of the user's tokens and returns how many there were.
+func (s *AccessTokenService) RevokeAll(userID int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tokens := s.tokens[:0]
+	for _, token := range s.tokens {
+		if token.UserID != userID {
+			tokens = append(tokens, token)
+		}
+	}
+	revoked := len(s.tokens) - len(tokens)
+	s.tokens = tokens
+	return revoked
+}
+
+// HandleUserDeleted deletes a deleted user's tokens.
+// It is meant to be registered with UserService.OnDelete.
+func (s *AccessTokenService) HandleUserDeleted(userID, _ int) {
+	s.RevokeAll(userID)
+}
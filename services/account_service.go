@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"sync"
+	"task-manager/mailer"
+	"task-manager/models"
+	"task-manager/utils"
+	"time"
+)
+
+const (
+	verificationTokenTTL  = 24 * time.Hour
+	passwordResetTokenTTL = time.Hour
+	// passwordResetSendTimeout bounds sending a reset email in the background.
+	passwordResetSendTimeout = time.Minute
+)
+
+// ErrInvalidAccountToken is returned for verification and reset tokens that
+// are unknown, expired or already used.
+var ErrInvalidAccountToken = errors.New("invalid or expired token")
+
+type accountTokenPurpose string
+
+const (
+	purposeVerifyEmail   accountTokenPurpose = "verify_email"
+	purposeResetPassword accountTokenPurpose = "reset_password"
+	purposeChangeEmail   accountTokenPurpose = "change_email"
+)
+
+// accountToken is a single-use token sent by email. Only its hash is stored.
+type accountToken struct {
+	userID    int
+	purpose   accountTokenPurpose
+	email     string // the address the token was sent to; the new address for email changes
+	expiresAt time.Time
+}
+
+// AccountService verifies email addresses and resets forgotten passwords
+// through links sent by email.
+type AccountService struct {
+	users        *UserService
+	tokens       *TokenService
+	accessTokens *AccessTokenService // revoked on password reset, if set
+	mailer       mailer.Mailer
+	apiURL       string                  // public address of the API, for verification links
+	appURL       string                  // address of the web app, for password reset links
+	pending      map[string]accountToken // by token hash
+	mutex        sync.Mutex
+	sending      sync.WaitGroup // password reset emails being sent
+}
+
+// NewAccountService creates an AccountService. Verification links point to
+// apiURL; password reset links point to appURL + "/reset-password", where the
+// app is expected to ask for the new password and call ResetPassword.
+func NewAccountService(users *UserService, tokens *TokenService, m mailer.Mailer, apiURL, appURL string) *AccountService {
+	return &AccountService{
+		users:   users,
+		tokens:  tokens,
+		mailer:  m,
+		apiURL:  apiURL,
+		appURL:  appURL,
+		pending: map[string]accountToken{},
+	}
+}
+
+// SetAccessTokenService makes ResetPassword revoke the user's personal access
+// tokens along with their sessions.
+func (s *AccountService) SetAccessTokenService(accessTokens *AccessTokenService) {
+	s.accessTokens = accessTokens
+}
+
+// SendVerification emails the user a link to verify their email address.
+func (s *AccountService) SendVerification(ctx context.Context, user *models.User) error {
+	if user.EmailVerified {
+		return nil
+	}
+	token, err := s.newToken(user, purposeVerifyEmail, verificationTokenTTL)
+	if err != nil {
+		return err
+	}
+	msg, err := mailer.Render("verify_email", []string{user.Email}, "Verify your email address", map[string]interface{}{
+		"Email":     user.Email,
+		"URL":       s.apiURL + "/api/email/verify?token=" + url.QueryEscape(token),
+		"ExpiresIn": "24 hours",
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, msg)
+}
+
+// VerifyEmail marks the email address a verification token was sent to as
+// verified. For tokens sent by RequestEmailChange, it switches the user to
+// the new address.
+func (s *AccountService) VerifyEmail(token string) (*models.User, error) {
+	pending, user, err := s.useToken(token, purposeVerifyEmail, purposeChangeEmail)
+	if err != nil {
+		return nil, err
+	}
+	if pending.purpose == purposeChangeEmail {
+		return s.users.ChangeEmail(user.ID, pending.email)
+	}
+	// The user may have changed their address since the link was sent.
+	if user.Email != pending.email {
+		return nil, ErrInvalidAccountToken
+	}
+	if err := s.users.MarkEmailVerified(user.ID); err != nil {
+		return nil, err
+	}
+	return s.users.GetUserByID(user.ID)
+}
+
+// RequestEmailChange checks the user's password and emails a link to the new
+// address. The user keeps their current address until they open it; links
+// sent for earlier changes stop working.
+func (s *AccountService) RequestEmailChange(ctx context.Context, userID int, email, password string) error {
+	email = normalizeEmail(email)
+	user, err := s.users.CheckEmailChange(userID, email, password)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	for hash, pending := range s.pending {
+		if pending.userID == user.ID && pending.purpose == purposeChangeEmail {
+			delete(s.pending, hash)
+		}
+	}
+	s.mutex.Unlock()
+
+	token, err := s.newToken(&models.User{ID: user.ID, Email: email}, purposeChangeEmail, verificationTokenTTL)
+	if err != nil {
+		return err
+	}
+	msg, err := mailer.Render("change_email", []string{email}, "Confirm your new email address", map[string]interface{}{
+		"Email":     email,
+		"URL":       s.apiURL + "/api/email/verify?token=" + url.QueryEscape(token),
+		"ExpiresIn": "24 hours",
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, msg)
+}
+
+// ForgotPassword emails a password reset link if a user with the address exists.
+// Callers must respond the same way whether or not it does, so that the
+// endpoint cannot be used to find out who has an account. The email is sent
+// in the background, so that the time taken does not tell either; failures
+// are logged.
+func (s *AccountService) ForgotPassword(ctx context.Context, email string) {
+	user, err := s.users.GetUserByEmail(email)
+	if err != nil {
+		return
+	}
+	s.sending.Add(1)
+	go func() {
+		defer s.sending.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), passwordResetSendTimeout)
+		defer cancel()
+		if err := s.SendPasswordReset(ctx, user); err != nil {
+			logger.ErrorContext(ctx, "could not send password reset email", "user_id", user.ID, "error", err)
+		}
+	}()
+}
+
+// Wait blocks until the password reset emails being sent are done.
+func (s *AccountService) Wait() {
+	s.sending.Wait()
+}
+
+// SendPasswordReset emails the user a password reset link. Links sent
+// earlier stop working.
+func (s *AccountService) SendPasswordReset(ctx context.Context, user *models.User) error {
+	s.mutex.Lock()
+	// Only the most recent reset link works.
+	for hash, pending := range s.pending {
+		if pending.userID == user.ID && pending.purpose == purposeResetPassword {
+			delete(s.pending, hash)
+		}
+	}
+	s.mutex.Unlock()
+
+	token, err := s.newToken(user, purposeResetPassword, passwordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+	msg, err := mailer.Render("password_reset", []string{user.Email}, "Reset your password", map[string]interface{}{
+		"Email":     user.Email,
+		"URL":       s.appURL + "/reset-password?token=" + url.QueryEscape(token),
+		"ExpiresIn": "1 hour",
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, msg)
+}
+
+// ResetPassword sets a new password with a reset token, ends all of the
+// user's sessions and revokes their personal access tokens, so that whoever
+// had access to the account loses it. Receiving the link proves the email
+// address as well, unless the user has changed it since.
+func (s *AccountService) ResetPassword(token, password string) error {
+	if password == "" {
+		return errors.New("password is required")
+	}
+	pending, user, err := s.useToken(token, purposeResetPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.users.SetPassword(user.ID, password); err != nil {
+		if errors.Is(err, ErrWeakPassword) {
+			// Let the user try again with a better password.
+			s.mutex.Lock()
+			s.pending[utils.HashToken(token)] = pending
+			s.mutex.Unlock()
+		}
+		return err
+	}
+	if user.Email == pending.email {
+		s.users.MarkEmailVerified(user.ID)
+	}
+	if s.tokens != nil {
+		s.tokens.LogoutAll(user.ID)
+	}
+	if s.accessTokens != nil {
+		s.accessTokens.RevokeAll(user.ID)
+	}
+	return nil
+}
+
+// PurgeExpired forgets expired tokens.
+func (s *AccountService) PurgeExpired(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for hash, pending := range s.pending {
+		if now.After(pending.expiresAt) {
+			delete(s.pending, hash)
+		}
+	}
+}
+
+func (s *AccountService) newToken(user *models.User, purpose accountTokenPurpose, ttl time.Duration) (string, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending[utils.HashToken(token)] = accountToken{userID: user.ID, purpose: purpose, email: user.Email, expiresAt: time.Now().Add(ttl)}
+	return token, nil
+}
+
+// HandleUserDeleted forgets the links sent to a deleted user.
+// It is meant to be registered with UserService.OnDelete.
+func (s *AccountService) HandleUserDeleted(userID, _ int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for hash, pending := range s.pending {
+		if pending.userID == userID {
+			delete(s.pending, hash)
+		}
+	}
+}
+
+// useToken consumes a token of one of the given purposes and returns its user.
+func (s *AccountService) useToken(token string, purposes ...accountTokenPurpose) (accountToken, *models.User, error) {
+	hash := utils.HashToken(token)
+
+	s.mutex.Lock()
+	pending, ok := s.pending[hash]
+	ok = ok && slices.Contains(purposes, pending.purpose)
+	if ok {
+		delete(s.pending, hash)
+	}
+	s.mutex.Unlock()
+
+	if !ok || time.Now().After(pending.expiresAt) {
+		return accountToken{}, nil, ErrInvalidAccountToken
+	}
+	user, err := s.users.GetUserByID(pending.userID)
+	if err != nil {
+		return accountToken{}, nil, ErrInvalidAccountToken
+	}
+	return pending, user, nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"sync"
+	"task-manager/models"
+	"time"
+)
+
+// maxAuditEntries is how many audit entries are kept; the oldest are dropped first.
+const maxAuditEntries = 10000
+
+// AuditService keeps a log of administrative actions and of requests made
+// while impersonating users.
+type AuditService struct {
+	entries []models.AuditEntry // oldest first
+	nextID  int
+	mutex   sync.Mutex
+}
+
+func NewAuditService() *AuditService {
+	return &AuditService{nextID: 1}
+}
+
+// Record adds an entry to the log.
+func (s *AuditService) Record(entry models.AuditEntry) models.AuditEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry.ID = s.nextID
+	entry.CreatedAt = time.Now()
+	s.nextID++
+	s.entries = append(s.entries, entry)
+	if len(s.entries) > maxAuditEntries {
+		s.entries = append([]models.AuditEntry{}, s.entries[len(s.entries)-maxAuditEntries:]...)
+	}
+	return entry
+}
+
+// GetEntries returns the entries involving the user, as actor, impersonator
+// or target, newest first. All entries are returned when userID is 0.
+func (s *AuditService) GetEntries(userID int) []models.AuditEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := []models.AuditEntry{}
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		entry := s.entries[i]
+		if userID == 0 || entry.ActorID == userID || entry.ImpersonatorID == userID || entry.TargetUserID == userID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"task-manager/mailer"
+	"task-manager/models"
+	"task-manager/utils"
+	"time"
+)
+
+const unsubscribePurpose = "unsubscribe"
+
+// taskChange is one line of a batched task update email.
+type taskChange struct {
+	TaskID  int
+	Title   string
+	Summary string
+}
+
+// digestTask is a task as shown in the daily digest.
+type digestTask struct {
+	Title   string
+	DueDate string
+}
+
+// EmailService emails assignees about task changes and sends daily digests.
+// Task changes are queued per user and sent together by FlushPending, so a
+// burst of edits results in a single email.
+type EmailService struct {
+	mailer      mailer.Mailer
+	users       *UserService
+	tasks       *TaskService
+	baseURL     string
+	signingKey  []byte
+	preferences map[int]models.EmailPreferences
+	pending     map[int][]taskChange
+	lastDigest  map[int]string // local date of the last digest per user
+	mutex       sync.Mutex
+}
+
+// NewEmailService creates an EmailService. baseURL is the public address of the
+// API used in unsubscribe links; signingKey signs unsubscribe tokens.
+func NewEmailService(m mailer.Mailer, users *UserService, tasks *TaskService, baseURL string, signingKey []byte) *EmailService {
+	return &EmailService{
+		mailer:      m,
+		users:       users,
+		tasks:       tasks,
+		baseURL:     baseURL,
+		signingKey:  signingKey,
+		preferences: map[int]models.EmailPreferences{},
+		pending:     map[int][]taskChange{},
+		lastDigest:  map[int]string{},
+	}
+}
+
+// HandleTaskEvent queues an email for the assignee of a changed task.
+// It is meant to be registered with TaskService.Subscribe.
+func (s *EmailService) HandleTaskEvent(event models.TaskEvent) {
+	task := event.Task
+	var summary string
+	switch event.Type {
+	case models.TaskAssigned:
+		summary = "assigned to you"
+	case models.TaskStatusChanged:
+		summary = fmt.Sprintf("status changed to %s", task.Status)
+	case models.TaskCompleted:
+		summary = "completed"
+	case models.TaskDeleted:
+		summary = "deleted"
+	case models.TaskUpdated:
+		// Status and assignee changes are reported by their own events.
+		if event.Previous == nil || (event.Previous.Title == task.Title && event.Previous.Description == task.Description) {
+			return
+		}
+		summary = "details updated"
+	default:
+		return
+	}
+
+	if task.AssigneeID == 0 || task.AssigneeID == event.ActorID {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.preferencesLocked(task.AssigneeID).TaskUpdates {
+		return
+	}
+	s.pending[task.AssigneeID] = append(s.pending[task.AssigneeID], taskChange{TaskID: task.ID, Title: task.Title, Summary: summary})
+}
+
+// FlushPending sends one email per user with all queued task changes.
+// Changes for users whose email could not be sent stay queued for the next flush.
+func (s *EmailService) FlushPending(ctx context.Context) error {
+	s.mutex.Lock()
+	pending := s.pending
+	s.pending = map[int][]taskChange{}
+	s.mutex.Unlock()
+
+	var errs []error
+	for userID, changes := range pending {
+		user, err := s.users.GetUserByID(userID)
+		if err != nil {
+			continue
+		}
+		msg, err := mailer.Render("task_updates", []string{user.Email}, taskUpdatesSubject(changes), map[string]interface{}{
+			"Email":          user.Email,
+			"Changes":        changes,
+			"UnsubscribeURL": s.UnsubscribeURL(userID),
+		})
+		if err == nil {
+			msg.Headers = s.unsubscribeHeaders(userID)
+			err = s.mailer.Send(ctx, msg)
+		}
+		if err != nil {
+			logger.WarnContext(ctx, "could not send task updates, keeping them queued", "user_id", userID, "error", err)
+			errs = append(errs, err)
+			s.mutex.Lock()
+			s.pending[userID] = append(changes, s.pending[userID]...)
+			s.mutex.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func taskUpdatesSubject(changes []taskChange) string {
+	if len(changes) == 1 {
+		return fmt.Sprintf("Task %q %s", changes[0].Title, changes[0].Summary)
+	}
+	return fmt.Sprintf("%d updates to your tasks", len(changes))
+}
+
+// SendDigests sends the daily digest to every user whose digest hour has been
+// reached in their time zone and who has not received today's digest yet.
+// Users with no due or overdue tasks are skipped for the day.
+func (s *EmailService) SendDigests(ctx context.Context, now time.Time) error {
+	var errs []error
+	for _, user := range s.users.GetUsers() {
+		s.mutex.Lock()
+		prefs := s.preferencesLocked(user.ID)
+		lastDigest := s.lastDigest[user.ID]
+		s.mutex.Unlock()
+		if !prefs.Digest {
+			continue
+		}
+
+		loc, err := time.LoadLocation(prefs.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		local := now.In(loc)
+		today := local.Format("2006-01-02")
+		if local.Hour() < prefs.DigestHour || lastDigest == today {
+			continue
+		}
+
+		var overdue, dueToday []digestTask
+		for _, task := range s.tasks.GetOpenTasksForUser(user.ID) {
+			if task.DueDate == nil {
+				continue
+			}
+			due := task.DueDate.In(loc)
+			entry := digestTask{Title: task.Title, DueDate: due.Format("Mon Jan 2 15:04")}
+			switch {
+			case due.Before(now):
+				overdue = append(overdue, entry)
+			case due.Format("2006-01-02") == today:
+				dueToday = append(dueToday, entry)
+			}
+		}
+
+		if len(overdue) > 0 || len(dueToday) > 0 {
+			msg, err := mailer.Render("digest", []string{user.Email}, "Your task digest for "+local.Format("Mon Jan 2"), map[string]interface{}{
+				"Email":          user.Email,
+				"Date":           local.Format("Monday, January 2"),
+				"Overdue":        overdue,
+				"DueToday":       dueToday,
+				"UnsubscribeURL": s.UnsubscribeURL(user.ID),
+			})
+			if err == nil {
+				msg.Headers = s.unsubscribeHeaders(user.ID)
+				err = s.mailer.Send(ctx, msg)
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+
+		s.mutex.Lock()
+		s.lastDigest[user.ID] = today
+		s.mutex.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// GetPreferences returns the user's email preferences.
+func (s *EmailService) GetPreferences(userID int) models.EmailPreferences {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.preferencesLocked(userID)
+}
+
+func (s *EmailService) preferencesLocked(userID int) models.EmailPreferences {
+	if prefs, ok := s.preferences[userID]; ok {
+		return prefs
+	}
+	return models.DefaultEmailPreferences
+}
+
+// UpdatePreferences validates and stores the user's email preferences.
+func (s *EmailService) UpdatePreferences(userID int, prefs models.EmailPreferences) error {
+	if prefs.DigestHour < 0 || prefs.DigestHour > 23 {
+		return errors.New("digest_hour must be between 0 and 23")
+	}
+	if prefs.Timezone == "" {
+		prefs.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(prefs.Timezone); err != nil {
+		return errors.New("invalid timezone")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.preferences[userID] = prefs
+	return nil
+}
+
+// UnsubscribeURL returns a link that turns off all emails for the user without logging in.
+func (s *EmailService) UnsubscribeURL(userID int) string {
+	token := utils.SignValue(s.signingKey, unsubscribePurpose, strconv.Itoa(userID))
+	return s.baseURL + "/api/email/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+// unsubscribeHeaders offers RFC 8058 one-click unsubscription: mail clients
+// POST to the link, while following it in a browser asks for confirmation.
+func (s *EmailService) unsubscribeHeaders(userID int) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + s.UnsubscribeURL(userID) + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// Unsubscribe turns off task update emails and digests for the user identified by a signed token.
+func (s *EmailService) Unsubscribe(token string) error {
+	value, err := utils.VerifySignedValue(s.signingKey, unsubscribePurpose, token)
+	if err != nil {
+		return err
+	}
+	userID, err := strconv.Atoi(value)
+	if err != nil {
+		return utils.ErrInvalidInput
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	prefs := s.preferencesLocked(userID)
+	prefs.TaskUpdates = false
+	prefs.Digest = false
+	s.preferences[userID] = prefs
+	delete(s.pending, userID)
+	return nil
+}
+
+// HandleUserDeleted forgets a deleted user's preferences and the changes
+// queued for them.
+// It is meant to be registered with UserService.OnDelete.
+func (s *EmailService) HandleUserDeleted(userID, _ int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.preferences, userID)
+	delete(s.pending, userID)
+	delete(s.lastDigest, userID)
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"task-manager/models"
+)
+
+const (
+	// defaultReplayBufferSize is the number of recent events kept for resuming streams.
+	defaultReplayBufferSize = 1000
+	// streamBufferSize is how many events a stream subscriber may lag behind before it is dropped.
+	streamBufferSize = 64
+)
+
+// ErrEventsExpired is returned when a stream asks to resume after an event
+// that is no longer in the replay buffer.
+var ErrEventsExpired = errors.New("requested events are no longer available")
+
+// EventBus fans task events out to handlers and stream subscribers. Every
+// published event gets an increasing ID, and the most recent events are kept
+// so that a reconnecting stream can resume where it left off.
+type EventBus struct {
+	mutex    sync.Mutex
+	nextID   int64
+	buffer   []models.TaskEvent // ring buffer of recent events
+	start    int                // index of the oldest event in buffer
+	size     int
+	handlers []func(models.TaskEvent)
+	streams  map[chan models.TaskEvent]struct{}
+}
+
+// NewEventBus creates an event bus keeping the given number of events for replay.
+func NewEventBus(replaySize int) *EventBus {
+	if replaySize <= 0 {
+		replaySize = defaultReplayBufferSize
+	}
+	return &EventBus{
+		nextID:  1,
+		buffer:  make([]models.TaskEvent, replaySize),
+		streams: map[chan models.TaskEvent]struct{}{},
+	}
+}
+
+// Subscribe registers fn to be called synchronously for every published event.
+func (b *EventBus) Subscribe(fn func(models.TaskEvent)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.handlers = append(b.handlers, fn)
+}
+
+// Publish assigns the event an ID, records it for replay and delivers it.
+// Stream subscribers that are too far behind are dropped; their channel is
+// closed so they can reconnect and resume from the replay buffer.
+func (b *EventBus) Publish(event models.TaskEvent) models.TaskEvent {
+	b.mutex.Lock()
+	event.ID = b.nextID
+	b.nextID++
+	b.buffer[(b.start+b.size)%len(b.buffer)] = event
+	if b.size < len(b.buffer) {
+		b.size++
+	} else {
+		b.start = (b.start + 1) % len(b.buffer)
+	}
+	for ch := range b.streams {
+		select {
+		case ch <- event:
+		default:
+			delete(b.streams, ch)
+			close(ch)
+		}
+	}
+	handlers := b.handlers
+	b.mutex.Unlock()
+
+	for _, fn := range handlers {
+		fn(event)
+	}
+	return event
+}
+
+// Stream subscribes to events published after the event with ID lastEventID.
+// Events still in the replay buffer are returned first; live events follow on
+// the channel. Pass 0 to only receive new events. The returned function
+// unsubscribes and must be called when the stream ends.
+func (b *EventBus) Stream(lastEventID int64) ([]models.TaskEvent, <-chan models.TaskEvent, func(), error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var replay []models.TaskEvent
+	if lastEventID > 0 {
+		// IDs from the future come from before a restart.
+		oldest := b.nextID - int64(b.size)
+		if lastEventID >= b.nextID || lastEventID+1 < oldest {
+			return nil, nil, nil, ErrEventsExpired
+		}
+		for i := 0; i < b.size; i++ {
+			event := b.buffer[(b.start+i)%len(b.buffer)]
+			if event.ID > lastEventID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	ch := make(chan models.TaskEvent, streamBufferSize)
+	b.streams[ch] = struct{}{}
+	cancel := func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if _, ok := b.streams[ch]; ok {
+			delete(b.streams, ch)
+			close(ch)
+		}
+	}
+	return replay, ch, cancel, nil
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"task-manager/models"
+	"task-manager/utils"
+	"time"
+)
+
+const (
+	// exportTTL is how long a finished export can be downloaded.
+	exportTTL     = 24 * time.Hour
+	exportPurpose = "data-export"
+	// maxExportsPerUser is how many exports are kept per user; the oldest
+	// finished one is dropped to make room for a new one.
+	maxExportsPerUser = 3
+	// maxPendingExports is how many exports are built at a time, across users.
+	maxPendingExports = 4
+)
+
+var (
+	ErrExportNotFound   = errors.New("export not found")
+	ErrExportInProgress = errors.New("an export is already in progress")
+	// ErrTooManyExports is returned when the user has requested too many
+	// exports lately, or too many are being built for everyone.
+	ErrTooManyExports    = errors.New("too many exports requested, try again later")
+	ErrExportNotReady    = errors.New("export is not ready")
+	ErrExportLinkExpired = errors.New("export link has expired")
+)
+
+// ExportSection produces one JSON file of a user's data export.
+type ExportSection func(userID int) (interface{}, error)
+
+type exportSection struct {
+	file    string
+	collect ExportSection
+}
+
+type dataExport struct {
+	models.DataExport
+	archive []byte
+}
+
+// ExportService builds ZIP archives of the data stored about a user, one
+// JSON file per section, in the background. Finished archives are kept in
+// memory and downloaded through signed links that expire with the archive.
+type ExportService struct {
+	apiURL     string
+	signingKey []byte
+	limiter    *utils.RateLimiter
+	sections   []exportSection
+	exports    []*dataExport
+	nextID     int
+	mutex      sync.Mutex
+	wg         sync.WaitGroup
+}
+
+// NewExportService creates an ExportService whose archives contain the user's
+// profile and tasks. Other services add their data with AddSection. Download
+// links point to apiURL and are signed with signingKey. Users can request
+// two exports at once and then one every hour.
+func NewExportService(users *UserService, tasks *TaskService, apiURL string, signingKey []byte) *ExportService {
+	s := &ExportService{
+		apiURL:     apiURL,
+		signingKey: signingKey,
+		limiter:    utils.NewRateLimiter(time.Hour, 2),
+		nextID:     1,
+	}
+	s.AddSection("profile.json", func(userID int) (interface{}, error) {
+		return users.GetUserByID(userID)
+	})
+	s.AddSection("tasks.json", func(userID int) (interface{}, error) {
+		return tasks.GetTasksForUser(userID), nil
+	})
+	return s
+}
+
+// AddSection adds a file to every export, holding what collect returns as JSON.
+func (s *ExportService) AddSection(file string, collect ExportSection) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sections = append(s.sections, exportSection{file: file, collect: collect})
+}
+
+// CheckRate is called before RequestExport. It returns ErrTooManyExports
+// and how long to wait when the user has requested too many exports lately.
+func (s *ExportService) CheckRate(userID int) (time.Duration, error) {
+	if ok, wait := s.limiter.Allow(strconv.Itoa(userID)); !ok {
+		return wait, ErrTooManyExports
+	}
+	return 0, nil
+}
+
+// RequestExport starts building an export for the user. Only one export per
+// user can be in progress at a time, and only a few across users; the user's
+// oldest finished export is dropped when they have too many.
+func (s *ExportService) RequestExport(userID int) (*models.DataExport, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending, kept := 0, 0
+	for _, export := range s.exports {
+		if export.Status == models.ExportPending {
+			if export.UserID == userID {
+				return nil, ErrExportInProgress
+			}
+			pending++
+		}
+		if export.UserID == userID {
+			kept++
+		}
+	}
+	if pending >= maxPendingExports {
+		return nil, ErrTooManyExports
+	}
+	for i := 0; kept >= maxExportsPerUser && i < len(s.exports); {
+		if s.exports[i].UserID == userID {
+			s.exports = append(s.exports[:i], s.exports[i+1:]...)
+			kept--
+			continue
+		}
+		i++
+	}
+	export := &dataExport{DataExport: models.DataExport{
+		ID:        s.nextID,
+		UserID:    userID,
+		Status:    models.ExportPending,
+		CreatedAt: time.Now(),
+	}}
+	s.nextID++
+	s.exports = append(s.exports, export)
+	sections := append([]exportSection{}, s.sections...)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.build(export.ID, userID, sections)
+	}()
+	return s.viewLocked(export), nil
+}
+
+// GetExports returns the user's exports, newest first.
+func (s *ExportService) GetExports(userID int) []models.DataExport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	exports := []models.DataExport{}
+	for i := len(s.exports) - 1; i >= 0; i-- {
+		if s.exports[i].UserID == userID {
+			exports = append(exports, *s.viewLocked(s.exports[i]))
+		}
+	}
+	return exports
+}
+
+// GetExport returns one of the user's exports.
+func (s *ExportService) GetExport(userID, id int) (*models.DataExport, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, export := range s.exports {
+		if export.ID == id && export.UserID == userID {
+			return s.viewLocked(export), nil
+		}
+	}
+	return nil, ErrExportNotFound
+}
+
+// Download returns the archive a download link token points to, and its file name.
+func (s *ExportService) Download(token string) ([]byte, string, error) {
+	value, err := utils.VerifySignedValue(s.signingKey, exportPurpose, token)
+	if err != nil {
+		return nil, "", ErrExportNotFound
+	}
+	idValue, expiresValue, _ := strings.Cut(value, ".")
+	id, err := strconv.Atoi(idValue)
+	if err != nil {
+		return nil, "", ErrExportNotFound
+	}
+	expires, err := strconv.ParseInt(expiresValue, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, "", ErrExportLinkExpired
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, export := range s.exports {
+		if export.ID == id {
+			if export.Status != models.ExportReady {
+				return nil, "", ErrExportNotReady
+			}
+			return export.archive, fmt.Sprintf("export-%d-%s.zip", export.UserID, export.CreatedAt.Format("20060102")), nil
+		}
+	}
+	return nil, "", ErrExportLinkExpired
+}
+
+// DeleteExports removes all of a user's exports.
+func (s *ExportService) DeleteExports(userID int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	exports := s.exports[:0]
+	for _, export := range s.exports {
+		if export.UserID != userID {
+			exports = append(exports, export)
+		}
+	}
+	s.exports = exports
+}
+
+// PurgeExpired removes exports whose download links have expired.
+func (s *ExportService) PurgeExpired(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	exports := s.exports[:0]
+	for _, export := range s.exports {
+		if export.ExpiresAt == nil || now.Before(*export.ExpiresAt) {
+			exports = append(exports, export)
+		}
+	}
+	s.exports = exports
+}
+
+// Wait blocks until the exports being built are done.
+func (s *ExportService) Wait() {
+	s.wg.Wait()
+}
+
+func (s *ExportService) build(id, userID int, sections []exportSection) {
+	archive, err := buildArchive(userID, sections)
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, export := range s.exports {
+		if export.ID != id {
+			continue
+		}
+		export.CompletedAt = &now
+		if err != nil {
+			logger.Error("could not export data", "user_id", userID, "error", err)
+			export.Status = models.ExportFailed
+			export.Error = "could not build the export"
+			return
+		}
+		expiresAt := now.Add(exportTTL)
+		export.Status = models.ExportReady
+		export.ExpiresAt = &expiresAt
+		export.archive = archive
+	}
+}
+
+func buildArchive(userID int, sections []exportSection) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, section := range sections {
+		data, err := section.collect(userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", section.file, err)
+		}
+		file, err := archive.Create(section.file)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", section.file, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// viewLocked returns the export as shown to its user, with a download link once ready.
+func (s *ExportService) viewLocked(export *dataExport) *models.DataExport {
+	view := export.DataExport
+	if view.Status == models.ExportReady {
+		value := fmt.Sprintf("%d.%d", view.ID, view.ExpiresAt.Unix())
+		token := utils.SignValue(s.signingKey, exportPurpose, value)
+		view.DownloadURL = s.apiURL + "/api/exports/download?token=" + url.QueryEscape(token)
+	}
+	return &view
+}
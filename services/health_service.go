@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"task-manager/models"
+	"time"
+)
+
+// healthCheckTimeout bounds each readiness check, so that a hanging
+// dependency fails its check instead of the probe.
+const healthCheckTimeout = 2 * time.Second
+
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// HealthService runs the readiness checks registered by the parts of the
+// server that can keep it from serving requests.
+type HealthService struct {
+	mutex  sync.Mutex
+	checks []healthCheck
+}
+
+func NewHealthService() *HealthService {
+	return &HealthService{}
+}
+
+// AddCheck registers a readiness check. The check fails when it returns an
+// error or does not return within healthCheckTimeout.
+func (s *HealthService) AddCheck(name string, check func(ctx context.Context) error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.checks = append(s.checks, healthCheck{name: name, check: check})
+}
+
+// Check runs all checks concurrently and reports each result in the order
+// the checks were added.
+func (s *HealthService) Check(ctx context.Context) models.HealthReport {
+	s.mutex.Lock()
+	checks := append([]healthCheck(nil), s.checks...)
+	s.mutex.Unlock()
+
+	report := models.HealthReport{Status: models.HealthOK, Checks: make([]models.HealthCheckResult, len(checks)), CheckedAt: time.Now()}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+			report.Checks[i] = runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != models.HealthOK {
+			report.Status = models.HealthFailing
+		}
+	}
+	return report
+}
+
+func runCheck(ctx context.Context, c healthCheck) models.HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.check(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := models.HealthCheckResult{Name: c.name, Status: models.HealthOK, Duration: time.Since(start).Round(time.Microsecond).String()}
+	if err != nil {
+		result.Status = models.HealthFailing
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,5 @@
+package services
+
+import "task-manager/logging"
+
+var logger = logging.For("services")
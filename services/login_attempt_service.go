@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"task-manager/models"
+	"task-manager/utils"
+	"time"
+)
+
+const (
+	// lockoutThreshold is how many consecutive failed logins lock an account.
+	lockoutThreshold = 5
+	// lockoutDuration is how long the first lockout lasts. It doubles with
+	// every further failure, up to maxLockoutDuration.
+	lockoutDuration    = time.Minute
+	maxLockoutDuration = time.Hour
+	// maxLoginAttempts is how many login attempts are kept per user.
+	maxLoginAttempts = 50
+)
+
+// ErrAccountLocked is returned when an account cannot be logged into for now,
+// because of failed attempts or because too many attempts were made.
+var ErrAccountLocked = errors.New("too many login attempts, try again later")
+
+// LoginOutcome is the result of a password login.
+type LoginOutcome string
+
+const (
+	LoginSucceeded LoginOutcome = "succeeded"
+	LoginFailed    LoginOutcome = "failed"
+	// LoginRefused is a right password for an account that cannot log in,
+	// such as a disabled one. It does not count toward the lockout.
+	LoginRefused LoginOutcome = "refused"
+)
+
+// lockout tracks the consecutive failed logins to an account.
+type lockout struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginAttemptService protects accounts against password guessing and keeps
+// the history of logins each user can review. Accounts are keyed by email
+// address, whether or not they exist, so that lockouts do not reveal which
+// addresses are registered.
+type LoginAttemptService struct {
+	limiter  *utils.RateLimiter
+	lockouts map[string]*lockout
+	attempts map[int][]models.LoginAttempt // newest last
+	hooks    []func(outcome LoginOutcome)
+	mutex    sync.Mutex
+}
+
+// NewLoginAttemptService creates a LoginAttemptService that allows bursts of
+// 10 login attempts per account and then one every 30 seconds, on top of the
+// lockout after consecutive failures.
+func NewLoginAttemptService() *LoginAttemptService {
+	return &LoginAttemptService{
+		limiter:  utils.NewRateLimiter(30*time.Second, 10),
+		lockouts: map[string]*lockout{},
+		attempts: map[int][]models.LoginAttempt{},
+	}
+}
+
+// Check is called before checking a password. It returns ErrAccountLocked
+// and how long to wait when the account cannot be logged into for now.
+func (s *LoginAttemptService) Check(email string) (time.Duration, error) {
+	key := normalizeEmail(email)
+	if ok, wait := s.limiter.Allow(key); !ok {
+		return wait, ErrAccountLocked
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if l, ok := s.lockouts[key]; ok {
+		if wait := time.Until(l.lockedUntil); wait > 0 {
+			return wait, ErrAccountLocked
+		}
+	}
+	return 0, nil
+}
+
+// OnRecord registers a function to call with the outcome of every password
+// check. It is called with the service locked, so it must not call back.
+func (s *LoginAttemptService) OnRecord(fn func(outcome LoginOutcome)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.hooks = append(s.hooks, fn)
+}
+
+// Record records the outcome of a password check. user is nil for unknown
+// email addresses. Failures lock the account once they reach the threshold,
+// for longer with every further failure; a success resets the count.
+func (s *LoginAttemptService) Record(email string, user *models.User, ip, userAgent string, outcome LoginOutcome) {
+	key := normalizeEmail(email)
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, hook := range s.hooks {
+		hook(outcome)
+	}
+	switch outcome {
+	case LoginSucceeded:
+		delete(s.lockouts, key)
+	case LoginFailed:
+		l, ok := s.lockouts[key]
+		if !ok {
+			l = &lockout{}
+			s.lockouts[key] = l
+		}
+		l.failures++
+		l.lastFailure = now
+		if l.failures >= lockoutThreshold {
+			l.lockedUntil = now.Add(lockoutFor(l.failures))
+			attrs := []interface{}{"failures", l.failures, "locked_for", lockoutFor(l.failures).String(), "ip", ip}
+			if user != nil {
+				attrs = append(attrs, "locked_user_id", user.ID)
+			}
+			logger.Warn("account locked after failed logins", attrs...)
+		}
+	}
+
+	if user != nil {
+		attempts := append(s.attempts[user.ID], models.LoginAttempt{
+			UserID:    user.ID,
+			IP:        ip,
+			UserAgent: userAgent,
+			Success:   outcome == LoginSucceeded,
+			CreatedAt: now,
+		})
+		if len(attempts) > maxLoginAttempts {
+			attempts = attempts[len(attempts)-maxLoginAttempts:]
+		}
+		s.attempts[user.ID] = attempts
+	}
+}
+
+// GetAttempts returns the user's recent login attempts, newest first.
+func (s *LoginAttemptService) GetAttempts(userID int) []models.LoginAttempt {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored := s.attempts[userID]
+	attempts := make([]models.LoginAttempt, len(stored))
+	for i, attempt := range stored {
+		attempts[len(stored)-1-i] = attempt
+	}
+	return attempts
+}
+
+// PurgeExpired forgets the failures of accounts without a failed login for
+// maxLockoutDuration, by which time any lockout has ended.
+func (s *LoginAttemptService) PurgeExpired(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, l := range s.lockouts {
+		if now.Sub(l.lastFailure) > maxLockoutDuration {
+			delete(s.lockouts, key)
+		}
+	}
+}
+
+// lockoutFor returns how long an account is locked after the given number of
+// consecutive failures.
+func lockoutFor(failures int) time.Duration {
+	duration := lockoutDuration
+	for i := lockoutThreshold; i < failures && duration < maxLockoutDuration; i++ {
+		duration *= 2
+	}
+	if duration > maxLockoutDuration {
+		duration = maxLockoutDuration
+	}
+	return duration
+}
+
+// HandleUserDeleted forgets a deleted user's login history. Lockouts are
+// kept, since they are keyed by address rather than by user.
+// It is meant to be registered with UserService.OnDelete.
+func (s *LoginAttemptService) HandleUserDeleted(userID, _ int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.attempts, userID)
+}
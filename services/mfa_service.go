@@ -0,0 +1,315 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"task-manager/models"
+	"task-manager/utils"
+	"time"
+)
+
+const (
+	// totpIssuer is shown in authenticator apps next to the account.
+	totpIssuer = "Task Manager"
+	// mfaChallengeTTL is how long a user has to enter their code after entering their password.
+	mfaChallengeTTL = 5 * time.Minute
+	// maxMFAAttempts is how many wrong codes a challenge accepts before it is discarded.
+	maxMFAAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrInvalidMFACode      = errors.New("invalid two-factor code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired two-factor challenge")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrMFANotStarted       = errors.New("start enrollment first")
+	ErrMFARequiredByAdmin  = errors.New("two-factor authentication is required by the administrator")
+)
+
+// mfaState is a user's two-factor configuration.
+type mfaState struct {
+	secret        string   // set once enrollment is confirmed
+	pendingSecret string   // set while enrolling
+	recoveryCodes []string // hashes of unused recovery codes
+	lastStep      uint64   // time step of the last accepted code, to prevent replays
+}
+
+// mfaChallenge is a login waiting for its second factor.
+type mfaChallenge struct {
+	userID    int
+	enroll    bool // the user has to enroll before logging in
+	expiresAt time.Time
+	attempts  int
+}
+
+// MFAEnrollment is returned when starting enrollment: the secret to add to
+// an authenticator app, also as an otpauth:// URI for QR codes.
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// MFAService manages TOTP two-factor authentication and the login challenges
+// between the password check and the code check.
+type MFAService struct {
+	users      *UserService
+	states     map[int]*mfaState
+	challenges map[string]*mfaChallenge // by token hash
+	required   bool
+	mutex      sync.Mutex
+}
+
+func NewMFAService(users *UserService) *MFAService {
+	return &MFAService{
+		users:      users,
+		states:     map[int]*mfaState{},
+		challenges: map[string]*mfaChallenge{},
+	}
+}
+
+// Enabled reports whether the user has confirmed two-factor enrollment.
+func (s *MFAService) Enabled(userID int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state, ok := s.states[userID]
+	return ok && state.secret != ""
+}
+
+// Required reports whether every user has to use two-factor authentication.
+func (s *MFAService) Required() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.required
+}
+
+// SetRequired makes two-factor authentication mandatory for all users, or optional.
+// Users without it are asked to enroll at their next login.
+func (s *MFAService) SetRequired(required bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.required = required
+}
+
+// StartEnrollment generates a new secret for the user. Enrollment is completed
+// by ConfirmEnrollment with a code from the authenticator app.
+func (s *MFAService) StartEnrollment(userID int) (*MFAEnrollment, error) {
+	user, err := s.users.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state := s.stateLocked(userID)
+	if state.secret != "" {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	state.pendingSecret = secret
+	return &MFAEnrollment{Secret: secret, URI: utils.TOTPURI(totpIssuer, user.Email, secret)}, nil
+}
+
+// ConfirmEnrollment enables two-factor authentication once the user proves
+// their app generates valid codes. It returns the recovery codes, which are
+// shown only once.
+func (s *MFAService) ConfirmEnrollment(userID int, code string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := s.stateLocked(userID)
+	if state.secret != "" {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if state.pendingSecret == "" {
+		return nil, ErrMFANotStarted
+	}
+	step, ok := utils.VerifyTOTP(state.pendingSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	state.secret, state.pendingSecret, state.lastStep = state.pendingSecret, "", step
+	return s.newRecoveryCodesLocked(state)
+}
+
+// Disable turns off two-factor authentication after checking a current code.
+func (s *MFAService) Disable(userID int, code string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.required {
+		return ErrMFARequiredByAdmin
+	}
+	state := s.stateLocked(userID)
+	if state.secret == "" {
+		return ErrMFANotEnabled
+	}
+	if !s.verifyLocked(state, code) {
+		return ErrInvalidMFACode
+	}
+	delete(s.states, userID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a current code.
+func (s *MFAService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := s.stateLocked(userID)
+	if state.secret == "" {
+		return nil, ErrMFANotEnabled
+	}
+	if !s.verifyLocked(state, code) {
+		return nil, ErrInvalidMFACode
+	}
+	return s.newRecoveryCodesLocked(state)
+}
+
+// NewChallenge is called after a successful password check. It returns a
+// short-lived token to exchange, together with a code, for the real tokens.
+// enroll is true when the user must first enroll because 2FA is required.
+func (s *MFAService) NewChallenge(userID int) (token string, enroll bool, err error) {
+	token, err = utils.RandomToken(32)
+	if err != nil {
+		return "", false, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	for hash, challenge := range s.challenges {
+		if now.After(challenge.expiresAt) {
+			delete(s.challenges, hash)
+		}
+	}
+	state, ok := s.states[userID]
+	enroll = !ok || state.secret == ""
+	s.challenges[utils.HashToken(token)] = &mfaChallenge{userID: userID, enroll: enroll, expiresAt: now.Add(mfaChallengeTTL)}
+	return token, enroll, nil
+}
+
+// StartChallengeEnrollment starts enrollment for a user who has to enroll to log in.
+func (s *MFAService) StartChallengeEnrollment(token string) (*MFAEnrollment, error) {
+	s.mutex.Lock()
+	challenge, ok := s.challenges[utils.HashToken(token)]
+	valid := ok && challenge.enroll && time.Now().Before(challenge.expiresAt)
+	s.mutex.Unlock()
+	if !valid {
+		return nil, ErrInvalidMFAChallenge
+	}
+	return s.StartEnrollment(challenge.userID)
+}
+
+// CompleteChallenge checks the code for a challenge and returns the user to
+// log in. The code is a TOTP code or, for enrolled users, a recovery code.
+// For challenges that required enrollment, the code confirms the enrollment
+// and the new recovery codes are returned.
+func (s *MFAService) CompleteChallenge(token, code string) (*models.User, []string, error) {
+	hash := utils.HashToken(token)
+
+	s.mutex.Lock()
+	challenge, ok := s.challenges[hash]
+	if !ok || time.Now().After(challenge.expiresAt) {
+		delete(s.challenges, hash)
+		s.mutex.Unlock()
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+	challenge.attempts++
+	if challenge.attempts > maxMFAAttempts {
+		delete(s.challenges, hash)
+		s.mutex.Unlock()
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+	userID, enroll := challenge.userID, challenge.enroll
+	s.mutex.Unlock()
+
+	var recoveryCodes []string
+	if enroll {
+		codes, err := s.ConfirmEnrollment(userID, code)
+		if err != nil {
+			return nil, nil, err
+		}
+		recoveryCodes = codes
+	} else {
+		s.mutex.Lock()
+		state := s.stateLocked(userID)
+		valid := state.secret != "" && (s.verifyLocked(state, code) || s.useRecoveryCodeLocked(state, code))
+		s.mutex.Unlock()
+		if !valid {
+			return nil, nil, ErrInvalidMFACode
+		}
+	}
+
+	s.mutex.Lock()
+	delete(s.challenges, hash)
+	s.mutex.Unlock()
+	user, err := s.users.GetUserByID(userID)
+	return user, recoveryCodes, err
+}
+
+func (s *MFAService) stateLocked(userID int) *mfaState {
+	state, ok := s.states[userID]
+	if !ok {
+		state = &mfaState{}
+		s.states[userID] = state
+	}
+	return state
+}
+
+func (s *MFAService) verifyLocked(state *mfaState, code string) bool {
+	step, ok := utils.VerifyTOTP(state.secret, code, time.Now())
+	if !ok || step <= state.lastStep {
+		return false
+	}
+	state.lastStep = step
+	return true
+}
+
+func (s *MFAService) useRecoveryCodeLocked(state *mfaState, code string) bool {
+	hash := utils.HashToken(normalizeRecoveryCode(code))
+	for i, stored := range state.recoveryCodes {
+		if stored == hash {
+			state.recoveryCodes = append(state.recoveryCodes[:i], state.recoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MFAService) newRecoveryCodesLocked(state *mfaState) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		random, err := utils.RandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = random[:5] + "-" + random[5:]
+		hashes[i] = utils.HashToken(normalizeRecoveryCode(codes[i]))
+	}
+	state.recoveryCodes = hashes
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// HandleUserDeleted forgets a deleted user's secret, recovery codes and
+// pending login challenges.
+// It is meant to be registered with UserService.OnDelete.
+func (s *MFAService) HandleUserDeleted(userID, _ int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.states, userID)
+	for hash, challenge := range s.challenges {
+		if challenge.userID == userID {
+			delete(s.challenges, hash)
+		}
+	}
+}
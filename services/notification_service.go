@@ -0,0 +1,214 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"task-manager/models"
+	"time"
+)
+
+// mentionPattern matches "@" followed by a user's email address, e.g. "@ada@example.com".
+var mentionPattern = regexp.MustCompile(`@([A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+
+// NotificationService stores per-user notifications generated from task events.
+type NotificationService struct {
+	notifications []models.Notification
+	preferences   map[int]models.NotificationPreferences
+	mutex         sync.Mutex
+	nextID        int
+	users         *UserService
+}
+
+func NewNotificationService(users *UserService) *NotificationService {
+	return &NotificationService{
+		notifications: []models.Notification{},
+		preferences:   map[int]models.NotificationPreferences{},
+		nextID:        1,
+		users:         users,
+	}
+}
+
+// HandleTaskEvent turns a task event into notifications for the affected users.
+// It is meant to be registered with TaskService.Subscribe.
+func (s *NotificationService) HandleTaskEvent(event models.TaskEvent) {
+	task := event.Task
+	switch event.Type {
+	case models.TaskCreated:
+		s.notifyMentions(event, mentions(task.Title+" "+task.Description))
+	case models.TaskUpdated:
+		newMentions := mentions(task.Title + " " + task.Description)
+		if event.Previous != nil {
+			for email := range mentions(event.Previous.Title + " " + event.Previous.Description) {
+				delete(newMentions, email)
+			}
+		}
+		s.notifyMentions(event, newMentions)
+	case models.TaskAssigned:
+		s.notify(event, task.AssigneeID, models.NotificationAssigned,
+			fmt.Sprintf("You were assigned to task %q", task.Title))
+	case models.TaskStatusChanged, models.TaskCompleted:
+		message := fmt.Sprintf("Task %q moved to %s", task.Title, task.Status)
+		s.notify(event, task.CreatorID, models.NotificationStatusChanged, message)
+		if task.AssigneeID != task.CreatorID {
+			s.notify(event, task.AssigneeID, models.NotificationStatusChanged, message)
+		}
+	case models.TaskDueSoon:
+		recipient := task.AssigneeID
+		if recipient == 0 {
+			recipient = task.CreatorID
+		}
+		s.notify(event, recipient, models.NotificationDueSoon,
+			fmt.Sprintf("Task %q is due %s", task.Title, task.DueDate.Format(time.RFC1123)))
+	}
+}
+
+func (s *NotificationService) notifyMentions(event models.TaskEvent, emails map[string]bool) {
+	if s.users == nil {
+		return
+	}
+	for email := range emails {
+		user, err := s.users.GetUserByEmail(email)
+		if err != nil {
+			continue
+		}
+		s.notify(event, user.ID, models.NotificationMentioned,
+			fmt.Sprintf("You were mentioned in task %q", event.Task.Title))
+	}
+}
+
+// notify stores a notification unless the recipient caused the event or opted out of its type.
+func (s *NotificationService) notify(event models.TaskEvent, userID int, notificationType models.NotificationType, message string) {
+	if userID == 0 || userID == event.ActorID {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if enabled, ok := s.preferences[userID][notificationType]; ok && !enabled {
+		return
+	}
+	s.notifications = append(s.notifications, models.Notification{
+		ID:        s.nextID,
+		UserID:    userID,
+		Type:      notificationType,
+		TaskID:    event.Task.ID,
+		Message:   message,
+		CreatedAt: event.Time,
+	})
+	s.nextID++
+}
+
+// mentions returns the lower-cased email addresses mentioned in text.
+func mentions(text string) map[string]bool {
+	found := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		found[strings.ToLower(strings.TrimRight(match[1], "."))] = true
+	}
+	return found
+}
+
+// GetNotifications returns a user's notifications, newest first.
+func (s *NotificationService) GetNotifications(userID int, unreadOnly bool) []models.Notification {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := []models.Notification{}
+	for _, notification := range s.notifications {
+		if notification.UserID == userID && (!unreadOnly || !notification.Read) {
+			result = append(result, notification)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	return result
+}
+
+// MarkAsRead marks one of the user's notifications as read.
+func (s *NotificationService) MarkAsRead(userID, id int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, notification := range s.notifications {
+		if notification.ID == id && notification.UserID == userID {
+			s.notifications[i].Read = true
+			return nil
+		}
+	}
+	return errors.New("notification not found")
+}
+
+// MarkAllAsRead marks all of the user's notifications as read and returns how many changed.
+func (s *NotificationService) MarkAllAsRead(userID int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for i, notification := range s.notifications {
+		if notification.UserID == userID && !notification.Read {
+			s.notifications[i].Read = true
+			count++
+		}
+	}
+	return count
+}
+
+// GetPreferences returns the user's preference for every notification type.
+func (s *NotificationService) GetPreferences(userID int) models.NotificationPreferences {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	prefs := models.NotificationPreferences{}
+	for _, notificationType := range models.NotificationTypes {
+		enabled, ok := s.preferences[userID][notificationType]
+		prefs[notificationType] = !ok || enabled
+	}
+	return prefs
+}
+
+// UpdatePreferences changes the user's preferences for the given types.
+func (s *NotificationService) UpdatePreferences(userID int, prefs models.NotificationPreferences) error {
+	for notificationType := range prefs {
+		if !isNotificationType(notificationType) {
+			return fmt.Errorf("unknown notification type %q", notificationType)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.preferences[userID] == nil {
+		s.preferences[userID] = models.NotificationPreferences{}
+	}
+	for notificationType, enabled := range prefs {
+		s.preferences[userID][notificationType] = enabled
+	}
+	return nil
+}
+
+func isNotificationType(notificationType models.NotificationType) bool {
+	for _, t := range models.NotificationTypes {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleUserDeleted deletes a deleted user's notifications and preferences.
+// It is meant to be registered with UserService.OnDelete.
+func (s *NotificationService) HandleUserDeleted(userID, _ int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	notifications := s.notifications[:0]
+	for _, notification := range s.notifications {
+		if notification.UserID != userID {
+			notifications = append(notifications, notification)
+		}
+	}
+	s.notifications = notifications
+	delete(s.preferences, userID)
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrWeakPassword is matched by the errors returned for passwords that do not
+// meet the password policy.
+var ErrWeakPassword = errors.New("password does not meet the password policy")
+
+// PasswordPolicyError lists every way a password falls short of the policy.
+type PasswordPolicyError struct {
+	Problems []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+// PasswordPolicy is what new passwords must satisfy, and how they are hashed.
+type PasswordPolicy struct {
+	MinLength int
+	// MinEntropyBits is the minimum estimated strength; see EstimateEntropy.
+	MinEntropyBits float64
+	// BcryptCost is the cost new hashes are created with. Hashes with a lower
+	// cost are upgraded when their user logs in.
+	BcryptCost int
+	// Breached, if set, rejects passwords known from data breaches.
+	Breached *BreachedPasswords
+}
+
+// DefaultPasswordPolicy requires 8 characters and 35 bits of estimated entropy.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 8, MinEntropyBits: 35, BcryptCost: bcrypt.DefaultCost}
+}
+
+// Validate checks a password for the account with the given email address.
+// It returns a *PasswordPolicyError listing the problems found.
+func (p PasswordPolicy) Validate(password, email string) error {
+	var problems []string
+	if password == "" {
+		return &PasswordPolicyError{Problems: []string{"password is required"}}
+	}
+	if utf8.RuneCountInString(password) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("password must be at least %d characters long", p.MinLength))
+	}
+	if EstimateEntropy(password) < p.MinEntropyBits {
+		problems = append(problems, "password is too easy to guess; use a longer password or mix letters, digits and symbols")
+	}
+	if containsEmail(password, email) {
+		problems = append(problems, "password must not contain your email address")
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			problems = append(problems, "password has appeared in a data breach; choose a different one")
+		}
+	}
+	if len(problems) > 0 {
+		return &PasswordPolicyError{Problems: problems}
+	}
+	return nil
+}
+
+// EstimateEntropy estimates the strength of a password in bits, the way a
+// guessing attack would: common passwords and words ("password", "dragon",
+// also as "p@ssw0rd") count as one guess among the words tried first,
+// characters that repeat or continue a sequence of the previous one ("aaa",
+// "123", "cba") or run along a keyboard row ("qwerty", "asdf") count for
+// nothing, and digits and symbols appended at the end ("2024!") count as
+// digits or symbols only. Every other character counts for the bits per
+// character of the character classes used.
+func EstimateEntropy(password string) float64 {
+	runes := []rune(password)
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLower(r):
+			lower = true
+		case r < utf8.RuneSelf && unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case isSymbol(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	charBits := math.Log2(float64(pool))
+
+	// Digits and symbols at the end, after something else, are what people
+	// append to meet a policy.
+	suffix := len(runes)
+	for suffix > 0 && (unicode.IsDigit(runes[suffix-1]) || isSymbol(runes[suffix-1])) {
+		suffix--
+	}
+	if suffix == 0 {
+		suffix = len(runes)
+	}
+
+	unleeted := make([]rune, len(runes))
+	for i, r := range runes {
+		unleeted[i] = unleet(unicode.ToLower(r))
+	}
+	bits := 0.0
+	previous := rune(-10)
+	for i := 0; i < len(runes); {
+		if n := commonWordAt(unleeted[i:]); n > 0 {
+			bits += math.Log2(float64(len(commonPasswordWords)))
+			previous = runes[i+n-1]
+			i += n
+			continue
+		}
+		r := runes[i]
+		switch {
+		case continues(previous, r):
+		case i >= suffix && unicode.IsDigit(r):
+			bits += math.Log2(10)
+		case i >= suffix:
+			bits += math.Log2(33)
+		default:
+			bits += charBits
+		}
+		previous = r
+		i++
+	}
+	return bits
+}
+
+// isSymbol reports whether r is an ASCII character other than a letter or digit.
+func isSymbol(r rune) bool {
+	return r < utf8.RuneSelf && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// commonPasswordWords are among the first guesses of password cracking tools.
+var commonPasswordWords = []string{
+	"password", "passwd", "qwerty", "letmein", "welcome", "admin", "login",
+	"dragon", "monkey", "iloveyou", "sunshine", "princess", "football",
+	"baseball", "soccer", "hockey", "master", "shadow", "secret", "superman",
+	"batman", "trustno", "hello", "freedom", "whatever", "starwars",
+	"computer", "internet", "michael", "jessica", "charlie", "summer",
+	"winter", "spring", "autumn", "love", "flower", "cookie", "pokemon",
+	"ninja", "mustang", "access", "changeme", "default", "user", "test",
+}
+
+// commonWordAt returns the length of the longest common word at the start of
+// s, or 0 if there is none.
+func commonWordAt(s []rune) int {
+	longest := 0
+	for _, word := range commonPasswordWords {
+		if n := len(word); n > longest && n <= len(s) && string(s[:n]) == word {
+			longest = n
+		}
+	}
+	return longest
+}
+
+// unleet undoes the usual substitutions of digits and symbols for letters.
+func unleet(r rune) rune {
+	switch r {
+	case '0':
+		return 'o'
+	case '1', '!':
+		return 'i'
+	case '3':
+		return 'e'
+	case '4', '@':
+		return 'a'
+	case '5', '$':
+		return 's'
+	case '7':
+		return 't'
+	}
+	return r
+}
+
+// keyboardRows are the rows of a US keyboard, unshifted and shifted.
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+	"~!@#$%^&*()_+", "QWERTYUIOP{}|", "ASDFGHJKL:\"", "ZXCVBNM<>?",
+}
+
+// continues reports whether r repeats or follows previous in a sequence
+// or along a keyboard row, in either direction.
+func continues(previous, r rune) bool {
+	if d := r - previous; d >= -1 && d <= 1 {
+		return true
+	}
+	for _, row := range keyboardRows {
+		if i := strings.IndexRune(row, previous); i >= 0 {
+			if j := strings.IndexRune(row, r); j >= 0 && (j == i-1 || j == i+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsEmail reports whether the password contains the email address or,
+// for local parts of at least 3 characters, the part before the "@".
+func containsEmail(password, email string) bool {
+	password, email = strings.ToLower(password), strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return strings.Contains(password, email) || (len(local) >= 3 && strings.Contains(password, local))
+}
+
+// BreachedPasswords is an offline list of passwords known from data breaches,
+// as SHA-1 hashes. It is read either from a single file of hashes, one
+// "HASH" or "HASH:COUNT" per line, or from a directory of range files in the
+// k-anonymity layout of Have I Been Pwned: the file "<PREFIX>.txt" holds the
+// "SUFFIX:COUNT" lines of all hashes starting with the 5-character PREFIX.
+// Range files are read on demand, so large corpora need not fit in memory.
+type BreachedPasswords struct {
+	dir    string              // directory of range files
+	hashes map[string]struct{} // hashes of a single-file list
+}
+
+// LoadBreachedPasswords opens the breached password list at path, a file or
+// a directory of range files.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &BreachedPasswords{dir: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if len(hash) == sha1.Size*2 {
+			hashes[strings.ToUpper(hash)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &BreachedPasswords{hashes: hashes}, nil
+}
+
+// Contains reports whether the password is on the list.
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if b.hashes != nil {
+		_, ok := b.hashes[hash]
+		return ok, nil
+	}
+
+	file, err := os.Open(filepath.Join(b.dir, hash[:5]+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		suffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(suffix, hash[5:]) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
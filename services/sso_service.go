@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"task-manager/models"
+	"task-manager/oidc"
+	"task-manager/utils"
+	"time"
+)
+
+// ssoLoginTTL is how long a user has to complete a login at the provider.
+const ssoLoginTTL = 10 * time.Minute
+
+var (
+	// ErrUnknownProvider is returned for providers that are not configured.
+	ErrUnknownProvider = errors.New("unknown SSO provider")
+	// ErrInvalidSSOState is returned for callbacks that do not belong to a login we started.
+	ErrInvalidSSOState = errors.New("invalid or expired login state")
+	// ErrEmailNotVerified is returned when the provider does not vouch for the user's email.
+	ErrEmailNotVerified = errors.New("email address not verified by the provider")
+)
+
+// ssoLogin is a login started with a provider and not yet completed.
+type ssoLogin struct {
+	provider     string
+	nonce        string
+	codeVerifier string
+	expiresAt    time.Time
+}
+
+// SSOService logs users in through OpenID Connect providers. Users are matched
+// by the provider's subject once linked, and otherwise by verified email:
+// an existing user who has verified that email is linked, or a new user is
+// created. Users who have not verified it are refused rather than linked.
+type SSOService struct {
+	users      *UserService
+	providers  map[string]*oidc.Provider
+	logins     map[string]ssoLogin // by state
+	identities map[string]int      // provider and subject -> user ID
+	mutex      sync.Mutex
+}
+
+func NewSSOService(users *UserService, providers ...*oidc.Provider) *SSOService {
+	s := &SSOService{
+		users:      users,
+		providers:  map[string]*oidc.Provider{},
+		logins:     map[string]ssoLogin{},
+		identities: map[string]int{},
+	}
+	for _, provider := range providers {
+		s.providers[provider.Name()] = provider
+	}
+	return s
+}
+
+// Providers returns the names of the configured providers.
+func (s *SSOService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartLogin begins a login with the provider. It returns the URL to send the
+// user to and the state, which the callback must present.
+func (s *SSOService) StartLogin(ctx context.Context, providerName string) (authURL, state string, err error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+	state, err = utils.RandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.RandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oidc.NewPKCEVerifier()
+	if err != nil {
+		return "", "", err
+	}
+	authURL, err = provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	for key, login := range s.logins {
+		if now.After(login.expiresAt) {
+			delete(s.logins, key)
+		}
+	}
+	s.logins[state] = ssoLogin{provider: providerName, nonce: nonce, codeVerifier: verifier, expiresAt: now.Add(ssoLoginTTL)}
+	return authURL, state, nil
+}
+
+// FinishLogin completes a login with the authorization code the provider
+// redirected back with and returns the logged-in user.
+func (s *SSOService) FinishLogin(ctx context.Context, providerName, state, code string) (*models.User, error) {
+	s.mutex.Lock()
+	login, ok := s.logins[state]
+	delete(s.logins, state) // a state can only be used once
+	s.mutex.Unlock()
+	if !ok || login.provider != providerName || time.Now().After(login.expiresAt) {
+		return nil, ErrInvalidSSOState
+	}
+
+	idToken, err := s.providers[providerName].Exchange(ctx, code, login.codeVerifier, login.nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := providerName + "|" + idToken.Subject
+	s.mutex.Lock()
+	userID, linked := s.identities[identity]
+	s.mutex.Unlock()
+	if linked {
+		s.users.MarkSSOLogin(userID, time.Now())
+		return s.users.GetUserByID(userID)
+	}
+
+	if idToken.Email == "" || !idToken.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	user, err := s.users.FindOrCreateUser(idToken.Email)
+	if err != nil {
+		return nil, err
+	}
+	// The provider vouches for the address, which may make the user an administrator.
+	if err := s.users.MarkEmailVerified(user.ID); err != nil {
+		return nil, err
+	}
+	if user, err = s.users.GetUserByID(user.ID); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	s.identities[identity] = user.ID
+	s.mutex.Unlock()
+	s.users.MarkSSOLogin(user.ID, time.Now())
+	return user, nil
+}
+
+// HandleUserDeleted unlinks a deleted user's identities, so that logging in
+// with them again creates a new user.
+// It is meant to be registered with UserService.OnDelete.
+func (s *SSOService) HandleUserDeleted(userID, _ int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for identity, id := range s.identities {
+		if id == userID {
+			delete(s.identities, identity)
+		}
+	}
+}
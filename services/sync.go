@@ -0,0 +1,354 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"task-manager/models"
+	"time"
+)
+
+const syncTokenPrefix = "v1."
+
+var (
+	// ErrInvalidSyncToken is returned for a sync token that was not issued by this server.
+	ErrInvalidSyncToken = errors.New("invalid sync token")
+	// ErrSyncTokenExpired is returned for a sync token from before a restart
+	// or older than a purged deletion; the client has to sync from scratch.
+	ErrSyncTokenExpired = errors.New("sync token expired")
+)
+
+// SyncChanges is everything that changed after a sync token.
+type SyncChanges struct {
+	Tasks   []models.Task      `json:"tasks"`
+	Deleted []models.Tombstone `json:"deleted"`
+	Token   string             `json:"token"`
+}
+
+// EncodeSyncToken returns the opaque token clients pass back to receive changes after version.
+func EncodeSyncToken(version int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(syncTokenPrefix + strconv.FormatInt(version, 10)))
+}
+
+// DecodeSyncToken returns the version encoded in a sync token. An empty token is version 0.
+func DecodeSyncToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || !strings.HasPrefix(string(raw), syncTokenPrefix) {
+		return 0, ErrInvalidSyncToken
+	}
+	version, err := strconv.ParseInt(strings.TrimPrefix(string(raw), syncTokenPrefix), 10, 64)
+	if err != nil || version < 0 {
+		return 0, ErrInvalidSyncToken
+	}
+	return version, nil
+}
+
+// ChangesSince returns the tasks changed and deleted after the given sync token,
+// together with the token to pass next time. An empty token returns every task.
+func (s *TaskService) ChangesSince(token string) (SyncChanges, error) {
+	since, err := DecodeSyncToken(token)
+	if err != nil {
+		return SyncChanges{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if since > s.version || (since > 0 && since < s.purgedVersion) {
+		return SyncChanges{}, ErrSyncTokenExpired
+	}
+	changes := SyncChanges{Tasks: []models.Task{}, Deleted: []models.Tombstone{}, Token: EncodeSyncToken(s.version)}
+	for _, task := range s.tasks {
+		if task.Version > since {
+			changes.Tasks = append(changes.Tasks, task)
+		}
+	}
+	for _, tombstone := range s.tombstones {
+		// Clients that never saw the task do not need to hear about its deletion.
+		if tombstone.Version > since && since > 0 {
+			changes.Deleted = append(changes.Deleted, tombstone)
+		}
+	}
+	return changes, nil
+}
+
+// ApplyChanges applies changes made by a client while offline, in order.
+// Every field is resolved on its own with last-writer-wins: a field is only
+// overwritten if the client changed it at or after the server's last change
+// to it. Fields the server changed later are reported as conflicts and keep
+// their server value. Deleting a task that was changed on the server after
+// the deletion is a conflict as well.
+func (s *TaskService) ApplyChanges(actorID int, changes []models.SyncChange) []models.SyncResult {
+	results := make([]models.SyncResult, 0, len(changes))
+	for _, change := range changes {
+		// Clocks of offline clients may run ahead; they cannot win against later changes.
+		if now := time.Now(); change.UpdatedAt.IsZero() || change.UpdatedAt.After(now) {
+			change.UpdatedAt = now
+		}
+
+		var result models.SyncResult
+		var events []models.TaskEvent
+		if err := s.checkSyncAssignee(change); err != nil {
+			results = append(results, rejected(change, err))
+			continue
+		}
+		switch change.Op {
+		case models.SyncCreate:
+			result, events = s.applyCreate(actorID, change)
+		case models.SyncUpdate:
+			result, events = s.applyUpdate(actorID, change)
+		case models.SyncDelete:
+			result, events = s.applyDelete(actorID, change)
+		default:
+			result = rejected(change, fmt.Errorf("unknown op %q", change.Op))
+		}
+		s.emit(events...)
+		results = append(results, result)
+	}
+	return results
+}
+
+// checkSyncAssignee checks the assignee set by a change, if any, before the
+// task mutex is taken.
+func (s *TaskService) checkSyncAssignee(change models.SyncChange) error {
+	value, ok := change.Fields["assignee_id"]
+	if !ok || change.Op == models.SyncDelete {
+		return nil
+	}
+	var assigneeID int
+	if err := json.Unmarshal(value, &assigneeID); err != nil {
+		return errors.New("invalid value for assignee_id")
+	}
+	return s.CheckAssignee(assigneeID)
+}
+
+func rejected(change models.SyncChange, err error) models.SyncResult {
+	return models.SyncResult{ID: change.ID, ClientID: change.ClientID, Status: models.SyncRejected, Error: err.Error()}
+}
+
+func (s *TaskService) applyCreate(actorID int, change models.SyncChange) (models.SyncResult, []models.TaskEvent) {
+	task := models.Task{CreatorID: actorID}
+	for field, value := range change.Fields {
+		if err := setSyncField(&task, field, value); err != nil {
+			return rejected(change, err), nil
+		}
+	}
+	if task.Title == "" || task.Description == "" {
+		return rejected(change, errors.New("title and description are required")), nil
+	}
+
+	s.mutex.Lock()
+	task = s.insertTask(task, change.UpdatedAt)
+	s.mutex.Unlock()
+
+	return models.SyncResult{ID: task.ID, ClientID: change.ClientID, Status: models.SyncApplied, Task: &task}, createEvents(actorID, task)
+}
+
+func (s *TaskService) applyUpdate(actorID int, change models.SyncChange) (models.SyncResult, []models.TaskEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexLocked(change.ID)
+	if i < 0 {
+		if s.deletedLocked(change.ID) {
+			return models.SyncResult{ID: change.ID, ClientID: change.ClientID, Status: models.SyncConflicted, Error: "task was deleted"}, nil
+		}
+		return rejected(change, ErrTaskNotFound), nil
+	}
+
+	before := s.tasks[i]
+	updated := before
+	var conflicts []models.SyncConflict
+	for field, value := range change.Fields {
+		if serverTime := before.FieldUpdatedAt[field]; serverTime.After(change.UpdatedAt) {
+			conflicts = append(conflicts, models.SyncConflict{
+				ID:              before.ID,
+				Field:           field,
+				ClientValue:     value,
+				ServerValue:     syncFieldValue(before, field),
+				ServerUpdatedAt: serverTime,
+			})
+			continue
+		}
+		if err := setSyncField(&updated, field, value); err != nil {
+			return rejected(change, err), nil
+		}
+	}
+
+	result := models.SyncResult{ID: before.ID, ClientID: change.ClientID, Status: models.SyncApplied, Conflicts: conflicts}
+	switch {
+	case len(conflicts) == len(change.Fields) && len(conflicts) > 0:
+		result.Status = models.SyncConflicted
+	case len(conflicts) > 0:
+		result.Status = models.SyncPartial
+	}
+
+	// Completing a task offline completes it as MarkTaskAsComplete does.
+	completing := updated.Status == models.Completed && before.Status != models.Completed
+	var nextDue *time.Time
+	if completing {
+		var err error
+		if nextDue, err = nextDueDate(updated); err != nil {
+			return rejected(change, err), nil
+		}
+		updated.Overdue = false
+	}
+
+	var events []models.TaskEvent
+	if len(changedSyncFields(before, updated)) > 0 {
+		s.tasks[i] = updated
+		s.touchLocked(i, before, change.UpdatedAt)
+		events = updateEvents(actorID, before, s.tasks[i])
+	}
+	if completing {
+		_, completed := s.completedLocked(actorID, i, before, nextDue, change.UpdatedAt)
+		events = append(events, completed...)
+	}
+	task := s.tasks[i]
+	result.Task = &task
+	return result, events
+}
+
+func (s *TaskService) applyDelete(actorID int, change models.SyncChange) (models.SyncResult, []models.TaskEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexLocked(change.ID)
+	if i < 0 {
+		if s.deletedLocked(change.ID) {
+			return models.SyncResult{ID: change.ID, ClientID: change.ClientID, Status: models.SyncApplied}, nil
+		}
+		return rejected(change, ErrTaskNotFound), nil
+	}
+
+	task := s.tasks[i]
+	var conflicts []models.SyncConflict
+	for _, field := range models.SyncFields {
+		if serverTime := task.FieldUpdatedAt[field]; serverTime.After(change.UpdatedAt) {
+			conflicts = append(conflicts, models.SyncConflict{
+				ID:              task.ID,
+				Field:           field,
+				ServerValue:     syncFieldValue(task, field),
+				ServerUpdatedAt: serverTime,
+			})
+		}
+	}
+	if len(conflicts) > 0 {
+		return models.SyncResult{ID: task.ID, ClientID: change.ClientID, Status: models.SyncConflicted, Conflicts: conflicts, Task: &task}, nil
+	}
+
+	s.removeLocked(i, change.UpdatedAt)
+	return models.SyncResult{ID: task.ID, ClientID: change.ClientID, Status: models.SyncApplied}, []models.TaskEvent{newTaskEvent(models.TaskDeleted, actorID, task, nil)}
+}
+
+// PurgeDeleted forgets tasks deleted before the given time. Clients whose sync
+// token predates a forgotten deletion have to sync from scratch. It returns
+// the number of deletions forgotten.
+func (s *TaskService) PurgeDeleted(before time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	kept := s.tombstones[:0]
+	for _, tombstone := range s.tombstones {
+		if tombstone.DeletedAt.Before(before) {
+			if tombstone.Version > s.purgedVersion {
+				s.purgedVersion = tombstone.Version
+			}
+			continue
+		}
+		kept = append(kept, tombstone)
+	}
+	purged := len(s.tombstones) - len(kept)
+	s.tombstones = kept
+	return purged
+}
+
+func (s *TaskService) indexLocked(id int) int {
+	for i, task := range s.tasks {
+		if task.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *TaskService) deletedLocked(id int) bool {
+	for _, tombstone := range s.tombstones {
+		if tombstone.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// setSyncField decodes a client value into one of the models.SyncFields.
+func setSyncField(task *models.Task, field string, value json.RawMessage) error {
+	var err error
+	switch field {
+	case "title":
+		err = json.Unmarshal(value, &task.Title)
+	case "description":
+		err = json.Unmarshal(value, &task.Description)
+	case "status":
+		var status models.Status
+		if err = json.Unmarshal(value, &status); err == nil {
+			if status != models.Todo && status != models.InProgress && status != models.Completed {
+				return fmt.Errorf("invalid status %q", status)
+			}
+			task.Status = status
+		}
+	case "assignee_id":
+		err = json.Unmarshal(value, &task.AssigneeID)
+	case "due_date":
+		var dueDate *time.Time
+		if err = json.Unmarshal(value, &dueDate); err == nil {
+			task.DueDate = dueDate
+		}
+	default:
+		return fmt.Errorf("unknown field %q", field)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value for %s", field)
+	}
+	return nil
+}
+
+func syncFieldValue(task models.Task, field string) interface{} {
+	switch field {
+	case "title":
+		return task.Title
+	case "description":
+		return task.Description
+	case "status":
+		return task.Status
+	case "assignee_id":
+		return task.AssigneeID
+	case "due_date":
+		return task.DueDate
+	}
+	return nil
+}
+
+// changedSyncFields returns the models.SyncFields that differ between a and b.
+func changedSyncFields(a, b models.Task) []string {
+	var fields []string
+	for _, field := range models.SyncFields {
+		switch field {
+		case "due_date":
+			if (a.DueDate == nil) != (b.DueDate == nil) || (a.DueDate != nil && !a.DueDate.Equal(*b.DueDate)) {
+				fields = append(fields, field)
+			}
+		default:
+			if syncFieldValue(a, field) != syncFieldValue(b, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
@@ -1,40 +1,126 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"sync"
 	"task-manager/models"
+	"time"
+)
+
+var (
+	// ErrTaskNotFound is returned for an unknown task ID.
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrTaskNotRecurring is returned when occurrences are requested for a task without a recurrence rule.
+	ErrTaskNotRecurring = errors.New("task does not recur")
+	// ErrAssigneeNotFound is returned when a task is assigned to an unknown user.
+	ErrAssigneeNotFound = errors.New("assignee does not exist")
 )
 
 type TaskService struct {
-	tasks  []models.Task
-	mutex  sync.Mutex
-	nextID int
+	tasks      []models.Task
+	mutex      sync.Mutex
+	nextID     int
+	events     *EventBus
+	version    int64 // version of the most recent change
+	tombstones []models.Tombstone
+	// purgedVersion is the version of the latest purged tombstone.
+	purgedVersion int64
+	users         *UserService
 }
 
 func NewTaskService() *TaskService {
 	return &TaskService{
 		tasks:  []models.Task{},
 		nextID: 1,
+		events: NewEventBus(defaultReplayBufferSize),
 	}
 }
 
-func (s *TaskService) CreateTask(title, description string) models.Task {
+// SetUsers sets the users tasks can be assigned to. Until it is called, any
+// assignee is accepted.
+func (s *TaskService) SetUsers(users *UserService) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	s.users = users
+}
+
+// CheckAssignee returns ErrAssigneeNotFound unless assigneeID is 0 (no
+// assignee) or the ID of an existing user.
+func (s *TaskService) CheckAssignee(assigneeID int) error {
+	s.mutex.Lock()
+	users := s.users
+	s.mutex.Unlock()
+
+	if assigneeID == 0 || users == nil {
+		return nil
+	}
+	if _, err := users.GetUserByID(assigneeID); err != nil {
+		return ErrAssigneeNotFound
+	}
+	return nil
+}
 
-	task := models.Task{
-		ID:          s.nextID,
-		Title:       title,
-		Description: description,
-		Status:      models.Todo,
+// CreateTask stores a new task built from the given fields.
+// The ID and status are assigned by the service; CreatorID is taken as the acting user.
+func (s *TaskService) CreateTask(input models.Task) models.Task {
+	input.Status = models.Todo
+	s.mutex.Lock()
+	task := s.insertTask(input, time.Now())
+	s.mutex.Unlock()
+
+	s.emit(createEvents(task.CreatorID, task)...)
+	return task
+}
+
+func createEvents(actorID int, task models.Task) []models.TaskEvent {
+	events := []models.TaskEvent{newTaskEvent(models.TaskCreated, actorID, task, nil)}
+	if task.AssigneeID != 0 {
+		events = append(events, newTaskEvent(models.TaskAssigned, actorID, task, nil))
+	}
+	return events
+}
+
+// insertTask stores a new task whose fields are considered changed at the given time.
+func (s *TaskService) insertTask(task models.Task, at time.Time) models.Task {
+	task.ID = s.nextID
+	if task.Status == "" {
+		task.Status = models.Todo
+	}
+	if task.Recurrence != nil && task.Recurrence.Index == 0 {
+		task.Recurrence.Index = 1
+	}
+	s.version++
+	task.Version = s.version
+	task.UpdatedAt = at
+	task.FieldUpdatedAt = make(map[string]time.Time, len(models.SyncFields))
+	for _, field := range models.SyncFields {
+		task.FieldUpdatedAt[field] = at
 	}
 	s.tasks = append(s.tasks, task)
 	s.nextID++
 	return task
 }
 
+// touchLocked gives the task at index i a new version after it was changed
+// from before. Sync fields that differ are marked as changed at the given time.
+func (s *TaskService) touchLocked(i int, before models.Task, at time.Time) {
+	task := &s.tasks[i]
+	fieldUpdatedAt := make(map[string]time.Time, len(models.SyncFields))
+	for field, t := range before.FieldUpdatedAt {
+		fieldUpdatedAt[field] = t
+	}
+	for _, field := range changedSyncFields(before, *task) {
+		fieldUpdatedAt[field] = at
+	}
+	s.version++
+	task.Version = s.version
+	task.UpdatedAt = at
+	task.FieldUpdatedAt = fieldUpdatedAt
+}
+
 func (s *TaskService) GetTasks(page, pageSize int, status models.Status, title string) []models.Task {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -63,51 +149,372 @@ func (s *TaskService) GetTasks(page, pageSize int, status models.Status, title s
 	return filteredTasks[start:end]
 }
 
+// CountByStatus returns the number of tasks in each status.
+func (s *TaskService) CountByStatus() map[models.Status]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	counts := map[models.Status]int{models.Todo: 0, models.InProgress: 0, models.Completed: 0}
+	for _, task := range s.tasks {
+		counts[task.Status]++
+	}
+	return counts
+}
+
 func (s *TaskService) GetTaskByID(id int) (*models.Task, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	for _, task := range s.tasks {
 		if task.ID == id {
 			return &task, nil
 		}
 	}
-	return nil, errors.New("task not found")
+	return nil, ErrTaskNotFound
+}
+
+// GetOpenTasksForUser returns the tasks that are not completed and are assigned
+// to the user, or created by the user and not assigned to anyone.
+func (s *TaskService) GetOpenTasksForUser(userID int) []models.Task {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var tasks []models.Task
+	for _, task := range s.tasks {
+		if task.Status == models.Completed {
+			continue
+		}
+		if task.AssigneeID == userID || (task.AssigneeID == 0 && task.CreatorID == userID) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// GetTasksForUser returns the tasks the user created or is assigned to.
+func (s *TaskService) GetTasksForUser(userID int) []models.Task {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tasks := []models.Task{}
+	for _, task := range s.tasks {
+		if task.CreatorID == userID || task.AssigneeID == userID {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
 }
 
-func (s *TaskService) findAndUpdateTask(id int, updateFunc func(*models.Task)) error {
+// Events returns the bus task events are published on.
+func (s *TaskService) Events() *EventBus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.events == nil {
+		s.events = NewEventBus(defaultReplayBufferSize)
+	}
+	return s.events
+}
+
+// Subscribe registers fn to be called for every task event.
+// Listeners are called synchronously after the service lock is released.
+func (s *TaskService) Subscribe(fn func(models.TaskEvent)) {
+	s.Events().Subscribe(fn)
+}
+
+func newTaskEvent(eventType models.TaskEventType, actorID int, task models.Task, previous *models.Task) models.TaskEvent {
+	return models.TaskEvent{Type: eventType, ActorID: actorID, Task: task, Previous: previous, Time: time.Now()}
+}
+
+func (s *TaskService) emit(events ...models.TaskEvent) {
+	bus := s.Events()
+	for _, event := range events {
+		bus.Publish(event)
+	}
+}
+
+// SendDueReminders emits a due-soon event for every open task due within the
+// given window that has not been reminded about yet. It returns the number of
+// reminders sent, and stops early with ctx.Err() once ctx is done.
+func (s *TaskService) SendDueReminders(ctx context.Context, now time.Time, window time.Duration) (int, error) {
+	s.mutex.Lock()
+	var events []models.TaskEvent
+	for i, task := range s.tasks {
+		if ctx.Err() != nil {
+			break
+		}
+		if task.Status == models.Completed || task.DueDate == nil || task.RemindedAt != nil {
+			continue
+		}
+		if task.DueDate.After(now) && !task.DueDate.After(now.Add(window)) {
+			remindedAt := now
+			s.tasks[i].RemindedAt = &remindedAt
+			s.touchLocked(i, task, now)
+			events = append(events, newTaskEvent(models.TaskDueSoon, 0, s.tasks[i], nil))
+		}
+	}
+	s.mutex.Unlock()
+
+	s.emit(events...)
+	return len(events), ctx.Err()
+}
+
+// MarkOverdueTasks flags open tasks whose due date has passed and emits an
+// overdue event for each newly flagged task. It returns the number of tasks
+// flagged, and stops early with ctx.Err() once ctx is done.
+func (s *TaskService) MarkOverdueTasks(ctx context.Context, now time.Time) (int, error) {
+	s.mutex.Lock()
+	var events []models.TaskEvent
+	for i, task := range s.tasks {
+		if ctx.Err() != nil {
+			break
+		}
+		if task.Status == models.Completed || task.DueDate == nil || task.Overdue {
+			continue
+		}
+		if task.DueDate.Before(now) {
+			s.tasks[i].Overdue = true
+			s.touchLocked(i, task, now)
+			events = append(events, newTaskEvent(models.TaskOverdue, 0, s.tasks[i], nil))
+		}
+	}
+	s.mutex.Unlock()
+
+	s.emit(events...)
+	return len(events), ctx.Err()
+}
+
+// findAndUpdateTask applies updateFunc to the task with the given ID and
+// returns the task as it was before and after the update.
+func (s *TaskService) findAndUpdateTask(id int, updateFunc func(*models.Task)) (models.Task, models.Task, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	for i, task := range s.tasks {
 		if task.ID == id {
 			updateFunc(&s.tasks[i])
-			return nil
+			s.touchLocked(i, task, time.Now())
+			return task, s.tasks[i], nil
 		}
 	}
-	return errors.New("task not found")
+	return models.Task{}, models.Task{}, ErrTaskNotFound
 }
 
-func (s *TaskService) UpdateTask(id int, title string, description string, status models.Status) error {
-	return s.findAndUpdateTask(id, func(task *models.Task) {
-		task.Title = title
-		task.Description = description
-		task.Status = status
-	})
+// updateEvents returns the events describing a change from before to after.
+func updateEvents(actorID int, before, after models.Task) []models.TaskEvent {
+	events := []models.TaskEvent{newTaskEvent(models.TaskUpdated, actorID, after, &before)}
+	if before.Status != after.Status {
+		events = append(events, newTaskEvent(models.TaskStatusChanged, actorID, after, &before))
+	}
+	if before.AssigneeID != after.AssigneeID {
+		events = append(events, newTaskEvent(models.TaskAssigned, actorID, after, &before))
+	}
+	return events
 }
 
-func (s *TaskService) MarkTaskAsComplete(id int) error {
-	return s.findAndUpdateTask(id, func(task *models.Task) {
-		task.Status = models.Completed
+// UpdateTask replaces the title, description and status of a task. Setting
+// the status to COMPLETED completes the task as MarkTaskAsComplete does.
+func (s *TaskService) UpdateTask(actorID, id int, title string, description string, status models.Status) error {
+	s.mutex.Lock()
+	i := s.indexLocked(id)
+	if i < 0 {
+		s.mutex.Unlock()
+		return ErrTaskNotFound
+	}
+	before := s.tasks[i]
+	completing := status == models.Completed && before.Status != models.Completed
+	var nextDue *time.Time
+	if completing {
+		var err error
+		if nextDue, err = nextDueDate(before); err != nil {
+			s.mutex.Unlock()
+			return err
+		}
+	}
+
+	now := time.Now()
+	s.tasks[i].Title = title
+	s.tasks[i].Description = description
+	s.tasks[i].Status = status
+	if completing {
+		s.tasks[i].Overdue = false
+	}
+	s.touchLocked(i, before, now)
+	events := updateEvents(actorID, before, s.tasks[i])
+	if completing {
+		_, completed := s.completedLocked(actorID, i, before, nextDue, now)
+		events = append(events, completed...)
+	}
+	s.mutex.Unlock()
+
+	s.emit(events...)
+	return nil
+}
+
+// AssignTask assigns a task to a user. An assigneeID of 0 unassigns the task.
+func (s *TaskService) AssignTask(actorID, id, assigneeID int) error {
+	if err := s.CheckAssignee(assigneeID); err != nil {
+		return err
+	}
+	before, after, err := s.findAndUpdateTask(id, func(task *models.Task) {
+		task.AssigneeID = assigneeID
 	})
+	if err != nil {
+		return err
+	}
+
+	if before.AssigneeID != after.AssigneeID {
+		s.emit(updateEvents(actorID, before, after)...)
+	}
+	return nil
 }
 
-func (s *TaskService) DeleteTask(id int) error {
+// SharesWork reports whether the two users are the creator or assignee of a
+// common task. It is meant to be registered with UserService.SetSuccessorCheck.
+func (s *TaskService) SharesWork(userID, otherID int) bool {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	for _, task := range s.tasks {
+		involves := func(id int) bool { return task.CreatorID == id || task.AssigneeID == id }
+		if involves(userID) && involves(otherID) {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleUserDeleted hands a deleted user's tasks over to successorID: tasks
+// they created or were assigned become the successor's. With a successorID of
+// 0 the tasks are kept, anonymized, and unassigned.
+// It is meant to be registered with UserService.OnDelete.
+func (s *TaskService) HandleUserDeleted(userID, successorID int) {
+	var events []models.TaskEvent
+	now := time.Now()
 
+	s.mutex.Lock()
+	for i, task := range s.tasks {
+		if task.CreatorID != userID && task.AssigneeID != userID {
+			continue
+		}
+		if task.CreatorID == userID {
+			s.tasks[i].CreatorID = successorID
+		}
+		if task.AssigneeID == userID {
+			s.tasks[i].AssigneeID = successorID
+		}
+		s.touchLocked(i, task, now)
+		events = append(events, updateEvents(0, task, s.tasks[i])...)
+	}
+	s.mutex.Unlock()
+
+	s.emit(events...)
+}
+
+// MarkTaskAsComplete marks a task as complete. If the task recurs, the next
+// occurrence is created as a new task and returned; otherwise the returned task is nil.
+func (s *TaskService) MarkTaskAsComplete(actorID, id int) (*models.Task, error) {
+	next, events, err := s.completeTask(actorID, id)
+	s.emit(events...)
+	return next, err
+}
+
+func (s *TaskService) completeTask(actorID, id int) (*models.Task, []models.TaskEvent, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexLocked(id)
+	if i < 0 {
+		return nil, nil, ErrTaskNotFound
+	}
+	task := s.tasks[i]
+	if task.Status == models.Completed {
+		return nil, nil, nil
+	}
+	// The next due date is computed first, so that the task is left
+	// unchanged when its rule cannot be evaluated.
+	nextDue, err := nextDueDate(task)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	s.tasks[i].Status = models.Completed
+	s.tasks[i].Overdue = false
+	s.touchLocked(i, task, now)
+	next, events := s.completedLocked(actorID, i, task, nextDue, now)
+	return next, events, nil
+}
+
+// nextDueDate returns the due date of the occurrence following task, or nil
+// when the task does not recur or its series has ended.
+func nextDueDate(task models.Task) (*time.Time, error) {
+	if task.Recurrence == nil || task.DueDate == nil {
+		return nil, nil
+	}
+	next, err := task.Recurrence.Next(*task.DueDate, 1)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute the next occurrence: %w", err)
+	}
+	if len(next) == 0 {
+		// The series has ended (COUNT or UNTIL reached).
+		return nil, nil
+	}
+	return &next[0], nil
+}
+
+// completedLocked records that the task at index i, previously before, has
+// just been completed, and creates its next occurrence when nextDue is set.
+// The caller holds the mutex.
+func (s *TaskService) completedLocked(actorID, i int, before models.Task, nextDue *time.Time, at time.Time) (*models.Task, []models.TaskEvent) {
+	task := s.tasks[i]
+	events := []models.TaskEvent{newTaskEvent(models.TaskCompleted, actorID, task, &before)}
+	if nextDue == nil {
+		return nil, events
+	}
+
+	recurrence := *task.Recurrence
+	recurrence.Index++
+	nextTask := s.insertTask(models.Task{
+		Title:       task.Title,
+		Description: task.Description,
+		CreatorID:   task.CreatorID,
+		AssigneeID:  task.AssigneeID,
+		DueDate:     nextDue,
+		Recurrence:  &recurrence,
+	}, at)
+	events = append(events, newTaskEvent(models.TaskCreated, actorID, nextTask, nil))
+	return &nextTask, events
+}
+
+// GetOccurrences returns up to n upcoming due dates of a recurring task,
+// starting after the task's own due date.
+func (s *TaskService) GetOccurrences(id, n int) ([]time.Time, error) {
+	task, err := s.GetTaskByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if task.Recurrence == nil || task.DueDate == nil {
+		return nil, ErrTaskNotRecurring
+	}
+	return task.Recurrence.Next(*task.DueDate, n)
+}
+
+func (s *TaskService) DeleteTask(actorID, id int) error {
+	s.mutex.Lock()
 	for i, task := range s.tasks {
 		if task.ID == id {
-			s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+			s.removeLocked(i, time.Now())
+			s.mutex.Unlock()
+			s.emit(newTaskEvent(models.TaskDeleted, actorID, task, nil))
 			return nil
 		}
 	}
-	return errors.New("task not found")
+	s.mutex.Unlock()
+	return ErrTaskNotFound
+}
+
+// removeLocked deletes the task at index i and leaves a tombstone for syncing clients.
+func (s *TaskService) removeLocked(i int, at time.Time) {
+	s.version++
+	s.tombstones = append(s.tombstones, models.Tombstone{ID: s.tasks[i].ID, Version: s.version, DeletedAt: at})
+	s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
 }
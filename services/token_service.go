@@ -0,0 +1,283 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"task-manager/models"
+	"task-manager/utils"
+	"time"
+)
+
+// RefreshTokenTTL is how long a session can go without refreshing before the user has to log in again.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown or expired refresh tokens.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token is used a second
+	// time. The token has probably been stolen, so its whole session is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	ErrSessionNotFound    = errors.New("session not found")
+)
+
+// TokenService issues access and refresh tokens and keeps track of revoked ones.
+// Every login starts a session; the refresh tokens of a session rotate on every
+// refresh and the access tokens issued for it carry its ID.
+type TokenService struct {
+	users           *UserService
+	refreshTokens   map[string]*models.RefreshToken // by hash
+	sessions        map[string]*models.Session      // active sessions by ID
+	revokedTokens   map[string]time.Time            // access token ID -> expiry
+	revokedSessions map[string]time.Time            // session ID -> when it can be forgotten
+	mutex           sync.Mutex
+}
+
+func NewTokenService(users *UserService) *TokenService {
+	return &TokenService{
+		users:           users,
+		refreshTokens:   map[string]*models.RefreshToken{},
+		sessions:        map[string]*models.Session{},
+		revokedTokens:   map[string]time.Time{},
+		revokedSessions: map[string]time.Time{},
+	}
+}
+
+// IssueTokens starts a new session for the user on the device with the given
+// user agent and IP address, and returns its first tokens.
+func (s *TokenService) IssueTokens(user *models.User, userAgent, ip string) (*models.TokenPair, error) {
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+	sessionID, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	s.sessions[sessionID] = &models.Session{
+		ID:         sessionID,
+		UserID:     user.ID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	return s.issueLocked(user, sessionID, now)
+}
+
+func (s *TokenService) issueLocked(user *models.User, sessionID string, now time.Time) (*models.TokenPair, error) {
+	accessToken, _, err := utils.GenerateAccessToken(user.ID, user.Email, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hash := utils.HashToken(refreshToken)
+	s.refreshTokens[hash] = &models.RefreshToken{
+		Hash:      hash,
+		UserID:    user.ID,
+		SessionID: sessionID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(RefreshTokenTTL),
+	}
+	if session, ok := s.sessions[sessionID]; ok {
+		session.LastSeenAt = now
+		session.ExpiresAt = now.Add(RefreshTokenTTL)
+	}
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL / time.Second),
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and refresh token.
+// The old refresh token can no longer be used; presenting it again revokes the session.
+func (s *TokenService) Refresh(refreshToken string) (*models.TokenPair, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	stored, ok := s.refreshTokens[utils.HashToken(refreshToken)]
+	if !ok || now.After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		logger.Warn("refresh token reused, revoking its session", "user_id", stored.UserID, "session_id", stored.SessionID)
+		s.revokeSessionLocked(stored.SessionID, now)
+		return nil, ErrRefreshTokenReused
+	}
+	user, err := s.users.GetUserByID(stored.UserID)
+	if err != nil || user.Disabled {
+		return nil, ErrInvalidRefreshToken
+	}
+	stored.UsedAt = &now
+	return s.issueLocked(user, stored.SessionID, now)
+}
+
+// Logout revokes the given access token and its session. refreshToken is
+// optional and only needed to end sessions of tokens issued without one.
+func (s *TokenService) Logout(claims *utils.Claims, refreshToken string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		s.revokedTokens[claims.ID] = claims.ExpiresAt.Time
+	}
+	if claims.SessionID != "" {
+		s.revokeSessionLocked(claims.SessionID, now)
+	}
+	if stored, ok := s.refreshTokens[utils.HashToken(refreshToken)]; ok && stored.UserID == claims.UserID {
+		s.revokeSessionLocked(stored.SessionID, now)
+	}
+}
+
+// Impersonate starts a session in which the administrator acts as the user.
+// The session shows in the user's session list and ends after ttl, at most
+// utils.AccessTokenTTL, or when either of them logs out everywhere.
+func (s *TokenService) Impersonate(admin, user *models.User, ttl time.Duration, userAgent, ip string) (*models.ImpersonationToken, error) {
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+	sessionID, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	token, claims, err := utils.GenerateImpersonationToken(user.ID, user.Email, sessionID, admin.ID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	s.sessions[sessionID] = &models.Session{
+		ID:             sessionID,
+		UserID:         user.ID,
+		UserAgent:      userAgent,
+		IP:             ip,
+		CreatedAt:      now,
+		LastSeenAt:     now,
+		ExpiresAt:      claims.ExpiresAt.Time,
+		ImpersonatorID: admin.ID,
+	}
+	return &models.ImpersonationToken{
+		AccessToken:    token,
+		UserID:         user.ID,
+		ImpersonatorID: admin.ID,
+		SessionID:      sessionID,
+		ExpiresAt:      claims.ExpiresAt.Time,
+	}, nil
+}
+
+// LogoutAll revokes every session of the user, including the sessions in
+// which they impersonate others.
+func (s *TokenService) LogoutAll(userID int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for id, session := range s.sessions {
+		if session.UserID == userID || session.ImpersonatorID == userID {
+			s.revokeSessionLocked(id, now)
+		}
+	}
+}
+
+// GetSessions returns the user's active sessions, most recently seen first.
+func (s *TokenService) GetSessions(userID int) []models.Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	sessions := []models.Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID && now.Before(session.ExpiresAt) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions
+}
+
+// RevokeSession ends one of the user's sessions.
+func (s *TokenService) RevokeSession(userID int, sessionID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	s.revokeSessionLocked(sessionID, time.Now())
+	return nil
+}
+
+// Touch records that the session of an access token was just used from ip.
+// It is used by middleware.JWTAuthMiddleware.
+func (s *TokenService) Touch(claims *utils.Claims, ip string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if session, ok := s.sessions[claims.SessionID]; ok && session.UserID == claims.UserID {
+		session.LastSeenAt = time.Now()
+		session.IP = ip
+	}
+}
+
+// revokeSessionLocked deletes the refresh tokens of a session and remembers the
+// session as revoked for as long as access tokens issued for it may be valid.
+func (s *TokenService) revokeSessionLocked(sessionID string, now time.Time) {
+	for hash, stored := range s.refreshTokens {
+		if stored.SessionID == sessionID {
+			delete(s.refreshTokens, hash)
+		}
+	}
+	delete(s.sessions, sessionID)
+	s.revokedSessions[sessionID] = now.Add(utils.AccessTokenTTL)
+}
+
+// IsRevoked reports whether an access token has been revoked, either on its
+// own or together with its session. It is used by middleware.JWTAuthMiddleware.
+func (s *TokenService) IsRevoked(claims *utils.Claims) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.revokedTokens[claims.ID]; ok && claims.ID != "" {
+		return true
+	}
+	_, ok := s.revokedSessions[claims.SessionID]
+	return ok && claims.SessionID != ""
+}
+
+// PurgeExpired forgets expired refresh tokens and sessions, and revocations of tokens that have expired anyway.
+func (s *TokenService) PurgeExpired(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for hash, stored := range s.refreshTokens {
+		if now.After(stored.ExpiresAt) {
+			delete(s.refreshTokens, hash)
+		}
+	}
+	for id, session := range s.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+	for id, expiresAt := range s.revokedTokens {
+		if now.After(expiresAt) {
+			delete(s.revokedTokens, id)
+		}
+	}
+	for id, forgetAt := range s.revokedSessions {
+		if now.After(forgetAt) {
+			delete(s.revokedSessions, id)
+		}
+	}
+}
@@ -2,38 +2,139 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
 	"sync"
 	"task-manager/models"
+	"time"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrUserNotFound is returned when there is no user with the given ID.
+var ErrUserNotFound = errors.New("user not found")
+
+var (
+	// ErrAccountDisabled is returned when a disabled user tries to log in.
+	ErrAccountDisabled = errors.New("account is disabled")
+	// ErrPasswordResetRequired is returned when a user must reset their
+	// password before they can log in with it.
+	ErrPasswordResetRequired = errors.New("password reset required, check your email for a reset link")
+	// ErrLastAdmin is returned when a change would leave no active administrator.
+	ErrLastAdmin = errors.New("cannot remove the last administrator")
+	// ErrReauthenticationRequired is returned when a user without a password
+	// changes their account without having just logged in through single sign-on.
+	ErrReauthenticationRequired = errors.New("log in again through single sign-on to confirm this change")
+	// ErrEmailTaken is returned when another user has the email address.
+	ErrEmailTaken = errors.New("email already exists")
+	// ErrInvalidSuccessor is returned when a deleted user's tasks cannot be
+	// handed over to the chosen user.
+	ErrInvalidSuccessor = errors.New("tasks can only be transferred to a user you share tasks with")
+	// ErrUnverifiedAccount is returned when a single sign-on login matches a
+	// user who has not verified their email address, and so may not own it.
+	ErrUnverifiedAccount = errors.New("an account with this email address exists but has not verified it; log in with its password and verify the address first")
+)
+
+// reauthenticationWindow is how long after logging in through single sign-on
+// a user without a password may change their account.
+const reauthenticationWindow = 5 * time.Minute
+
 type UserService struct {
-	users  []models.User
-	mutex  sync.Mutex
-	nextID int
+	users       []models.User
+	mutex       sync.Mutex
+	nextID      int
+	deleteHooks []func(userID, successorID int)
+	policy      *PasswordPolicy // DefaultPasswordPolicy when nil
+	adminEmails map[string]bool
+	ssoLogins   map[int]time.Time // last single sign-on login per user
+	sharesWork  func(userID, otherID int) bool
 }
 
 func NewUserService() *UserService {
 	return &UserService{
-		users:  []models.User{},
-		nextID: 1,
+		users:     []models.User{},
+		nextID:    1,
+		ssoLogins: map[int]time.Time{},
+	}
+}
+
+// SetPasswordPolicy sets the policy new passwords must satisfy.
+func (s *UserService) SetPasswordPolicy(policy PasswordPolicy) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.policy = &policy
+}
+
+// PasswordPolicy returns the policy new passwords must satisfy.
+func (s *UserService) PasswordPolicy() PasswordPolicy {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.policyLocked()
+}
+
+// SetAdminEmails makes the users with the given email addresses
+// administrators, including those who sign up later, once they have verified
+// the address. It is how the first administrators are appointed; they can
+// then change the roles of others.
+func (s *UserService) SetAdminEmails(emails []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.adminEmails = map[string]bool{}
+	for _, email := range emails {
+		if email = normalizeEmail(email); email != "" {
+			s.adminEmails[email] = true
+		}
+	}
+	for i := range s.users {
+		s.appointLocked(i)
+	}
+}
+
+// appointLocked makes the user an administrator if their verified address is
+// one of the admin emails. Unverified addresses do not count, since anyone
+// can sign up with them.
+func (s *UserService) appointLocked(i int) {
+	if s.users[i].EmailVerified && s.adminEmails[s.users[i].Email] {
+		s.users[i].Role = models.RoleAdmin
 	}
 }
 
+// normalizeEmail trims and lowercases an email address. Addresses are stored
+// normalized, so that they can be compared with ==.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func (s *UserService) policyLocked() PasswordPolicy {
+	if s.policy == nil {
+		return DefaultPasswordPolicy()
+	}
+	return *s.policy
+}
+
 func (s *UserService) Register(email, password string) (*models.User, error) {
+	email = normalizeEmail(email)
+	policy := s.PasswordPolicy()
+	if err := policy.Validate(password, email); err != nil {
+		return nil, err
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	// Check if email already exists
 	for _, user := range s.users {
 		if user.Email == email {
-			return nil, errors.New("email already exists")
+			return nil, ErrEmailTaken
 		}
 	}
 
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), policy.BcryptCost)
 	if err != nil {
 		return nil, err
 	}
@@ -42,24 +143,516 @@ func (s *UserService) Register(email, password string) (*models.User, error) {
 		ID:       s.nextID,
 		Email:    email,
 		Password: string(hashedPassword),
+		Role:     models.RoleUser,
 	}
 	s.users = append(s.users, user)
 	s.nextID++
 	return &user, nil
 }
 
+// ErrInvalidCredentials is returned by Authenticate for both unknown emails
+// and wrong passwords, so that callers cannot tell them apart.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+var (
+	dummyHashes      = map[int][]byte{}
+	dummyHashesMutex sync.Mutex
+)
+
+// dummyPasswordHash returns a hash of the given cost to compare against when
+// there is no password to check, so that Authenticate takes as long for
+// unknown users as for known ones.
+func dummyPasswordHash(cost int) []byte {
+	dummyHashesMutex.Lock()
+	defer dummyHashesMutex.Unlock()
+	hash, ok := dummyHashes[cost]
+	if !ok {
+		hash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), cost)
+		dummyHashes[cost] = hash
+	}
+	return hash
+}
+
+// Authenticate checks the user's password. Hashes made with a lower cost than
+// the password policy's are rehashed at the current cost. Disabled users and
+// users who must reset their password get ErrAccountDisabled and
+// ErrPasswordResetRequired, but only once the password is known to be right.
 func (s *UserService) Authenticate(email, password string) (*models.User, error) {
+	email = normalizeEmail(email)
+	s.mutex.Lock()
+	var found *models.User
+	for _, user := range s.users {
+		if user.Email == email {
+			found = &user
+			break
+		}
+	}
+	policy := s.policyLocked()
+	s.mutex.Unlock()
+
+	// Compare the provided password with the hashed password
+	hash := dummyPasswordHash(policy.BcryptCost)
+	if found != nil && found.Password != "" {
+		hash = []byte(found.Password)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || found == nil || found.Password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	if cost, err := bcrypt.Cost(hash); err == nil && cost < policy.BcryptCost {
+		s.upgradeHash(found, password, policy.BcryptCost)
+	}
+	if err := CheckLoginAllowed(found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// CheckLoginAllowed returns ErrAccountDisabled or ErrPasswordResetRequired if
+// the user may not log in, however they proved who they are.
+func CheckLoginAllowed(user *models.User) error {
+	if user.Disabled {
+		return ErrAccountDisabled
+	}
+	if user.PasswordResetRequired {
+		return ErrPasswordResetRequired
+	}
+	return nil
+}
+
+// upgradeHash rehashes the user's password with a higher cost, unless the
+// password changed in the meantime.
+func (s *UserService) upgradeHash(user *models.User, password string, cost int) {
+	upgraded, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if i := s.indexLocked(user.ID); i >= 0 && s.users[i].Password == user.Password {
+		s.users[i].Password = string(upgraded)
+		user.Password = string(upgraded)
+	}
+}
+
+// GetUsers returns all registered users.
+func (s *UserService) GetUsers() []models.User {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]models.User{}, s.users...)
+}
+
+// GetUserByID returns the user with the given ID.
+func (s *UserService) GetUserByID(id int) (*models.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, user := range s.users {
+		if user.ID == id {
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// GetUserByEmail returns the user with the given email address, ignoring case.
+func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
+	email = normalizeEmail(email)
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	for _, user := range s.users {
 		if user.Email == email {
-			// Compare the provided password with the hashed password
-			if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-				return nil, errors.New("incorrect password")
-			}
 			return &user, nil
 		}
 	}
 	return nil, errors.New("user not found")
 }
+
+// FindOrCreateUser returns the user with the given email address, creating
+// one without a password if there is none. Such users can only log in through
+// single sign-on. It returns ErrUnverifiedAccount for a user who has not
+// verified the address, since anyone could have registered with it.
+func (s *UserService) FindOrCreateUser(email string) (*models.User, error) {
+	email = normalizeEmail(email)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			if !user.EmailVerified {
+				return nil, ErrUnverifiedAccount
+			}
+			return &user, nil
+		}
+	}
+	user := models.User{ID: s.nextID, Email: email, Role: models.RoleUser}
+	s.users = append(s.users, user)
+	s.nextID++
+	return &user, nil
+}
+
+// SetPassword replaces the user's password, if it meets the password policy.
+// It satisfies a required password reset.
+func (s *UserService) SetPassword(userID int, password string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	policy := s.PasswordPolicy()
+	if err := policy.Validate(password, user.Email); err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), policy.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.users {
+		if s.users[i].ID == userID {
+			s.users[i].Password = string(hashedPassword)
+			s.users[i].PasswordResetRequired = false
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// MarkEmailVerified records that the user has proven their email address,
+// which makes them an administrator if it is one of the admin emails.
+func (s *UserService) MarkEmailVerified(userID int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.users {
+		if s.users[i].ID == userID {
+			s.users[i].EmailVerified = true
+			s.appointLocked(i)
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+// localePattern matches BCP 47 language tags such as "en", "pt-BR" or "zh-Hant-TW".
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+const maxDisplayNameLength = 100
+
+// UpdateProfile changes the user's profile fields that are set in update.
+func (s *UserService) UpdateProfile(userID int, update models.ProfileUpdate) (*models.User, error) {
+	if update.DisplayName != nil {
+		name := strings.TrimSpace(*update.DisplayName)
+		if utf8.RuneCountInString(name) > maxDisplayNameLength {
+			return nil, fmt.Errorf("display_name must be at most %d characters", maxDisplayNameLength)
+		}
+		update.DisplayName = &name
+	}
+	if update.AvatarURL != nil && *update.AvatarURL != "" {
+		u, err := url.Parse(*update.AvatarURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, errors.New("avatar_url must be an http or https URL")
+		}
+	}
+	if update.Timezone != nil && *update.Timezone != "" {
+		if _, err := time.LoadLocation(*update.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", *update.Timezone)
+		}
+	}
+	if update.Locale != nil && *update.Locale != "" && !localePattern.MatchString(*update.Locale) {
+		return nil, fmt.Errorf("invalid locale %q", *update.Locale)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexLocked(userID)
+	if i < 0 {
+		return nil, ErrUserNotFound
+	}
+	user := &s.users[i]
+	if update.DisplayName != nil {
+		user.DisplayName = *update.DisplayName
+	}
+	if update.AvatarURL != nil {
+		user.AvatarURL = *update.AvatarURL
+	}
+	if update.Timezone != nil {
+		user.Timezone = *update.Timezone
+	}
+	if update.Locale != nil {
+		user.Locale = *update.Locale
+	}
+	updated := *user
+	return &updated, nil
+}
+
+// ChangePassword replaces the user's password after checking the current one.
+// Users without a password, who log in through single sign-on, can set one
+// without a current password right after logging in.
+func (s *UserService) ChangePassword(userID int, currentPassword, newPassword string) error {
+	if err := s.checkPassword(userID, currentPassword); err != nil {
+		return err
+	}
+	return s.SetPassword(userID, newPassword)
+}
+
+// CheckEmailChange checks the user's password and that no one else has the
+// new address. The address is only changed by ChangeEmail, once the user has
+// proven they receive email there.
+func (s *UserService) CheckEmailChange(userID int, email, password string) (*models.User, error) {
+	email = normalizeEmail(email)
+	if email == "" {
+		return nil, errors.New("email is required")
+	}
+	if err := s.checkPassword(userID, password); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkEmailLocked(userID, email); err != nil {
+		return nil, err
+	}
+	i := s.indexLocked(userID)
+	if i < 0 {
+		return nil, ErrUserNotFound
+	}
+	user := s.users[i]
+	return &user, nil
+}
+
+// ChangeEmail changes the user's email address to one they have verified.
+func (s *UserService) ChangeEmail(userID int, email string) (*models.User, error) {
+	email = normalizeEmail(email)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkEmailLocked(userID, email); err != nil {
+		return nil, err
+	}
+	i := s.indexLocked(userID)
+	if i < 0 {
+		return nil, ErrUserNotFound
+	}
+	s.users[i].Email = email
+	s.users[i].EmailVerified = true
+	s.appointLocked(i)
+	updated := s.users[i]
+	return &updated, nil
+}
+
+// checkEmailLocked returns an error if another user has the email address.
+func (s *UserService) checkEmailLocked(userID int, email string) error {
+	for _, user := range s.users {
+		if user.ID != userID && user.Email == email {
+			return ErrEmailTaken
+		}
+	}
+	return nil
+}
+
+// OnDelete registers a function to call when a user is deleted, to clean up
+// or hand over what belongs to them. successorID is the user chosen to take
+// over the deleted user's tasks, or 0 to anonymize them.
+func (s *UserService) OnDelete(fn func(userID, successorID int)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.deleteHooks = append(s.deleteHooks, fn)
+}
+
+// SetSuccessorCheck sets the function that decides whether a deleted user's
+// tasks may be handed over to another user: only to someone they already
+// share work with. Without it, tasks cannot be handed over at all.
+func (s *UserService) SetSuccessorCheck(sharesWork func(userID, otherID int) bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sharesWork = sharesWork
+}
+
+// DeleteUser deletes the user after checking their password. Their tasks are
+// transferred to successorID, who must share tasks with them, or anonymized
+// when it is 0.
+func (s *UserService) DeleteUser(userID int, password string, successorID int) error {
+	if successorID == userID {
+		return errors.New("cannot transfer tasks to the deleted user")
+	}
+	if err := s.checkPassword(userID, password); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	sharesWork := s.sharesWork
+	if successorID != 0 && s.indexLocked(successorID) < 0 {
+		s.mutex.Unlock()
+		return errors.New("successor not found")
+	}
+	s.mutex.Unlock()
+	// Called without the mutex, since it asks other services.
+	if successorID != 0 && (sharesWork == nil || !sharesWork(userID, successorID)) {
+		return ErrInvalidSuccessor
+	}
+
+	s.mutex.Lock()
+	i := s.indexLocked(userID)
+	if i < 0 {
+		s.mutex.Unlock()
+		return ErrUserNotFound
+	}
+	s.users = append(s.users[:i], s.users[i+1:]...)
+	delete(s.ssoLogins, userID)
+	hooks := append([]func(int, int){}, s.deleteHooks...)
+	s.mutex.Unlock()
+
+	for _, fn := range hooks {
+		fn(userID, successorID)
+	}
+	return nil
+}
+
+// IsAdmin reports whether the user is an administrator whose account is enabled.
+// It is used by middleware.AdminMiddleware.
+func (s *UserService) IsAdmin(userID int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexLocked(userID)
+	return i >= 0 && s.users[i].IsAdmin()
+}
+
+// SearchUsers returns the users matching the filter, ordered by ID.
+func (s *UserService) SearchUsers(filter models.UserFilter) []models.User {
+	query := strings.ToLower(strings.TrimSpace(filter.Query))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	users := []models.User{}
+	for _, user := range s.users {
+		if query != "" && !strings.Contains(strings.ToLower(user.Email), query) && !strings.Contains(strings.ToLower(user.DisplayName), query) {
+			continue
+		}
+		if filter.Role != "" && user.Role != filter.Role {
+			continue
+		}
+		if filter.Disabled != nil && user.Disabled != *filter.Disabled {
+			continue
+		}
+		users = append(users, user)
+	}
+	return users
+}
+
+// SetDisabled disables or re-enables the user's account. Callers are
+// expected to end the sessions of users they disable.
+func (s *UserService) SetDisabled(userID int, disabled bool) (*models.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexLocked(userID)
+	if i < 0 {
+		return nil, ErrUserNotFound
+	}
+	if disabled && s.users[i].IsAdmin() && s.adminCountLocked() == 1 {
+		return nil, ErrLastAdmin
+	}
+	s.users[i].Disabled = disabled
+	updated := s.users[i]
+	return &updated, nil
+}
+
+// SetRole changes the user's role to models.RoleUser or models.RoleAdmin.
+func (s *UserService) SetRole(userID int, role string) (*models.User, error) {
+	if role != models.RoleUser && role != models.RoleAdmin {
+		return nil, fmt.Errorf("role must be %q or %q", models.RoleUser, models.RoleAdmin)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexLocked(userID)
+	if i < 0 {
+		return nil, ErrUserNotFound
+	}
+	if role != models.RoleAdmin && s.users[i].IsAdmin() && s.adminCountLocked() == 1 {
+		return nil, ErrLastAdmin
+	}
+	s.users[i].Role = role
+	updated := s.users[i]
+	return &updated, nil
+}
+
+// RequirePasswordReset stops the user from logging in with their current
+// password until they set a new one.
+func (s *UserService) RequirePasswordReset(userID int) (*models.User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexLocked(userID)
+	if i < 0 {
+		return nil, ErrUserNotFound
+	}
+	s.users[i].PasswordResetRequired = true
+	updated := s.users[i]
+	return &updated, nil
+}
+
+// adminCountLocked returns the number of enabled administrators.
+func (s *UserService) adminCountLocked() int {
+	count := 0
+	for i := range s.users {
+		if s.users[i].IsAdmin() {
+			count++
+		}
+	}
+	return count
+}
+
+// MarkSSOLogin records that the user has just logged in through single
+// sign-on, which users without a password need to have done to change their
+// account.
+func (s *UserService) MarkSSOLogin(userID int, at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.indexLocked(userID) >= 0 {
+		s.ssoLogins[userID] = at
+	}
+}
+
+// checkPassword returns ErrInvalidCredentials unless password is the user's
+// password. Users without one, who log in through single sign-on, get
+// ErrReauthenticationRequired unless they did so within the last few minutes.
+func (s *UserService) checkPassword(userID int, password string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Password == "" {
+		s.mutex.Lock()
+		loggedIn, ok := s.ssoLogins[userID]
+		s.mutex.Unlock()
+		if !ok || time.Since(loggedIn) > reauthenticationWindow {
+			return ErrReauthenticationRequired
+		}
+		return nil
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (s *UserService) indexLocked(userID int) int {
+	for i, user := range s.users {
+		if user.ID == userID {
+			return i
+		}
+	}
+	return -1
+}
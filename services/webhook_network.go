@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// webhookResolveTimeout bounds the DNS lookup of a webhook host at registration.
+const webhookResolveTimeout = 5 * time.Second
+
+// errBlockedAddress is returned for webhook URLs that point into private networks.
+var errBlockedAddress = errors.New("url must not point to a loopback, private or link-local address")
+
+// reservedNetworks are blocked in addition to loopback, private (RFC 1918 and
+// RFC 4193), link-local, multicast and unspecified addresses.
+var reservedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+}
+
+// AllowNetworks lets webhooks be delivered to addresses in the given networks
+// even though they are private, for receivers inside the deployment. Every
+// other loopback, private and link-local address, such as the cloud metadata
+// endpoint 169.254.169.254, is refused.
+func (s *WebhookService) AllowNetworks(networks ...netip.Prefix) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.allowedNetworks = append([]netip.Prefix{}, networks...)
+}
+
+// addressAllowed reports whether webhooks may be sent to addr.
+func (s *WebhookService) addressAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	s.mutex.Lock()
+	allowed := s.allowedNetworks
+	s.mutex.Unlock()
+	for _, network := range allowed {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWebhookHost resolves host and refuses it when any of its addresses is
+// blocked. Deliveries check the address again when connecting, since the
+// host may resolve differently by then.
+func (s *WebhookService) checkWebhookHost(host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !s.addressAllowed(addr) {
+			return errBlockedAddress
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookResolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("could not resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !s.addressAllowed(addr) {
+			return errBlockedAddress
+		}
+	}
+	return nil
+}
+
+// newWebhookClient returns the client deliveries are sent with. It refuses
+// to connect to blocked addresses, which also covers redirects and hosts
+// whose DNS records changed after registration.
+func (s *WebhookService) newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !s.addressAllowed(addrPort.Addr()) {
+				return fmt.Errorf("connecting to %s: %w", addrPort.Addr(), errBlockedAddress)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			// No proxy: the address checked must be the receiver's.
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost:   2,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+}
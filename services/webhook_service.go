@@ -0,0 +1,452 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"task-manager/models"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader carries "sha256=" followed by the hex HMAC-SHA256 of
+	// "<timestamp>.<body>" keyed with the webhook secret.
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	// WebhookTimestampHeader carries the Unix time of the attempt; receivers should
+	// reject requests whose timestamp is too old to prevent replay.
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+
+	// maxWebhookAttempts is the number of attempts before a delivery is given up.
+	maxWebhookAttempts = 6
+	// webhookRetryBackoff is the delay before the first retry, doubled on each further failure.
+	webhookRetryBackoff = 30 * time.Second
+	// maxWebhookDeliveries bounds the delivery log kept per webhook.
+	maxWebhookDeliveries = 100
+	// webhookWorkers bounds the number of webhooks delivered to concurrently.
+	webhookWorkers = 8
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+// WebhookService manages webhook subscriptions and delivers signed task event
+// payloads to them. Deliveries are queued by HandleTaskEvent and sent by DeliverDue.
+type WebhookService struct {
+	webhooks       []models.Webhook
+	deliveries     []models.WebhookDelivery
+	mutex          sync.Mutex
+	nextWebhookID  int
+	nextDeliveryID int
+	client         *http.Client
+	attemptHooks   []func(models.WebhookDelivery)
+	// allowedNetworks are private networks webhooks may be delivered to.
+	allowedNetworks []netip.Prefix
+}
+
+// NewWebhookService returns a service delivering with client. When client is
+// nil, deliveries use a client that refuses to connect to private addresses.
+func NewWebhookService(client *http.Client) *WebhookService {
+	s := &WebhookService{
+		webhooks:       []models.Webhook{},
+		deliveries:     []models.WebhookDelivery{},
+		nextWebhookID:  1,
+		nextDeliveryID: 1,
+		client:         client,
+	}
+	if s.client == nil {
+		s.client = s.newWebhookClient()
+	}
+	return s
+}
+
+// CreateWebhook registers a webhook for the user. If secret is empty a random one
+// is generated. The returned webhook includes the secret, which is not shown again.
+func (s *WebhookService) CreateWebhook(userID int, rawURL, secret string, events []models.TaskEventType) (*models.Webhook, error) {
+	if err := s.validateWebhook(rawURL, events); err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	webhook := models.Webhook{
+		ID:        s.nextWebhookID,
+		UserID:    userID,
+		URL:       rawURL,
+		Secret:    secret,
+		Events:    events,
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+	s.webhooks = append(s.webhooks, webhook)
+	s.nextWebhookID++
+	return &webhook, nil
+}
+
+func (s *WebhookService) validateWebhook(rawURL string, events []models.TaskEventType) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	for _, event := range events {
+		if !isWebhookEvent(event) {
+			return fmt.Errorf("unsupported event %q", event)
+		}
+	}
+	return s.checkWebhookHost(u.Hostname())
+}
+
+func isWebhookEvent(event models.TaskEventType) bool {
+	for _, e := range models.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWebhooks returns the user's webhooks.
+func (s *WebhookService) GetWebhooks(userID int) []models.Webhook {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := []models.Webhook{}
+	for _, webhook := range s.webhooks {
+		if webhook.UserID == userID {
+			result = append(result, webhook)
+		}
+	}
+	return result
+}
+
+// GetWebhook returns one of the user's webhooks.
+func (s *WebhookService) GetWebhook(userID, id int) (*models.Webhook, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexOf(userID, id)
+	if i < 0 {
+		return nil, ErrWebhookNotFound
+	}
+	webhook := s.webhooks[i]
+	return &webhook, nil
+}
+
+// UpdateWebhook changes the URL, event filter and active state of one of the user's webhooks.
+func (s *WebhookService) UpdateWebhook(userID, id int, rawURL string, events []models.TaskEventType, active bool) (*models.Webhook, error) {
+	if err := s.validateWebhook(rawURL, events); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexOf(userID, id)
+	if i < 0 {
+		return nil, ErrWebhookNotFound
+	}
+	s.webhooks[i].URL = rawURL
+	s.webhooks[i].Events = events
+	s.webhooks[i].Active = active
+	webhook := s.webhooks[i]
+	return &webhook, nil
+}
+
+// DeleteWebhook removes one of the user's webhooks along with its delivery log.
+func (s *WebhookService) DeleteWebhook(userID, id int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.indexOf(userID, id)
+	if i < 0 {
+		return ErrWebhookNotFound
+	}
+	s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+
+	deliveries := s.deliveries[:0]
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID != id {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	s.deliveries = deliveries
+	return nil
+}
+
+func (s *WebhookService) indexOf(userID, id int) int {
+	for i, webhook := range s.webhooks {
+		if webhook.ID == id && webhook.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetDeliveries returns the delivery log of one of the user's webhooks, newest first.
+func (s *WebhookService) GetDeliveries(userID, webhookID int) ([]models.WebhookDelivery, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.indexOf(userID, webhookID) < 0 {
+		return nil, ErrWebhookNotFound
+	}
+	result := []models.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID == webhookID {
+			result = append(result, delivery)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	return result, nil
+}
+
+// Redeliver queues a delivery to be sent again as soon as possible, with a fresh attempt budget.
+func (s *WebhookService) Redeliver(userID, webhookID, deliveryID int) (*models.WebhookDelivery, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.indexOf(userID, webhookID) < 0 {
+		return nil, ErrWebhookNotFound
+	}
+	for i, delivery := range s.deliveries {
+		if delivery.ID == deliveryID && delivery.WebhookID == webhookID {
+			now := time.Now()
+			s.deliveries[i].Attempts = 0
+			s.deliveries[i].Delivered = false
+			s.deliveries[i].NextAttemptAt = &now
+			d := s.deliveries[i]
+			return &d, nil
+		}
+	}
+	return nil, ErrDeliveryNotFound
+}
+
+// HandleTaskEvent queues a delivery for every active webhook subscribed to the event.
+// It is meant to be registered with TaskService.Subscribe.
+func (s *WebhookService) HandleTaskEvent(event models.TaskEvent) {
+	if !isWebhookEvent(event.Type) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, webhook := range s.webhooks {
+		if !webhook.Active || !subscribed(webhook, event.Type) {
+			continue
+		}
+		id := s.nextDeliveryID
+		s.nextDeliveryID++
+		payload, err := json.Marshal(map[string]interface{}{
+			"id":         id,
+			"event":      event.Type,
+			"created_at": event.Time,
+			"data":       map[string]interface{}{"task": event.Task},
+		})
+		if err != nil {
+			continue
+		}
+		now := time.Now()
+		s.deliveries = append(s.deliveries, models.WebhookDelivery{
+			ID:            id,
+			WebhookID:     webhook.ID,
+			Event:         event.Type,
+			Payload:       payload,
+			CreatedAt:     now,
+			NextAttemptAt: &now,
+		})
+		s.trimDeliveries(webhook.ID)
+	}
+}
+
+func subscribed(webhook models.Webhook, event models.TaskEventType) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// trimDeliveries drops the oldest finished deliveries of a webhook beyond maxWebhookDeliveries.
+func (s *WebhookService) trimDeliveries(webhookID int) {
+	count := 0
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		if s.deliveries[i].WebhookID != webhookID {
+			continue
+		}
+		count++
+		if count > maxWebhookDeliveries && s.deliveries[i].NextAttemptAt == nil {
+			s.deliveries = append(s.deliveries[:i], s.deliveries[i+1:]...)
+		}
+	}
+}
+
+type pendingDelivery struct {
+	delivery models.WebhookDelivery
+	webhook  models.Webhook
+}
+
+// DeliverDue attempts every delivery whose next attempt time has come.
+// Up to webhookWorkers webhooks are delivered to at once, the deliveries of
+// each webhook in order, so that a slow receiver does not hold up the others.
+// Failed attempts are retried with exponential backoff up to maxWebhookAttempts.
+func (s *WebhookService) DeliverDue(ctx context.Context, now time.Time) error {
+	s.mutex.Lock()
+	var queues [][]pendingDelivery
+	queueOf := map[int]int{} // webhook ID to index in queues
+	for _, delivery := range s.deliveries {
+		if delivery.NextAttemptAt == nil || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		for _, webhook := range s.webhooks {
+			if webhook.ID != delivery.WebhookID {
+				continue
+			}
+			i, ok := queueOf[webhook.ID]
+			if !ok {
+				i = len(queues)
+				queueOf[webhook.ID] = i
+				queues = append(queues, nil)
+			}
+			queues[i] = append(queues[i], pendingDelivery{delivery, webhook})
+		}
+	}
+	s.mutex.Unlock()
+
+	work := make(chan []pendingDelivery)
+	var wg sync.WaitGroup
+	for i := 0; i < webhookWorkers && i < len(queues); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for queue := range work {
+				for _, p := range queue {
+					if ctx.Err() != nil {
+						break
+					}
+					s.deliver(ctx, p, now)
+				}
+			}
+		}()
+	}
+	for _, queue := range queues {
+		work <- queue
+	}
+	close(work)
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (s *WebhookService) deliver(ctx context.Context, p pendingDelivery, now time.Time) {
+	statusCode, err := s.send(ctx, p.webhook, p.delivery, now)
+	if err != nil {
+		logger.WarnContext(ctx, "webhook delivery failed", "webhook_id", p.webhook.ID, "delivery_id", p.delivery.ID, "attempt", p.delivery.Attempts+1, "status_code", statusCode, "error", err)
+	} else {
+		logger.DebugContext(ctx, "webhook delivered", "webhook_id", p.webhook.ID, "delivery_id", p.delivery.ID, "status_code", statusCode)
+	}
+	s.recordAttempt(p.delivery.ID, statusCode, err, now)
+}
+
+func (s *WebhookService) send(ctx context.Context, webhook models.Webhook, delivery models.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "task-manager-webhooks")
+	req.Header.Set(WebhookEventHeader, string(delivery.Event))
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// OnAttempt registers a function to call after every delivery attempt, with
+// the delivery as updated by the attempt. It is called with the service
+// locked, so it must not call back.
+func (s *WebhookService) OnAttempt(fn func(models.WebhookDelivery)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attemptHooks = append(s.attemptHooks, fn)
+}
+
+func (s *WebhookService) recordAttempt(deliveryID, statusCode int, err error, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, delivery := range s.deliveries {
+		if delivery.ID != deliveryID {
+			continue
+		}
+		defer func() {
+			for _, hook := range s.attemptHooks {
+				hook(s.deliveries[i])
+			}
+		}()
+		attemptedAt := now
+		s.deliveries[i].Attempts++
+		s.deliveries[i].StatusCode = statusCode
+		s.deliveries[i].LastAttemptAt = &attemptedAt
+		if err == nil {
+			s.deliveries[i].Delivered = true
+			s.deliveries[i].Error = ""
+			s.deliveries[i].NextAttemptAt = nil
+			return
+		}
+		s.deliveries[i].Error = err.Error()
+		if s.deliveries[i].Attempts >= maxWebhookAttempts {
+			s.deliveries[i].NextAttemptAt = nil
+			return
+		}
+		next := now.Add(webhookRetryBackoff << (s.deliveries[i].Attempts - 1))
+		s.deliveries[i].NextAttemptAt = &next
+		return
+	}
+}
+
+// SignWebhookPayload returns the signature header value for a payload sent at the given Unix timestamp.
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// minHMACKeySize is the minimum length of an HS256 secret in bytes.
+const minHMACKeySize = 32
+
+// SigningKey is a key tokens are signed or verified with. Keys without a
+// private part (or secret) only verify tokens; they are kept around after a
+// rotation until the tokens they signed have expired.
+type SigningKey struct {
+	ID        string // the "kid" header of tokens signed with this key
+	Algorithm string
+	signKey   interface{} // []byte, *rsa.PrivateKey or ed25519.PrivateKey; nil for verification-only keys
+	verifyKey interface{} // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// NewSigningKey creates a key for the given algorithm from an HMAC secret
+// ([]byte), an RSA or Ed25519 private key, or an RSA or Ed25519 public key.
+func NewSigningKey(id, algorithm string, key interface{}) (*SigningKey, error) {
+	if id == "" {
+		return nil, errors.New("key ID is required")
+	}
+	k := &SigningKey{ID: id, Algorithm: algorithm}
+	switch key := key.(type) {
+	case []byte:
+		if algorithm != HS256 {
+			return nil, fmt.Errorf("key %s: a secret can only be used with %s", id, HS256)
+		}
+		if len(key) < minHMACKeySize {
+			return nil, fmt.Errorf("key %s: secret must be at least %d bytes", id, minHMACKeySize)
+		}
+		k.signKey, k.verifyKey = key, key
+	case *rsa.PrivateKey:
+		if algorithm != RS256 {
+			return nil, fmt.Errorf("key %s: an RSA key can only be used with %s", id, RS256)
+		}
+		k.signKey, k.verifyKey = key, &key.PublicKey
+	case *rsa.PublicKey:
+		if algorithm != RS256 {
+			return nil, fmt.Errorf("key %s: an RSA key can only be used with %s", id, RS256)
+		}
+		k.verifyKey = key
+	case ed25519.PrivateKey:
+		if algorithm != EdDSA {
+			return nil, fmt.Errorf("key %s: an Ed25519 key can only be used with %s", id, EdDSA)
+		}
+		k.signKey, k.verifyKey = key, key.Public()
+	case ed25519.PublicKey:
+		if algorithm != EdDSA {
+			return nil, fmt.Errorf("key %s: an Ed25519 key can only be used with %s", id, EdDSA)
+		}
+		k.verifyKey = key
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", id, key)
+	}
+	if rsaKey, ok := k.verifyKey.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("key %s: RSA keys must be at least 2048 bits", id)
+	}
+	return k, nil
+}
+
+// LoadSigningKey reads a key from a file. HS256 keys are read as a raw secret;
+// RS256 and EdDSA keys as PEM encoded PKCS #1/PKCS #8 private keys or PKIX public keys.
+func LoadSigningKey(id, algorithm, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == HS256 {
+		return NewSigningKey(id, algorithm, []byte(strings.TrimSpace(string(data))))
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: %s is not PEM encoded", id, path)
+	}
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		return nil, fmt.Errorf("key %s: ECDSA keys are not supported", id)
+	}
+	return NewSigningKey(id, algorithm, key)
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// CanSign reports whether the key has a private part.
+func (k *SigningKey) CanSign() bool {
+	return k.signKey != nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // OKP curve
+	X         string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwk returns the public key in JWK format. Secrets are never published.
+func (k *SigningKey) jwk() (JWK, bool) {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch key := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{KeyType: "RSA", KeyID: k.ID, Algorithm: k.Algorithm, Use: "sig", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}, true
+	case ed25519.PublicKey:
+		return JWK{KeyType: "OKP", KeyID: k.ID, Algorithm: k.Algorithm, Use: "sig", Curve: "Ed25519", X: encode(key)}, true
+	}
+	return JWK{}, false
+}
@@ -1,38 +1,171 @@
 package utils
 
 import (
+	"crypto/rand"
 	"errors"
+	"fmt"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte("my_secret_key")
+// AccessTokenTTL is how long access tokens are valid. Clients renew them with a refresh token.
+const AccessTokenTTL = 15 * time.Minute
+
+// JWTConfig configures how tokens are signed and validated.
+type JWTConfig struct {
+	// Keys are all keys tokens are accepted from. The first key signs new
+	// tokens and must have a private part; the others are kept for rotation.
+	Keys     []*SigningKey
+	Issuer   string // the "iss" claim set and required when not empty
+	Audience string // the "aud" claim set and required when not empty
+}
+
+var (
+	jwtConfig JWTConfig
+	jwtKeys   map[string]*SigningKey
+	jwtMutex  sync.RWMutex
+)
+
+// Until ConfigureJWT is called, tokens are signed with a random HS256 key,
+// so they do not survive a restart.
+func init() {
+	secret := make([]byte, minHMACKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	key, _ := NewSigningKey("default", HS256, secret)
+	if err := ConfigureJWT(JWTConfig{Keys: []*SigningKey{key}}); err != nil {
+		panic(err)
+	}
+}
+
+// ConfigureJWT replaces the keys and claims used for signing and validating tokens.
+func ConfigureJWT(config JWTConfig) error {
+	if len(config.Keys) == 0 || !config.Keys[0].CanSign() {
+		return errors.New("the first JWT key must be able to sign")
+	}
+	keys := make(map[string]*SigningKey, len(config.Keys))
+	for _, key := range config.Keys {
+		if _, ok := keys[key.ID]; ok {
+			return fmt.Errorf("duplicate JWT key ID %q", key.ID)
+		}
+		keys[key.ID] = key
+	}
+
+	jwtMutex.Lock()
+	defer jwtMutex.Unlock()
+	jwtConfig = config
+	jwtKeys = keys
+	return nil
+}
 
 type Claims struct {
 	UserID int    `json:"user_id"`
 	Email  string `json:"email"`
+	// SessionID identifies the login the token was issued for; revoking the
+	// session revokes every access token issued for it.
+	SessionID string `json:"sid,omitempty"`
+	// ImpersonatorID is the administrator who obtained the token to act as
+	// the user. It is 0 for the user's own tokens.
+	ImpersonatorID int `json:"impersonator_id,omitempty"`
+	// Scopes limit what a personal access token may do. They are nil for
+	// tokens obtained by logging in, which may do everything.
+	Scopes []string `json:"-"`
 	jwt.RegisteredClaims
 }
 
+// HasScope reports whether the token may be used for the given scope.
+func (c *Claims) HasScope(scope string) bool {
+	return c.Scopes == nil || slices.Contains(c.Scopes, scope)
+}
+
+// GenerateJWT issues an access token that is not tied to a session.
 func GenerateJWT(userID int, email string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	token, _, err := GenerateAccessToken(userID, email, "")
+	return token, err
+}
+
+// GenerateAccessToken issues an access token for the given session. Every token
+// gets a unique ID (the "jti" claim) so that it can be revoked on its own.
+func GenerateAccessToken(userID int, email, sessionID string) (string, *Claims, error) {
+	return signAccessToken(&Claims{UserID: userID, Email: email, SessionID: sessionID}, AccessTokenTTL)
+}
+
+// GenerateImpersonationToken issues an access token that lets an administrator
+// act as the user. It is valid for ttl, which cannot exceed AccessTokenTTL.
+func GenerateImpersonationToken(userID int, email, sessionID string, impersonatorID int, ttl time.Duration) (string, *Claims, error) {
+	if impersonatorID == 0 {
+		return "", nil, errors.New("impersonator is required")
+	}
+	if ttl <= 0 || ttl > AccessTokenTTL {
+		ttl = AccessTokenTTL
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return signAccessToken(&Claims{UserID: userID, Email: email, SessionID: sessionID, ImpersonatorID: impersonatorID}, ttl)
 }
 
+func signAccessToken(claims *Claims, ttl time.Duration) (string, *Claims, error) {
+	id, err := RandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	jwtMutex.RLock()
+	config := jwtConfig
+	jwtMutex.RUnlock()
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        id,
+		Issuer:    config.Issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+	if config.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{config.Audience}
+	}
+
+	key := config.Keys[0]
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.signKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// ValidateJWT parses a token and checks its signature and claims. The key is
+// chosen by the "kid" header, and the token's "alg" must be the algorithm of
+// that key, so that a public key can never be used as an HMAC secret.
 func ValidateJWT(tokenString string) (*Claims, error) {
+	jwtMutex.RLock()
+	config, keys := jwtConfig, jwtKeys
+	jwtMutex.RUnlock()
+
+	options := []jwt.ParserOption{jwt.WithValidMethods([]string{HS256, RS256, EdDSA}), jwt.WithExpirationRequired()}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys[kid]
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New("unexpected signing algorithm")
+		}
+		return key.verifyKey, nil
+	}, options...)
 
 	if err != nil {
 		return nil, err
@@ -44,3 +177,18 @@ func ValidateJWT(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// PublicJWKS returns the public keys tokens are signed with, for other services
+// to verify them. HS256 secrets are not included.
+func PublicJWKS() JWKS {
+	jwtMutex.RLock()
+	defer jwtMutex.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range jwtConfig.Keys {
+		if jwk, ok := key.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
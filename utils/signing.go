@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// SignValue returns a URL-safe token carrying value and an HMAC-SHA256 signature
+// over it. The purpose is mixed into the signature so that a token issued for one
+// use (e.g. "unsubscribe") cannot be replayed for another.
+func SignValue(key []byte, purpose, value string) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signature(key, purpose, encoded))
+}
+
+// VerifySignedValue checks a token produced by SignValue and returns its value.
+func VerifySignedValue(key []byte, purpose, token string) (string, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidInput
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, signature(key, purpose, encoded)) {
+		return "", ErrUnauthorized
+	}
+	value, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidInput
+	}
+	return string(value), nil
+}
+
+func signature(key []byte, purpose, encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose + ":" + encoded))
+	return mac.Sum(nil)
+}
+
+// HashToken returns the SHA-256 hash of a secret token, hex encoded, for
+// storing tokens such that a leaked store does not reveal usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns n random bytes, hex encoded.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -9,6 +9,9 @@ type Response struct {
 	Status  string      `json:"status"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"` // `omitempty` skips empty fields
+	// RequestID is set on errors, from the X-Request-ID response header, so
+	// that users can quote it and operators find the matching log lines.
+	RequestID string `json:"request_id,omitempty"`
 }
 
 func SendJSONResponse(w http.ResponseWriter, statusCode int, status string, message string, data interface{}) {
@@ -17,6 +20,9 @@ func SendJSONResponse(w http.ResponseWriter, statusCode int, status string, mess
 		Message: message,
 		Data:    data,
 	}
+	if status == "error" {
+		response.RequestID = w.Header().Get("X-Request-ID")
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)